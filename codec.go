@@ -0,0 +1,35 @@
+package ssz
+
+import (
+	"reflect"
+
+	"github.com/prysmaticlabs/go-ssz/types"
+)
+
+// Codec encodes, decodes and hashes values of types which cannot be given methods, such
+// as types of other packages. Values are handed to a codec as values of the type it was
+// registered for, and decoded values are stored into pointers to that type as needed.
+type Codec = types.Codec
+
+// RegisterCodec makes values of typ, and pointers to them, be encoded, decoded and hashed
+// by codec wherever they are nested. Codecs have to be registered before values of their
+// types are first used, such as in init functions.
+//
+//  func init() {
+//      if err := RegisterCodec(reflect.TypeOf(&big.Int{}), uint256Codec{}); err != nil {
+//          panic(err)
+//      }
+//  }
+func RegisterCodec(typ reflect.Type, codec Codec) error {
+	return types.RegisterCodec(typ, codec)
+}
+
+// RegisterNamedCodec makes the fields tagged with `ssz-codec:"name"` be encoded, decoded
+// and hashed by codec, whatever their type.
+//
+//  type deposit struct {
+//      Deadline time.Time `ssz-codec:"unix-seconds"`
+//  }
+func RegisterNamedCodec(name string, codec Codec) error {
+	return types.RegisterNamedCodec(name, codec)
+}
@@ -0,0 +1,224 @@
+package ssz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// uint256Codec encodes big integers as 32 little-endian bytes, hashed as a uint256.
+type uint256Codec struct{}
+
+func (uint256Codec) IsVariableSSZ() bool          { return false }
+func (uint256Codec) FixedSizeSSZ() uint64         { return 32 }
+func (uint256Codec) SizeSSZ(v interface{}) uint64 { return 32 }
+
+func (uint256Codec) MarshalSSZTo(dst []byte, v interface{}) ([]byte, error) {
+	var enc [32]byte
+	if n := v.(*big.Int); n != nil {
+		if n.Sign() < 0 || n.BitLen() > 256 {
+			return nil, errors.New("integer out of range")
+		}
+		n.FillBytes(enc[:])
+	}
+	// Reverse the big-endian bytes.
+	for i, j := 0, len(enc)-1; i < j; i, j = i+1, j-1 {
+		enc[i], enc[j] = enc[j], enc[i]
+	}
+	return append(dst, enc[:]...), nil
+}
+
+func (uint256Codec) UnmarshalSSZ(buf []byte) (interface{}, error) {
+	if len(buf) != 32 {
+		return nil, errors.New("uint256 must be 32 bytes")
+	}
+	enc := make([]byte, 32)
+	for i := range buf {
+		enc[31-i] = buf[i]
+	}
+	return new(big.Int).SetBytes(enc), nil
+}
+
+func (c uint256Codec) HashTreeRootSSZ(v interface{}) ([32]byte, error) {
+	enc, err := c.MarshalSSZTo(nil, v)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	var root [32]byte
+	copy(root[:], enc)
+	return root, nil
+}
+
+// unixSecondsCodec encodes times as the number of seconds since the Unix epoch.
+type unixSecondsCodec struct{}
+
+func (unixSecondsCodec) IsVariableSSZ() bool          { return false }
+func (unixSecondsCodec) FixedSizeSSZ() uint64         { return 8 }
+func (unixSecondsCodec) SizeSSZ(v interface{}) uint64 { return 8 }
+
+func (unixSecondsCodec) MarshalSSZTo(dst []byte, v interface{}) ([]byte, error) {
+	var enc [8]byte
+	binary.LittleEndian.PutUint64(enc[:], uint64(v.(time.Time).Unix()))
+	return append(dst, enc[:]...), nil
+}
+
+func (unixSecondsCodec) UnmarshalSSZ(buf []byte) (interface{}, error) {
+	if len(buf) != 8 {
+		return nil, errors.New("time must be 8 bytes")
+	}
+	return time.Unix(int64(binary.LittleEndian.Uint64(buf)), 0).UTC(), nil
+}
+
+func (unixSecondsCodec) HashTreeRootSSZ(v interface{}) ([32]byte, error) {
+	var root [32]byte
+	binary.LittleEndian.PutUint64(root[:], uint64(v.(time.Time).Unix()))
+	return root, nil
+}
+
+func registerTestCodecs(t *testing.T) {
+	if err := RegisterCodec(reflect.TypeOf(&big.Int{}), uint256Codec{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterNamedCodec("unix-seconds", unixSecondsCodec{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type codecHolder struct {
+	Balance  *big.Int
+	Deadline time.Time  `ssz-codec:"unix-seconds"`
+	Amounts  []*big.Int `ssz-max:"4"`
+	Supply   big.Int
+	Slot     uint64
+}
+
+// codecMirror is encoded and hashed as codecHolder is with its codecs.
+type codecMirror struct {
+	Balance  [32]byte
+	Deadline uint64
+	Amounts  [][32]byte `ssz-max:"4"`
+	Supply   [32]byte
+	Slot     uint64
+}
+
+func TestCodec_MatchesEquivalentTypes(t *testing.T) {
+	registerTestCodecs(t)
+	v := &codecHolder{
+		Balance:  big.NewInt(1000),
+		Deadline: time.Unix(1600000000, 0).UTC(),
+		Amounts:  []*big.Int{big.NewInt(1), new(big.Int).Lsh(big.NewInt(1), 200)},
+		Slot:     9,
+	}
+	v.Supply.SetUint64(1 << 40)
+	mirror := &codecMirror{
+		Balance:  [32]byte{0xe8, 0x03},
+		Deadline: 1600000000,
+		Amounts:  [][32]byte{{1}, {25: 1}},
+		Supply:   [32]byte{5: 1},
+		Slot:     9,
+	}
+	want, err := Marshal(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(enc, want) {
+		t.Errorf("Marshal() = %#x, want %#x", enc, want)
+	}
+	wantRoot, err := HashTreeRoot(mirror)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := HashTreeRoot(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != wantRoot {
+		t.Errorf("HashTreeRoot() = %#x, want %#x", root, wantRoot)
+	}
+	fromBytes, err := HashTreeRootFromBytes(enc, reflect.TypeOf(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromBytes != wantRoot {
+		t.Errorf("HashTreeRootFromBytes() = %#x, want %#x", fromBytes, wantRoot)
+	}
+
+	decoded := &codecHolder{}
+	if err := Unmarshal(enc, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Balance.Cmp(v.Balance) != 0 || decoded.Supply.Cmp(&v.Supply) != 0 {
+		t.Errorf("Unmarshal() = %v and %v, want %v and %v", decoded.Balance, &decoded.Supply, v.Balance, &v.Supply)
+	}
+	if !decoded.Deadline.Equal(v.Deadline) {
+		t.Errorf("Unmarshal() deadline = %v, want %v", decoded.Deadline, v.Deadline)
+	}
+	if len(decoded.Amounts) != 2 || decoded.Amounts[1].Cmp(v.Amounts[1]) != 0 {
+		t.Errorf("Unmarshal() amounts = %v, want %v", decoded.Amounts, v.Amounts)
+	}
+}
+
+func TestCodec_TaggedFieldView(t *testing.T) {
+	registerTestCodecs(t)
+	v := &codecHolder{Deadline: time.Unix(1700000000, 0).UTC()}
+	enc, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err := View(enc, reflect.TypeOf(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline, err := view.Field("Deadline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deadline.Type() != reflect.TypeOf(time.Time{}) {
+		t.Errorf("Type() = %v, want time.Time", deadline.Type())
+	}
+	if _, err := deadline.Field("wall"); err == nil {
+		t.Error("Expected error selecting a field of a value with a codec")
+	}
+	lazy, err := NewLazy(bytes.NewReader(enc), int64(len(enc)), reflect.TypeOf(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	field, err := lazy.Field("Deadline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded time.Time
+	if err := field.Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(v.Deadline) {
+		t.Errorf("Decode() = %v, want %v", decoded, v.Deadline)
+	}
+}
+
+func TestCodec_Errors(t *testing.T) {
+	registerTestCodecs(t)
+	if err := RegisterCodec(reflect.TypeOf(uint64(0)), uint256Codec{}); err == nil {
+		t.Error("Expected error registering a codec for a basic type")
+	}
+	if err := RegisterNamedCodec("", unixSecondsCodec{}); err == nil {
+		t.Error("Expected error registering a codec without a name")
+	}
+	type unknownCodec struct {
+		Deadline time.Time `ssz-codec:"unknown"`
+	}
+	if _, err := Marshal(&unknownCodec{}); err == nil {
+		t.Error("Expected error marshaling a field tagged with an unknown codec")
+	}
+	if _, err := Marshal(&codecHolder{Balance: big.NewInt(-1)}); err == nil {
+		t.Error("Expected error from the codec of a nested value")
+	}
+}
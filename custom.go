@@ -0,0 +1,43 @@
+package ssz
+
+import (
+	"github.com/prysmaticlabs/go-ssz/types"
+)
+
+// Marshaler is implemented by custom types which encode themselves.
+type Marshaler = types.Marshaler
+
+// Unmarshaler is implemented by custom types which decode themselves.
+type Unmarshaler = types.Unmarshaler
+
+// HashRooter is implemented by custom types which compute their own hash tree root.
+type HashRooter = types.HashRooter
+
+// Layout is implemented by custom types to describe whether they are variable-size,
+// and the size of their encoding when they are not.
+type Layout = types.Layout
+
+// CustomType is implemented by types which Marshal, Unmarshal and HashTreeRoot hand over
+// to their own methods wherever they are nested, rather than walking them by reflection.
+// Custom types are opaque, so fields and elements cannot be selected within them by views
+// or partial decoding. For example, a wrapper around an externally defined point could be
+// encoded as:
+//
+//  type Point struct{ p *external.Point }
+//
+//  func (p *Point) IsVariableSSZ() bool  { return false }
+//  func (p *Point) FixedSizeSSZ() uint64 { return 48 }
+//  func (p *Point) SizeSSZ() int         { return 48 }
+//  func (p *Point) MarshalSSZTo(dst []byte) ([]byte, error) {
+//      return append(dst, p.p.Compress()...), nil
+//  }
+//  func (p *Point) UnmarshalSSZ(buf []byte) (err error) {
+//      p.p, err = external.Decompress(buf)
+//      return err
+//  }
+//  func (p *Point) HashTreeRootSSZ() ([32]byte, error) {
+//      var compressed [48]byte
+//      copy(compressed[:], p.p.Compress())
+//      return ssz.HashTreeRoot(compressed)
+//  }
+type CustomType = types.CustomType
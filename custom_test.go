@@ -0,0 +1,244 @@
+package ssz
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// customPoint is a fixed-size custom type with unexported fields, encoded big-endian,
+// which reflection could neither encode nor hash.
+type customPoint struct {
+	x, y uint16
+}
+
+func (p *customPoint) IsVariableSSZ() bool  { return false }
+func (p *customPoint) FixedSizeSSZ() uint64 { return 4 }
+func (p *customPoint) SizeSSZ() int         { return 4 }
+
+func (p *customPoint) MarshalSSZTo(dst []byte) ([]byte, error) {
+	var enc [4]byte
+	binary.BigEndian.PutUint16(enc[:2], p.x)
+	binary.BigEndian.PutUint16(enc[2:], p.y)
+	return append(dst, enc[:]...), nil
+}
+
+func (p *customPoint) UnmarshalSSZ(buf []byte) error {
+	if len(buf) != 4 {
+		return errors.New("point must be 4 bytes")
+	}
+	p.x = binary.BigEndian.Uint16(buf[:2])
+	p.y = binary.BigEndian.Uint16(buf[2:])
+	return nil
+}
+
+func (p *customPoint) HashTreeRootSSZ() ([32]byte, error) {
+	enc, err := p.MarshalSSZTo(nil)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(enc), nil
+}
+
+// customBlob is a variable-size custom type of a slice kind, which rejects empty input.
+type customBlob []byte
+
+func (b *customBlob) IsVariableSSZ() bool  { return true }
+func (b *customBlob) FixedSizeSSZ() uint64 { return 0 }
+func (b *customBlob) SizeSSZ() int         { return len(*b) + 1 }
+
+func (b *customBlob) MarshalSSZTo(dst []byte) ([]byte, error) {
+	dst = append(dst, byte(len(*b)))
+	return append(dst, *b...), nil
+}
+
+func (b *customBlob) UnmarshalSSZ(buf []byte) error {
+	if len(buf) == 0 || int(buf[0]) != len(buf)-1 {
+		return errors.New("blob length prefix does not match")
+	}
+	*b = append(customBlob{}, buf[1:]...)
+	return nil
+}
+
+func (b *customBlob) HashTreeRootSSZ() ([32]byte, error) {
+	return sha256.Sum256(*b), nil
+}
+
+type customHolder struct {
+	Slot   uint64
+	Point  customPoint
+	Blob   *customBlob
+	Points []customPoint `ssz-max:"8"`
+	Blobs  []customBlob  `ssz-max:"4"`
+	Tail   uint32
+}
+
+func newCustomHolder() *customHolder {
+	blob := customBlob{9, 8, 7}
+	return &customHolder{
+		Slot:   3,
+		Point:  customPoint{x: 1, y: 2},
+		Blob:   &blob,
+		Points: []customPoint{{x: 3, y: 4}, {x: 5, y: 6}},
+		Blobs:  []customBlob{{1}, {2, 3}},
+		Tail:   7,
+	}
+}
+
+func TestCustomType_Marshal(t *testing.T) {
+	enc, err := Marshal(newCustomHolder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		3, 0, 0, 0, 0, 0, 0, 0, // Slot
+		0, 1, 0, 2, // Point
+		28, 0, 0, 0, // Blob offset
+		32, 0, 0, 0, // Points offset
+		40, 0, 0, 0, // Blobs offset
+		7, 0, 0, 0, // Tail
+		3, 9, 8, 7, // Blob
+		0, 3, 0, 4, 0, 5, 0, 6, // Points
+		8, 0, 0, 0, 10, 0, 0, 0, 1, 1, 2, 2, 3, // Blobs
+	}
+	if !bytes.Equal(enc, want) {
+		t.Errorf("Marshal() = %v, want %v", enc, want)
+	}
+	decoded := &customHolder{}
+	if err := Unmarshal(enc, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, newCustomHolder()) {
+		t.Errorf("Unmarshal() = %+v, want %+v", decoded, newCustomHolder())
+	}
+}
+
+func TestCustomType_HashTreeRoot(t *testing.T) {
+	v := newCustomHolder()
+	pointRoot, err := v.Point.HashTreeRootSSZ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobRoot, err := v.Blob.HashTreeRootSSZ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pointRoots := make([][32]byte, len(v.Points))
+	for i := range v.Points {
+		if pointRoots[i], err = v.Points[i].HashTreeRootSSZ(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blobRoots := make([][32]byte, len(v.Blobs))
+	for i := range v.Blobs {
+		if blobRoots[i], err = v.Blobs[i].HashTreeRootSSZ(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The holder hashes as the container of the roots of its fields.
+	var fieldRoots struct {
+		Slot, Point, Blob, Points, Blobs, Tail [32]byte
+	}
+	if fieldRoots.Slot, err = HashTreeRoot(v.Slot); err != nil {
+		t.Fatal(err)
+	}
+	fieldRoots.Point, fieldRoots.Blob = pointRoot, blobRoot
+	if fieldRoots.Points, err = HashTreeRootWithCapacity(pointRoots, 8); err != nil {
+		t.Fatal(err)
+	}
+	if fieldRoots.Blobs, err = HashTreeRootWithCapacity(blobRoots, 4); err != nil {
+		t.Fatal(err)
+	}
+	if fieldRoots.Tail, err = HashTreeRoot(v.Tail); err != nil {
+		t.Fatal(err)
+	}
+	want, err := HashTreeRoot(fieldRoots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := HashTreeRoot(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != want {
+		t.Errorf("HashTreeRoot() = %#x, want %#x", root, want)
+	}
+	enc, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromBytes, err := HashTreeRootFromBytes(enc, reflect.TypeOf(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromBytes != want {
+		t.Errorf("HashTreeRootFromBytes() = %#x, want %#x", fromBytes, want)
+	}
+	lazy, err := NewLazy(bytes.NewReader(enc), int64(len(enc)), reflect.TypeOf(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazyRoot, err := lazy.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lazyRoot != want {
+		t.Errorf("Lazy.HashTreeRoot() = %#x, want %#x", lazyRoot, want)
+	}
+}
+
+func TestCustomType_Opaque(t *testing.T) {
+	enc, err := Marshal(newCustomHolder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err := View(enc, reflect.TypeOf(customHolder{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	point, err := view.Field("Points")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if point, err = point.Index(1); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(point.Bytes(), []byte{0, 5, 0, 6}) {
+		t.Errorf("Points[1] = %v, want [0 5 0 6]", point.Bytes())
+	}
+	blob, err := view.Field("Blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blob.Index(0); err == nil {
+		t.Error("Expected error selecting an element of a custom type")
+	}
+	if blob.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", blob.Len())
+	}
+	if _, err := FieldBytes(enc, reflect.TypeOf(customHolder{}), "Point.x"); err == nil {
+		t.Error("Expected error selecting a field of a custom type")
+	}
+}
+
+func TestCustomType_RejectedByOwnMethods(t *testing.T) {
+	enc, err := Marshal(newCustomHolder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last blob is cut short of its length prefix.
+	if err := Unmarshal(enc[:len(enc)-1], &customHolder{}); err == nil {
+		t.Error("Expected error unmarshaling truncated input")
+	}
+	// The length prefix of Blob no longer matches its bytes.
+	enc[28] = 5
+	if err := Unmarshal(enc, &customHolder{}); err == nil {
+		t.Error("Expected error unmarshaling a malformed custom type")
+	}
+	if _, err := View(enc, reflect.TypeOf(customHolder{})); err == nil {
+		t.Error("Expected error viewing a malformed custom type")
+	}
+}
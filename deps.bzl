@@ -142,6 +142,24 @@ def go_ssz_dependencies():
         importpath = "github.com/ferranbt/fastssz",
     )
 
+    _maybe(
+        # MIT License
+        # https://github.com/prysmaticlabs/gohashtree/blob/main/LICENSE
+        go_repository,
+        name = "com_github_prysmaticlabs_gohashtree",
+        importpath = "github.com/prysmaticlabs/gohashtree",
+        sum = "h1:cSo6/vk8YpvkLbk9v3FO97cakNmUoxwi2KMP8hd5WIw=",
+        version = "v0.0.1-alpha.0.20220714111606-acbb2962fb48",
+    )
+
+    _maybe(
+        go_repository,
+        name = "com_github_klauspost_cpuid_v2",
+        importpath = "github.com/klauspost/cpuid/v2",
+        sum = "h1:i2lw1Pm7Yi/4O6XCSyJWqEHI2MDw2FzUK6o/D21xn2A=",
+        version = "v2.0.11",
+    )
+
 def _maybe(repo_rule, name, **kwargs):
     if name not in native.existing_rules():
         repo_rule(name = name, **kwargs)
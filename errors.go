@@ -0,0 +1,71 @@
+package ssz
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/prysmaticlabs/go-ssz/types"
+)
+
+// DecodeError is returned by Unmarshal when the input cannot be decoded. It records
+// the path of the failing field, such as BeaconState.Validators[1023].Pubkey,
+// the byte offset into the input, and a sentinel cause usable with errors.Is.
+type DecodeError = types.DecodeError
+
+// DecodeOptions bounds the resources used by UnmarshalWithOptions. A zero
+// value for any of its limits leaves that limit unenforced.
+type DecodeOptions = types.DecodeOptions
+
+// LimitError is the cause of a DecodeError returned when decoding would
+// exceed one of the limits in DecodeOptions.
+type LimitError = types.LimitError
+
+// EncodeError is returned by Marshal when a value cannot be encoded. It records
+// the path of the failing field and a sentinel cause usable with errors.Is.
+type EncodeError = types.EncodeError
+
+// CacheMismatchError is returned by HashTreeRoot when cache verification is enabled with
+// types.ToggleCacheVerification and a cached root differs from the computed root.
+type CacheMismatchError = types.CacheMismatchError
+
+var (
+	// ErrOffsetOutOfRange is returned when an offset points outside of the input.
+	ErrOffsetOutOfRange = types.ErrOffsetOutOfRange
+	// ErrInvalidOffset is returned when offsets are inconsistent with the layout of a type.
+	ErrInvalidOffset = types.ErrInvalidOffset
+	// ErrListTooLong is returned when a list exceeds the length allowed by its ssz-max tag.
+	ErrListTooLong = types.ErrListTooLong
+	// ErrInvalidBool is returned when a boolean is encoded as anything other than 0 or 1.
+	ErrInvalidBool = types.ErrInvalidBool
+	// ErrShortInput is returned when the input ends before a value is fully decoded.
+	ErrShortInput = types.ErrShortInput
+	// ErrSizeMismatch is returned when the input length does not match the type being decoded.
+	ErrSizeMismatch = types.ErrSizeMismatch
+	// ErrVectorLength is returned when a fixed-size value has the wrong number of elements.
+	ErrVectorLength = types.ErrVectorLength
+	// ErrLimitExceeded is matched by every error caused by exceeding a limit in DecodeOptions.
+	ErrLimitExceeded = types.ErrLimitExceeded
+	// ErrCacheMismatch is matched by every CacheMismatchError.
+	ErrCacheMismatch = types.ErrCacheMismatch
+)
+
+// withTypeName prefixes the field path of a decoding or encoding error with
+// the name of the top-level type, so paths read as BeaconState.Slot.
+func withTypeName(err error, typ reflect.Type) error {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	name := typ.Name()
+	if name == "" {
+		name = typ.String()
+	}
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		decodeErr.Path = types.JoinFieldPath(name, decodeErr.Path)
+	}
+	var encodeErr *EncodeError
+	if errors.As(err, &encodeErr) {
+		encodeErr.Path = types.JoinFieldPath(name, encodeErr.Path)
+	}
+	return err
+}
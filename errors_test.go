@@ -0,0 +1,365 @@
+package ssz
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type errorsValidator struct {
+	Pubkey  []byte `ssz-size:"48"`
+	Slashed bool
+}
+
+type errorsState struct {
+	Slot       uint64
+	Validators []errorsValidator `ssz-max:"4"`
+	Roots      [][]byte          `ssz-size:"?,32"`
+}
+
+func TestUnmarshal_DecodeErrorPath(t *testing.T) {
+	state := &errorsState{
+		Slot: 5,
+		Validators: []errorsValidator{
+			{Pubkey: make([]byte, 48)},
+			{Pubkey: make([]byte, 48), Slashed: true},
+		},
+	}
+	enc, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt the Slashed flag of the second validator, which sits right at the end
+	// of the validators list: 8 bytes of slot, two 4 byte offsets and 49 bytes per validator.
+	corruptOffset := 8 + 4 + 4 + 49 + 48
+	enc[corruptOffset] = 2
+	dec := &errorsState{}
+	err = Unmarshal(enc, dec)
+	if err == nil {
+		t.Fatal("Expected corrupted boolean to fail decoding")
+	}
+	if !errors.Is(err, ErrInvalidBool) {
+		t.Errorf("Expected error to wrap ErrInvalidBool, received %v", err)
+	}
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected a *DecodeError, received %T", err)
+	}
+	if decodeErr.Path != "errorsState.Validators[1].Slashed" {
+		t.Errorf("Unexpected path %q", decodeErr.Path)
+	}
+	if decodeErr.Offset != uint64(corruptOffset) {
+		t.Errorf("Expected offset %d, received %d", corruptOffset, decodeErr.Offset)
+	}
+}
+
+func TestUnmarshal_ListTooLong(t *testing.T) {
+	state := &errorsState{
+		Validators: make([]errorsValidator, 5),
+	}
+	for i := range state.Validators {
+		state.Validators[i].Pubkey = make([]byte, 48)
+	}
+	enc, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Unmarshal(enc, &errorsState{})
+	if !errors.Is(err, ErrListTooLong) {
+		t.Fatalf("Expected ErrListTooLong, received %v", err)
+	}
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected a *DecodeError, received %T", err)
+	}
+	if decodeErr.Path != "errorsState.Validators" || decodeErr.Expected != 4 || decodeErr.Actual != 5 {
+		t.Errorf("Unexpected error details %+v", decodeErr)
+	}
+}
+
+func TestUnmarshal_SizeMismatch(t *testing.T) {
+	var result [4]bool
+	err := Unmarshal([]byte{1, 1, 1, 1, 1}, &result)
+	if !errors.Is(err, ErrSizeMismatch) {
+		t.Fatalf("Expected ErrSizeMismatch, received %v", err)
+	}
+}
+
+func TestMarshal_EncodeErrorPath(t *testing.T) {
+	state := &errorsState{
+		Roots: [][]byte{make([]byte, 32), make([]byte, 31)},
+	}
+	_, err := Marshal(state)
+	if !errors.Is(err, ErrVectorLength) {
+		t.Fatalf("Expected ErrVectorLength, received %v", err)
+	}
+	var encodeErr *EncodeError
+	if !errors.As(err, &encodeErr) {
+		t.Fatalf("Expected an *EncodeError, received %T", err)
+	}
+	if encodeErr.Path != "errorsState.Roots[1]" {
+		t.Errorf("Unexpected path %q", encodeErr.Path)
+	}
+}
+
+// wrappingFlags is a custom type which wraps the structured errors of its encoding,
+// as hand-written encoders built on this package do.
+type wrappingFlags struct {
+	flags [4]bool
+}
+
+func (f *wrappingFlags) IsVariableSSZ() bool  { return false }
+func (f *wrappingFlags) FixedSizeSSZ() uint64 { return 4 }
+func (f *wrappingFlags) SizeSSZ() int         { return 4 }
+
+func (f *wrappingFlags) MarshalSSZTo(dst []byte) ([]byte, error) {
+	// The last flag is reserved and must not be set.
+	if f.flags[3] {
+		return nil, fmt.Errorf("could not encode flags: %w", &EncodeError{Path: "[3]", Err: ErrInvalidBool})
+	}
+	for _, flag := range f.flags {
+		if flag {
+			dst = append(dst, 1)
+		} else {
+			dst = append(dst, 0)
+		}
+	}
+	return dst, nil
+}
+
+func (f *wrappingFlags) UnmarshalSSZ(buf []byte) error {
+	for i, b := range buf {
+		f.flags[i] = b == 1
+	}
+	return nil
+}
+
+func (f *wrappingFlags) HashTreeRootSSZ() ([32]byte, error) {
+	enc, err := f.MarshalSSZTo(nil)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	var root [32]byte
+	copy(root[:], enc)
+	return root, nil
+}
+
+func TestMarshal_WrappedEncodeErrorPath(t *testing.T) {
+	type wrappingState struct {
+		Slot  uint64
+		Flags wrappingFlags
+	}
+	_, err := Marshal(&wrappingState{Flags: wrappingFlags{flags: [4]bool{3: true}}})
+	var encodeErr *EncodeError
+	if !errors.As(err, &encodeErr) {
+		t.Fatalf("Expected an *EncodeError, received %v", err)
+	}
+	if encodeErr.Path != "wrappingState.Flags[3]" {
+		t.Errorf("Unexpected path %q", encodeErr.Path)
+	}
+}
+
+func TestUnmarshalWithOptions_Limits(t *testing.T) {
+	type nested struct {
+		Inner []errorsState `ssz-max:"4"`
+	}
+	state := &errorsState{
+		Validators: make([]errorsValidator, 3),
+		Roots:      [][]byte{make([]byte, 32), make([]byte, 32)},
+	}
+	for i := range state.Validators {
+		state.Validators[i].Pubkey = make([]byte, 48)
+	}
+	enc, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nestedEnc, err := Marshal(&nested{Inner: []errorsState{*state}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		input []byte
+		val   interface{}
+		opts  DecodeOptions
+		limit string
+		path  string
+	}{
+		{
+			name:  "MaxListLength",
+			input: enc,
+			val:   &errorsState{},
+			opts:  DecodeOptions{MaxListLength: 2},
+			limit: "MaxListLength",
+			path:  "errorsState.Validators",
+		},
+		{
+			name:  "MaxAllocation",
+			input: enc,
+			val:   &errorsState{},
+			opts:  DecodeOptions{MaxAllocation: 100},
+			limit: "MaxAllocation",
+			path:  "errorsState.Validators",
+		},
+		{
+			name:  "MaxDepth",
+			input: nestedEnc,
+			val:   &nested{},
+			opts:  DecodeOptions{MaxDepth: 3},
+			limit: "MaxDepth",
+			path:  "nested.Inner[0].Validators",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := UnmarshalWithOptions(tt.input, tt.val, tt.opts)
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("Expected ErrLimitExceeded, received %v", err)
+			}
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("Expected a *LimitError, received %T", err)
+			}
+			if limitErr.Limit != tt.limit {
+				t.Errorf("Expected limit %s, received %s", tt.limit, limitErr.Limit)
+			}
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) {
+				t.Fatalf("Expected a *DecodeError, received %T", err)
+			}
+			if decodeErr.Path != tt.path {
+				t.Errorf("Unexpected path %q", decodeErr.Path)
+			}
+		})
+	}
+	// The same input decodes within generous limits.
+	opts := DecodeOptions{MaxAllocation: 1 << 20, MaxListLength: 16, MaxDepth: 8}
+	dec := &errorsState{}
+	if err := UnmarshalWithOptions(enc, dec, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !DeepEqual(state, dec) {
+		t.Errorf("Expected %v, received %v", state, dec)
+	}
+}
+
+func TestUnmarshal_ListTooLongRejectedBeforeDecoding(t *testing.T) {
+	type limited struct {
+		Values []uint64 `ssz-max:"2"`
+	}
+	enc, err := Marshal(&struct{ Values []uint64 }{Values: make([]uint64, 1024)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A limit on allocation well below the encoded list shows it is never allocated.
+	err = UnmarshalWithOptions(enc, &limited{}, DecodeOptions{MaxAllocation: 64})
+	if !errors.Is(err, ErrListTooLong) {
+		t.Fatalf("Expected ErrListTooLong, received %v", err)
+	}
+}
+
+func TestUnmarshal_NestedListTooLong(t *testing.T) {
+	type nested struct {
+		Slot  uint64
+		Lists [][]uint64 `ssz-max:"4,2"`
+	}
+	enc, err := Marshal(&nested{Lists: [][]uint64{{1}, {2, 3, 4}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Unmarshal(enc, &nested{})
+	if !errors.Is(err, ErrListTooLong) {
+		t.Fatalf("Expected ErrListTooLong, received %v", err)
+	}
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("Expected a *DecodeError, received %T", err)
+	}
+	if decodeErr.Path != "nested.Lists[1]" || decodeErr.Expected != 2 || decodeErr.Actual != 3 {
+		t.Errorf("Unexpected error details %+v", decodeErr)
+	}
+	if _, err := View(enc, reflect.TypeOf(nested{})); !errors.Is(err, ErrListTooLong) {
+		t.Errorf("Expected ErrListTooLong viewing the encoding, received %v", err)
+	}
+	if err := UnmarshalFields(enc, &nested{}, "Lists"); !errors.Is(err, ErrListTooLong) {
+		t.Errorf("Expected ErrListTooLong unmarshaling the field, received %v", err)
+	}
+}
+
+func TestUnmarshal_ListOfTaggedVectorsWithinMax(t *testing.T) {
+	type deposit struct {
+		Proof  [][]byte `ssz-size:"2,32"`
+		Amount uint64
+	}
+	type deposits struct {
+		Deposits []deposit `ssz-max:"2"`
+	}
+	val := &deposits{
+		Deposits: []deposit{
+			{Proof: [][]byte{make([]byte, 32), make([]byte, 32)}, Amount: 1},
+			{Proof: [][]byte{make([]byte, 32), make([]byte, 32)}, Amount: 2},
+		},
+	}
+	enc, err := Marshal(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := &deposits{}
+	if err := Unmarshal(enc, dec); err != nil {
+		t.Fatal(err)
+	}
+	if !DeepEqual(val, dec) {
+		t.Errorf("Expected %v, received %v", val, dec)
+	}
+}
+
+func TestUnmarshalWithOptions_ParallelWorkers(t *testing.T) {
+	type registry struct {
+		Validators []errorsValidator `ssz-max:"4096"`
+	}
+	state := &registry{Validators: make([]errorsValidator, 3000)}
+	for i := range state.Validators {
+		state.Validators[i].Pubkey = make([]byte, 48)
+		state.Validators[i].Pubkey[0] = byte(i)
+		state.Validators[i].Slashed = i%3 == 0
+	}
+	enc, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := DecodeOptions{MaxAllocation: 1 << 20, Workers: 4, MinParallelLength: 16}
+	dec := &registry{}
+	if err := UnmarshalWithOptions(enc, dec, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !DeepEqual(state, dec) {
+		t.Error("Expected list decoded in parallel to equal the original")
+	}
+
+	// Corrupt the Slashed flag of two validators decoded by different workers; the
+	// first one is reported, as when decoding serially.
+	for _, i := range []int{2500, 1200} {
+		enc[4+49*i+48] = 2
+	}
+	serialErr := UnmarshalWithOptions(enc, &registry{}, DecodeOptions{})
+	for i := 0; i < 10; i++ {
+		err := UnmarshalWithOptions(enc, &registry{}, opts)
+		if err == nil || err.Error() != serialErr.Error() {
+			t.Fatalf("Expected error %v, received %v", serialErr, err)
+		}
+	}
+	var decodeErr *DecodeError
+	if !errors.As(serialErr, &decodeErr) || decodeErr.Path != "registry.Validators[1200].Slashed" {
+		t.Errorf("Unexpected error %v", serialErr)
+	}
+
+	// Lists which would exceed the allocation limit report it as serial decoding does.
+	enc[4+49*1200+48] = 0
+	enc[4+49*2500+48] = 0
+	limited := DecodeOptions{MaxAllocation: 1000, Workers: 4, MinParallelLength: 16}
+	if err := UnmarshalWithOptions(enc, &registry{}, limited); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded, received %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package ssz
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// generatedCheckpoint implements the methods fastssz generates by hand, counting how
+// often each of them is called.
+type generatedCheckpoint struct {
+	Epoch uint64
+	Root  [32]byte
+}
+
+var generatedCalls struct {
+	marshal, unmarshal, root int64
+}
+
+func (c *generatedCheckpoint) SizeSSZ() int {
+	return 40
+}
+
+func (c *generatedCheckpoint) MarshalSSZ() ([]byte, error) {
+	return c.MarshalSSZTo(make([]byte, 0, c.SizeSSZ()))
+}
+
+func (c *generatedCheckpoint) MarshalSSZTo(dst []byte) ([]byte, error) {
+	atomic.AddInt64(&generatedCalls.marshal, 1)
+	var epoch [8]byte
+	binary.LittleEndian.PutUint64(epoch[:], c.Epoch)
+	dst = append(dst, epoch[:]...)
+	return append(dst, c.Root[:]...), nil
+}
+
+func (c *generatedCheckpoint) UnmarshalSSZ(buf []byte) error {
+	atomic.AddInt64(&generatedCalls.unmarshal, 1)
+	if len(buf) != c.SizeSSZ() {
+		return errors.New("incorrect size")
+	}
+	c.Epoch = binary.LittleEndian.Uint64(buf[:8])
+	copy(c.Root[:], buf[8:])
+	return nil
+}
+
+func (c *generatedCheckpoint) HashTreeRoot() ([32]byte, error) {
+	atomic.AddInt64(&generatedCalls.root, 1)
+	var chunks [64]byte
+	binary.LittleEndian.PutUint64(chunks[:8], c.Epoch)
+	copy(chunks[32:], c.Root[:])
+	return sha256.Sum256(chunks[:]), nil
+}
+
+type reflectedCheckpoint struct {
+	Epoch uint64
+	Root  [32]byte
+}
+
+type generatedHolder struct {
+	Slot        uint64
+	Current     *generatedCheckpoint
+	Finalized   generatedCheckpoint
+	History     []*generatedCheckpoint `ssz-max:"16"`
+	Justified   [2]generatedCheckpoint
+	Attestation []byte `ssz-max:"64"`
+}
+
+type reflectedHolder struct {
+	Slot        uint64
+	Current     *reflectedCheckpoint
+	Finalized   reflectedCheckpoint
+	History     []*reflectedCheckpoint `ssz-max:"16"`
+	Justified   [2]reflectedCheckpoint
+	Attestation []byte `ssz-max:"64"`
+}
+
+func TestFastSSZ_DelegatesNestedValues(t *testing.T) {
+	generated := &generatedHolder{
+		Slot:        5,
+		Current:     &generatedCheckpoint{Epoch: 3, Root: [32]byte{1}},
+		Finalized:   generatedCheckpoint{Epoch: 1, Root: [32]byte{2}},
+		History:     []*generatedCheckpoint{{Epoch: 0}, {Epoch: 1, Root: [32]byte{3}}},
+		Justified:   [2]generatedCheckpoint{{Epoch: 2, Root: [32]byte{4}}, {Epoch: 3}},
+		Attestation: []byte{1, 2, 3},
+	}
+	reflected := &reflectedHolder{
+		Slot:        5,
+		Current:     &reflectedCheckpoint{Epoch: 3, Root: [32]byte{1}},
+		Finalized:   reflectedCheckpoint{Epoch: 1, Root: [32]byte{2}},
+		History:     []*reflectedCheckpoint{{Epoch: 0}, {Epoch: 1, Root: [32]byte{3}}},
+		Justified:   [2]reflectedCheckpoint{{Epoch: 2, Root: [32]byte{4}}, {Epoch: 3}},
+		Attestation: []byte{1, 2, 3},
+	}
+	want, err := Marshal(reflected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt64(&generatedCalls.marshal, 0)
+	enc, err := Marshal(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(enc, want) {
+		t.Errorf("Marshal() = %#x, want %#x", enc, want)
+	}
+	// One call for each checkpoint, Current, Finalized, History and Justified.
+	if calls := atomic.LoadInt64(&generatedCalls.marshal); calls != 6 {
+		t.Errorf("MarshalSSZTo called %d times, want 6", calls)
+	}
+
+	atomic.StoreInt64(&generatedCalls.unmarshal, 0)
+	decoded := &generatedHolder{}
+	if err := Unmarshal(enc, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !DeepEqual(decoded, generated) {
+		t.Errorf("Unmarshal() = %+v, want %+v", decoded, generated)
+	}
+	if calls := atomic.LoadInt64(&generatedCalls.unmarshal); calls != 6 {
+		t.Errorf("UnmarshalSSZ called %d times, want 6", calls)
+	}
+
+	wantRoot, err := HashTreeRoot(reflected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt64(&generatedCalls.root, 0)
+	root, err := HashTreeRoot(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != wantRoot {
+		t.Errorf("HashTreeRoot() = %#x, want %#x", root, wantRoot)
+	}
+	if calls := atomic.LoadInt64(&generatedCalls.root); calls != 6 {
+		t.Errorf("HashTreeRoot called %d times, want 6", calls)
+	}
+}
+
+func TestFastSSZ_NilPointersUseReflection(t *testing.T) {
+	generated := &generatedHolder{History: []*generatedCheckpoint{}}
+	reflected := &reflectedHolder{History: []*reflectedCheckpoint{}}
+	want, err := Marshal(reflected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := Marshal(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(enc, want) {
+		t.Errorf("Marshal() = %#x, want %#x", enc, want)
+	}
+	wantRoot, err := HashTreeRoot(reflected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := HashTreeRoot(generated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != wantRoot {
+		t.Errorf("HashTreeRoot() = %#x, want %#x", root, wantRoot)
+	}
+}
+
+func TestFastSSZ_ShortInput(t *testing.T) {
+	enc, err := Marshal(&generatedHolder{Current: &generatedCheckpoint{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &generatedHolder{}
+	if err := Unmarshal(enc[:20], decoded); err == nil {
+		t.Error("Expected error unmarshaling truncated input")
+	}
+}
@@ -0,0 +1,26 @@
+package ssz
+
+import (
+	"sync"
+
+	"github.com/prysmaticlabs/go-ssz/types"
+)
+
+// HashState holds the scratch space hash tree roots are computed with, a stack of the
+// chunks of the values being merkleized. Reusing a HashState, or pooling them, lets
+// roots of values of similar sizes be computed without allocating once its stack has
+// grown, apart from the caches enabled with types.ConfigureCache. A HashState must not
+// be used by several goroutines at once.
+type HashState = types.HashState
+
+// NewHashState returns a HashState for computing roots with HashTreeRootWith.
+func NewHashState() *HashState {
+	return types.NewHashState()
+}
+
+// hashStatePool holds the HashStates roots are computed with by HashTreeRoot.
+var hashStatePool = sync.Pool{
+	New: func() interface{} {
+		return NewHashState()
+	},
+}
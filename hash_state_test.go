@@ -0,0 +1,126 @@
+package ssz
+
+import (
+	"bytes"
+	"testing"
+)
+
+type hasherCheckpoint struct {
+	Epoch uint64
+	Root  []byte `ssz-size:"32"`
+}
+
+type hasherValidator struct {
+	Pubkey  []byte `ssz-size:"48"`
+	Balance uint64
+	Slashed bool
+}
+
+type hasherState struct {
+	Slot        uint64
+	Roots       [][]byte            `ssz-size:"64,32"`
+	Balances    []uint64            `ssz-max:"1024"`
+	Validators  []hasherValidator   `ssz-max:"1024"`
+	Checkpoints []*hasherCheckpoint `ssz-max:"16"`
+	Graffiti    []byte              `ssz-max:"32"`
+	Signature   [96]byte
+	Name        string
+	Justified   [4]hasherCheckpoint
+}
+
+func newHasherState() *hasherState {
+	state := &hasherState{
+		Slot:        12345,
+		Roots:       make([][]byte, 64),
+		Balances:    make([]uint64, 100),
+		Validators:  make([]hasherValidator, 10),
+		Checkpoints: []*hasherCheckpoint{{Epoch: 3, Root: make([]byte, 32)}},
+		Graffiti:    []byte("graffiti"),
+		Name:        "state",
+	}
+	for i := range state.Roots {
+		state.Roots[i] = make([]byte, 32)
+		state.Roots[i][0] = byte(i)
+	}
+	for i := range state.Validators {
+		state.Validators[i].Pubkey = make([]byte, 48)
+		state.Validators[i].Balance = 32000000000 + uint64(i)
+	}
+	for i := range state.Justified {
+		state.Justified[i].Root = make([]byte, 32)
+	}
+	return state
+}
+
+func TestHashTreeRootWith(t *testing.T) {
+	type accountBalances struct {
+		Balances []uint64 `ssz-max:"1099511627776"`
+	}
+	balances := &accountBalances{Balances: make([]uint64, 512)}
+	for i := range balances.Balances {
+		balances.Balances[i] = 32000000000
+	}
+	type votes struct {
+		Votes [][]uint64 `ssz-max:"4,8"`
+	}
+	tooLong := newHasherState()
+	tooLong.Balances = make([]uint64, 1025)
+	// The roots of the state, the checkpoint and the list were computed before roots
+	// were computed with a HashState, and the root of the balances is that of the validator
+	// balances of the state value in:
+	// https://github.com/ethereum/eth2.0-spec-tests/blob/v0.8.0/tests/sanity/slots/sanity_slots_mainnet.yaml.
+	// The root of the votes merkleizes each list by hand with its own limit, as the
+	// specification does.
+	tests := []struct {
+		name  string
+		value interface{}
+		root  string
+	}{
+		{name: "state", value: newHasherState(), root: "ec54d6e1bc2e353b6dbe0647cb59582008057149aa79e8fc522efcb6f9bb21f7"},
+		{name: "list over its limit", value: tooLong},
+		{name: "checkpoint", value: &hasherCheckpoint{Epoch: 1, Root: make([]byte, 32)}, root: "16abab341fb7f370e27e4dadcf81766dd0dfd0ae64469477bb2cf6614938b2af"},
+		{name: "basic list", value: []uint64{1, 2, 3}, root: "ed114baf42aac42d5c115ed017862e26138544d8e8fbd9b58466da9dfa0b2f55"},
+		{name: "balances", value: balances, root: "21a67313b0c6f988aac4fb6dd68686e1329243f7f6af21b722f6b83ca8fed9a8"},
+		{name: "nested lists", value: &votes{Votes: [][]uint64{{1, 2}, {3}}}, root: "b9880a8be68bd9ca991459b10e47d00ae0e644e6566afed5efe2c3eca84e61fb"},
+		{name: "state again", value: newHasherState(), root: "ec54d6e1bc2e353b6dbe0647cb59582008057149aa79e8fc522efcb6f9bb21f7"},
+	}
+	// A single HashState is reused across values of different types, including after
+	// a computation which failed part way through.
+	h := NewHashState()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := HashTreeRootWith(h, tt.value)
+			if tt.root == "" {
+				if err == nil {
+					t.Error("Expected error computing root")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := hexDecodeOrDie(t, tt.root); !bytes.Equal(root[:], want) {
+				t.Errorf("Expected root %#x, received %#x", want, root)
+			}
+		})
+	}
+}
+
+func TestHashTreeRootWith_NoAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("The race detector allocates")
+	}
+	state := newHasherState()
+	h := NewHashState()
+	if _, err := HashTreeRootWith(h, state); err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, err := HashTreeRootWith(h, state); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations once the hash state is warm, received %v", allocs)
+	}
+}
@@ -0,0 +1,31 @@
+package ssz
+
+import (
+	"github.com/prysmaticlabs/go-ssz/types"
+)
+
+// Hasher is the hash function nodes of Merkle trees are computed with when determining
+// hash tree roots, which can be replaced with SetHasher.
+type Hasher = types.Hasher
+
+// BatchHasher is a Hasher which hashes whole layers of Merkle trees at once.
+type BatchHasher = types.BatchHasher
+
+// SHA256Hasher hashes with SHA-256, as specified by Simple Serialize. It is the hasher
+// used by default.
+var SHA256Hasher = types.SHA256Hasher
+
+// SetHasher configures the hash function of hash tree roots, such as a batched or
+// hardware-specific SHA-256 implementation. A nil hasher restores SHA256Hasher. Roots
+// computed while the hasher is being changed may be computed with either one.
+//
+//  ssz.SetHasher(sha256Avx512{})
+//  defer ssz.SetHasher(nil)
+func SetHasher(h Hasher) {
+	types.SetHasher(h)
+}
+
+// CurrentHasher returns the hash function hash tree roots are computed with.
+func CurrentHasher() Hasher {
+	return types.CurrentHasher()
+}
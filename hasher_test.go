@@ -0,0 +1,97 @@
+package ssz
+
+import (
+	"crypto/sha512"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// countingHasher hashes with the first 32 bytes of SHA-512, counting the nodes it hashes.
+type countingHasher struct {
+	count uint64
+}
+
+func (h *countingHasher) Hash(data []byte) [32]byte {
+	atomic.AddUint64(&h.count, 1)
+	var out [32]byte
+	sum := sha512.Sum512(data)
+	copy(out[:], sum[:])
+	return out
+}
+
+// sha256NodeHasher hashes with SHA-256 node by node.
+type sha256NodeHasher struct{}
+
+func (sha256NodeHasher) Hash(data []byte) [32]byte {
+	return SHA256Hasher.Hash(data)
+}
+
+func TestSetHasher(t *testing.T) {
+	val := newHasherState()
+	want, err := HashTreeRoot(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &countingHasher{}
+	SetHasher(h)
+	defer SetHasher(nil)
+	if CurrentHasher() != h {
+		t.Fatal("Expected configured hasher to be current")
+	}
+	root, err := HashTreeRoot(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if atomic.LoadUint64(&h.count) == 0 {
+		t.Error("Expected root to be computed with the configured hasher")
+	}
+	if root == want {
+		t.Error("Expected root computed with another hash function to differ")
+	}
+	SetHasher(nil)
+	if CurrentHasher() != SHA256Hasher {
+		t.Error("Expected SHA256Hasher to be restored")
+	}
+	if root, err := HashTreeRoot(val); err != nil || root != want {
+		t.Errorf("Expected SHA-256 root %#x after restoring the default hasher, received %#x, %v", want, root, err)
+	}
+}
+
+func TestSetHasher_WhileComputingRoots(t *testing.T) {
+	val := newHasherState()
+	want, err := HashTreeRoot(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetHasher(nil)
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// Both hashers compute SHA-256, so roots are the same whichever is used.
+				if root, err := HashTreeRoot(val); err != nil || root != want {
+					t.Errorf("Expected root %#x, received %#x, %v", want, root, err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			SetHasher(sha256NodeHasher{})
+		} else {
+			SetHasher(SHA256Hasher)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
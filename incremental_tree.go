@@ -0,0 +1,49 @@
+package ssz
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/go-ssz/types"
+)
+
+// IncrementalTree is an append-only Merkle tree of a fixed depth, such as the deposit
+// contract tree, which can prove any leaf which has not been finalized.
+type IncrementalTree = types.IncrementalTree
+
+// TreeSnapshot is the state from which an IncrementalTree can be restored.
+type TreeSnapshot = types.TreeSnapshot
+
+// NewIncrementalTree returns an empty append-only tree holding at most 2^depth leaves.
+// Its root is the one of HashTreeRootWithCapacity on the list of its leaves, as 32 byte
+// arrays, with a capacity of 2^depth.
+//
+//  tree, err := NewIncrementalTree(32)
+//  if err != nil {
+//      return err
+//  }
+//  for _, deposit := range deposits {
+//      leaf, err := HashTreeRoot(deposit.Data)
+//      if err != nil {
+//          return err
+//      }
+//      if err := tree.Append(leaf); err != nil {
+//          return err
+//      }
+//  }
+//  proof, err := tree.Proof(index)
+func NewIncrementalTree(depth uint64) (*IncrementalTree, error) {
+	t, err := types.NewIncrementalTree(depth)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create incremental tree")
+	}
+	return t, nil
+}
+
+// RestoreIncrementalTree returns a tree restored from a snapshot taken with its Snapshot
+// method. Leaves appended before the snapshot are finalized in the restored tree.
+func RestoreIncrementalTree(snapshot TreeSnapshot) (*IncrementalTree, error) {
+	t, err := types.RestoreIncrementalTree(snapshot)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not restore incremental tree")
+	}
+	return t, nil
+}
@@ -0,0 +1,159 @@
+package ssz
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func treeLeaves(n int) [][32]byte {
+	leaves := make([][32]byte, n)
+	for i := range leaves {
+		leaves[i] = sha256.Sum256([]byte{byte(i), byte(i >> 8)})
+	}
+	return leaves
+}
+
+// verifyTreeProof checks a Merkle branch of a leaf against a root, from the leaf up.
+func verifyTreeProof(root [32]byte, leaf [32]byte, index uint64, proof [][32]byte) bool {
+	node := leaf
+	for i, sibling := range proof {
+		if index>>uint(i)&1 == 1 {
+			node = sha256.Sum256(append(sibling[:], node[:]...))
+		} else {
+			node = sha256.Sum256(append(node[:], sibling[:]...))
+		}
+	}
+	return node == root
+}
+
+func TestIncrementalTree(t *testing.T) {
+	for _, depth := range []uint64{0, 1, 4, 32} {
+		tree, err := NewIncrementalTree(depth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves := treeLeaves(16)
+		if depth < 4 {
+			leaves = leaves[:1<<depth]
+		}
+		for n := 0; n <= len(leaves); n++ {
+			want, err := HashTreeRootWithCapacity(leaves[:n], 1<<depth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tree.Root(); got != want {
+				t.Errorf("Depth %d with %d leaves: expected root %#x, received %#x", depth, n, want, got)
+			}
+			for i := 0; i < n; i++ {
+				proof, err := tree.Proof(uint64(i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !verifyTreeProof(want, leaves[i], uint64(i), proof) {
+					t.Errorf("Depth %d with %d leaves: invalid proof of leaf %d", depth, n, i)
+				}
+			}
+			if n < len(leaves) {
+				if err := tree.Append(leaves[n]); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if depth < 4 {
+			if err := tree.Append([32]byte{}); err == nil {
+				t.Errorf("Depth %d: expected error appending to a full tree", depth)
+			}
+		}
+	}
+}
+
+func TestIncrementalTree_Finalize(t *testing.T) {
+	leaves := treeLeaves(20)
+	tree, err := NewIncrementalTree(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaf := range leaves[:13] {
+		if err := tree.Append(leaf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tree.Finalize(11); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tree.Proof(5); err == nil {
+		t.Error("Expected error proving a finalized leaf")
+	}
+	for _, leaf := range leaves[13:] {
+		if err := tree.Append(leaf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := HashTreeRootWithCapacity(leaves, 1<<5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree.Root(); got != want {
+		t.Errorf("Expected root %#x, received %#x", want, got)
+	}
+	for i := 11; i < len(leaves); i++ {
+		proof, err := tree.Proof(uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !verifyTreeProof(want, leaves[i], uint64(i), proof) {
+			t.Errorf("Invalid proof of leaf %d", i)
+		}
+	}
+	restored, err := RestoreIncrementalTree(tree.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Root() != want {
+		t.Error("Tree restored after finalization has a different root")
+	}
+	if err := tree.Finalize(21); err == nil {
+		t.Error("Expected error finalizing leaves which were not appended")
+	}
+}
+
+func TestRestoreIncrementalTree(t *testing.T) {
+	leaves := treeLeaves(16)
+	for n := 0; n <= len(leaves); n++ {
+		tree, err := NewIncrementalTree(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, leaf := range leaves[:n] {
+			if err := tree.Append(leaf); err != nil {
+				t.Fatal(err)
+			}
+		}
+		restored, err := RestoreIncrementalTree(tree.Snapshot())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.Root() != tree.Root() {
+			t.Errorf("Restored tree of %d leaves has a different root", n)
+		}
+		for i, leaf := range leaves[n:] {
+			if err := restored.Append(leaf); err != nil {
+				t.Fatal(err)
+			}
+			proof, err := restored.Proof(uint64(n + i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !verifyTreeProof(restored.Root(), leaf, uint64(n+i), proof) {
+				t.Errorf("Restored tree of %d leaves: invalid proof of leaf %d", n, n+i)
+			}
+		}
+		want, err := HashTreeRootWithCapacity(leaves, 1<<4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := restored.Root(); got != want {
+			t.Errorf("Restored tree of %d leaves: expected root %#x, received %#x", n, want, got)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package ssz
+
+import (
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/go-ssz/types"
+)
+
+// Lazy gives access to an SSZ encoded value stored outside of memory, such as in a
+// file. Only the offsets of the value are read when it is opened, while fields and list
+// elements are read on demand and roots are computed by streaming over the input.
+type Lazy = types.Lazy
+
+// LazyIterator pages in the elements of a lazily accessed list one at a time.
+type LazyIterator = types.LazyIterator
+
+// NewLazy returns lazy access to the SSZ encoding of a value of type typ, stored in the
+// first size bytes of r.
+//
+//  state, err := NewLazy(reader, size, reflect.TypeOf(BeaconState{}))
+//  if err != nil {
+//      return err
+//  }
+//  validators, err := state.Field("Validators")
+//  if err != nil {
+//      return err
+//  }
+//  it := validators.Iterate()
+//  for it.Next() {
+//      var validator Validator
+//      if err := it.Value().Decode(&validator); err != nil {
+//          return err
+//      }
+//  }
+func NewLazy(r io.ReaderAt, size int64, typ reflect.Type) (*Lazy, error) {
+	if typ == nil {
+		return nil, errors.New("cannot decode untyped, nil value")
+	}
+	if size < 0 {
+		return nil, errors.New("size cannot be negative")
+	}
+	l, err := types.NewLazy(r, uint64(size), typ)
+	if err != nil {
+		return nil, errors.Wrapf(withTypeName(err, typ), "invalid encoding of type: %v", typ)
+	}
+	return l, nil
+}
+
+// LazyFile is lazy access to a value encoded in a file, which must be closed once
+// the value is no longer used.
+type LazyFile struct {
+	*Lazy
+	file *os.File
+}
+
+// OpenFile opens the file at path, holding the SSZ encoding of a value of type typ,
+// for lazy access.
+func OpenFile(path string, typ reflect.Type) (*LazyFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	l, err := NewLazy(file, info.Size(), typ)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &LazyFile{Lazy: l, file: file}, nil
+}
+
+// Close closes the underlying file.
+func (f *LazyFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,176 @@
+package ssz
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type lazyState struct {
+	Slot       uint64
+	Flags      []bool              `ssz-max:"1024"`
+	Validators []*partialValidator `ssz-max:"4096"`
+	Roots      [][]byte            `ssz-size:"4096,32"`
+	Balances   []uint64            `ssz-max:"65536"`
+	Names      []string            `ssz-max:"16"`
+}
+
+// newLazyState returns a state whose lists are larger than what is read at once,
+// so that their roots are streamed.
+func newLazyState() *lazyState {
+	state := &lazyState{
+		Slot:     7,
+		Flags:    []bool{true, false, true},
+		Roots:    make([][]byte, 4096),
+		Balances: make([]uint64, 20000),
+		Names:    []string{"a", "bc"},
+	}
+	for i := range state.Roots {
+		state.Roots[i] = make([]byte, 32)
+		state.Roots[i][0] = byte(i)
+	}
+	for i := range state.Balances {
+		state.Balances[i] = uint64(i)
+	}
+	for i := 0; i < 3000; i++ {
+		state.Validators = append(state.Validators, &partialValidator{
+			PublicKey:             bytes.Repeat([]byte{byte(i)}, 48),
+			WithdrawalCredentials: []byte{byte(i >> 8), byte(i)},
+		})
+	}
+	return state
+}
+
+func TestNewLazy(t *testing.T) {
+	state := newLazyState()
+	enc, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewLazy(bytes.NewReader(enc), int64(len(enc)), reflect.TypeOf(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := HashTreeRoot(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := l.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != got {
+		t.Errorf("Expected root %#x, received %#x", want, got)
+	}
+
+	validators, err := l.Field("Validators")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validators.Len() != uint64(len(state.Validators)) {
+		t.Errorf("Expected %d validators, received %d", len(state.Validators), validators.Len())
+	}
+	it := validators.Iterate()
+	count := 0
+	for it.Next() {
+		var validator partialValidator
+		if err := it.Value().Decode(&validator); err != nil {
+			t.Fatal(err)
+		}
+		if !DeepEqual(&validator, state.Validators[count]) {
+			t.Fatalf("Expected validator %v, received %v", state.Validators[count], validator)
+		}
+		count++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if count != len(state.Validators) {
+		t.Errorf("Expected to iterate over %d validators, received %d", len(state.Validators), count)
+	}
+
+	balances, err := l.Field("Balances")
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance, err := balances.Index(12345)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value uint64
+	if err := balance.Decode(&value); err != nil {
+		t.Fatal(err)
+	}
+	if value != 12345 {
+		t.Errorf("Expected balance 12345, received %d", value)
+	}
+}
+
+func TestNewLazy_InvalidOffsets(t *testing.T) {
+	state := newLazyState()
+	enc, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The offset of the validators list follows the slot and the offset of the flags.
+	enc[8+4+3] = 0xff
+	if _, err := NewLazy(bytes.NewReader(enc), int64(len(enc)), reflect.TypeOf(state)); !errors.Is(err, ErrOffsetOutOfRange) {
+		t.Errorf("Expected ErrOffsetOutOfRange, received %v", err)
+	}
+	// A reader holding less than the given size fails on the first read beyond it.
+	if _, err := NewLazy(bytes.NewReader(enc[:10]), int64(len(enc)), reflect.TypeOf(state)); !errors.Is(err, ErrShortInput) {
+		t.Errorf("Expected ErrShortInput, received %v", err)
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	state := newLazyState()
+	enc, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "ssz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.ssz")
+	if err := ioutil.WriteFile(path, enc, 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenFile(path, reflect.TypeOf(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	roots, err := f.Field("Roots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := HashTreeRootFromBytes(enc, reflect.TypeOf(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != got {
+		t.Errorf("Expected root %#x, received %#x", want, got)
+	}
+	root, err := roots.Index(300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := root.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, state.Roots[300]) {
+		t.Errorf("Expected root %#x, received %#x", state.Roots[300], data)
+	}
+}
@@ -0,0 +1,37 @@
+package ssz
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/go-ssz/types"
+)
+
+// ListHasher computes the root of a list one element at a time, in memory logarithmic
+// in the number of elements.
+type ListHasher = types.ListHasher
+
+// NewListHasher returns a hasher of a list of elements of type elemType, holding at most
+// limit elements. Its root is the same as the one of HashTreeRootWithCapacity on a slice
+// of the appended elements with limit as the capacity, without the slice ever being built.
+//
+//  h, err := NewListHasher(reflect.TypeOf(Validator{}), 1<<40)
+//  if err != nil {
+//      return err
+//  }
+//  for it.Next() {
+//      if err := h.Append(it.Validator()); err != nil {
+//          return err
+//      }
+//  }
+//  root, err := h.Root()
+func NewListHasher(elemType reflect.Type, limit uint64) (*ListHasher, error) {
+	if elemType == nil {
+		return nil, errors.New("cannot hash list of untyped, nil elements")
+	}
+	h, err := types.NewListHasher(elemType, limit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not generate tree hasher for type: %v", elemType)
+	}
+	return h, nil
+}
@@ -0,0 +1,103 @@
+package ssz
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestListHasher(t *testing.T) {
+	state := newLazyState()
+	tests := []struct {
+		name  string
+		elems interface{}
+		limit uint64
+	}{
+		{name: "basic elements", elems: state.Balances, limit: 65536},
+		{name: "basic elements without limit", elems: state.Balances[:100], limit: 0},
+		{name: "partial chunk", elems: []uint16{1, 2, 3}, limit: 100},
+		{name: "no basic elements", elems: []uint64{}, limit: 0},
+		{name: "composite elements", elems: state.Validators, limit: 4096},
+		{name: "composite elements without limit", elems: state.Validators[:5], limit: 0},
+		{name: "no composite elements", elems: []*partialValidator{}, limit: 0},
+		{name: "no composite elements with limit", elems: []*partialValidator{}, limit: 16},
+		{name: "fixed-size elements", elems: []fork{{Epoch: 1}, {Epoch: 2}}, limit: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			elems := reflect.ValueOf(tt.elems)
+			h, err := NewListHasher(elems.Type().Elem(), tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < elems.Len(); i++ {
+				if err := h.Append(elems.Index(i).Interface()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := HashTreeRootWithCapacity(tt.elems, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := h.Root()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want != got {
+				t.Errorf("Expected root %#x, received %#x", want, got)
+			}
+		})
+	}
+}
+
+func TestListHasher_AppendRoot(t *testing.T) {
+	validators := newLazyState().Validators[:10]
+	h, err := NewListHasher(reflect.TypeOf(&partialValidator{}), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range validators {
+		// Roots can be computed ahead of time and mixed with appended elements.
+		if i%2 == 0 {
+			if err := h.Append(v); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		r, err := HashTreeRoot(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.AppendRoot(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := HashTreeRootWithCapacity(validators, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := h.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != got {
+		t.Errorf("Expected root %#x, received %#x", want, got)
+	}
+	// Fill the list up to its limit.
+	for i := len(validators); i < 16; i++ {
+		if err := h.AppendRoot([32]byte{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := h.AppendRoot([32]byte{}); !errors.Is(err, ErrListTooLong) {
+		t.Errorf("Expected ErrListTooLong, received %v", err)
+	}
+
+	basic, err := NewListHasher(reflect.TypeOf(uint64(0)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := basic.AppendRoot([32]byte{}); err == nil {
+		t.Error("Expected error appending root to list of basic elements")
+	}
+}
@@ -0,0 +1,7 @@
+//go:build race
+// +build race
+
+package ssz
+
+// raceEnabled is set when tests run with the race detector, which allocates on its own.
+const raceEnabled = true
@@ -1,11 +1,13 @@
 package spectests
 
 import (
+	"bytes"
 	"io/ioutil"
 	"testing"
 
 	"github.com/ghodss/yaml"
 	"github.com/prysmaticlabs/go-ssz"
+	"github.com/prysmaticlabs/go-ssz/types"
 )
 
 type SszBenchmarkState struct {
@@ -103,6 +105,120 @@ func BenchmarkBeaconState_HashTreeRoot(b *testing.B) {
 	}
 }
 
+func BenchmarkMainnetBeaconState_HashTreeRoot(b *testing.B) {
+	state := newMainnetBeaconState(16384)
+	hashers := []struct {
+		name   string
+		hasher types.Hasher
+	}{
+		{name: "batched layers", hasher: types.SHA256Hasher},
+		{name: "node by node", hasher: nodeHasher{}},
+		{name: "append per node", hasher: appendHasher{}},
+	}
+	for _, h := range hashers {
+		b.Run(h.name, func(b *testing.B) {
+			types.SetHasher(h.hasher)
+			defer types.SetHasher(nil)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, err := ssz.HashTreeRoot(state); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAttestationData_HashTreeRootBatch(b *testing.B) {
+	values := make([]interface{}, 512)
+	for i := range values {
+		values[i] = &minimalAttestationData{
+			Slot:            uint64(i),
+			Index:           uint64(i % 64),
+			BeaconBlockRoot: bytes.Repeat([]byte{byte(i)}, 32),
+			Source:          minimalCheckpoint{Epoch: uint64(i / 32), Root: make([]byte, 32)},
+			Target:          minimalCheckpoint{Epoch: uint64(i/32 + 1), Root: make([]byte, 32)},
+		}
+	}
+	b.Run("loop", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			for _, val := range values {
+				if _, err := ssz.HashTreeRoot(val); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			if _, err := ssz.HashTreeRootBatch(values); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("reused hash state", func(b *testing.B) {
+		h := ssz.NewHashState()
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			for _, val := range values {
+				if _, err := ssz.HashTreeRootWith(h, val); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+// nodeHasher hashes with SHA-256 without implementing types.BatchHasher, so that
+// layers of Merkle trees are hashed node by node.
+type nodeHasher struct{}
+
+func (nodeHasher) Hash(data []byte) [32]byte {
+	return types.SHA256Hasher.Hash(data)
+}
+
+// appendHasher hashes a copy of its input allocated for each node, the cost of the
+// merkleization which hashed every node as hash(append(left, right...)).
+type appendHasher struct{}
+
+func (appendHasher) Hash(data []byte) [32]byte {
+	return types.SHA256Hasher.Hash(append(data[:len(data):len(data)], 0)[:len(data)])
+}
+
+// newMainnetBeaconState returns a state with the given number of validators, and every
+// root of its historical vectors set.
+func newMainnetBeaconState(validators int) *mainnetBeaconState {
+	state := &mainnetBeaconState{
+		BlockRoots:  make([][]byte, 8192),
+		StateRoots:  make([][]byte, 8192),
+		RandaoMixes: make([][]byte, 65536),
+		Slashings:   make([]uint64, 8192),
+		Validators:  make([]mainnetValidator, validators),
+		Balances:    make([]uint64, validators),
+	}
+	for i := range state.BlockRoots {
+		state.BlockRoots[i] = bytes.Repeat([]byte{byte(i)}, 32)
+		state.StateRoots[i] = bytes.Repeat([]byte{byte(i + 1)}, 32)
+	}
+	for i := range state.RandaoMixes {
+		state.RandaoMixes[i] = bytes.Repeat([]byte{byte(i + 2)}, 32)
+	}
+	for i := range state.Validators {
+		state.Validators[i] = mainnetValidator{
+			Pubkey:                bytes.Repeat([]byte{byte(i)}, 48),
+			WithdrawalCredentials: bytes.Repeat([]byte{byte(i + 1)}, 32),
+			EffectiveBalance:      32000000000,
+			ExitEpoch:             ^uint64(0),
+			WithdrawableEpoch:     ^uint64(0),
+		}
+		state.Balances[i] = 32000000000
+	}
+	return state
+}
+
 func populateStructFromYaml(t testing.TB, fPath string, val interface{}) {
 	yamlFile, err := ioutil.ReadFile(fPath)
 	if err != nil {
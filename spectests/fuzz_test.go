@@ -0,0 +1,96 @@
+package spectests
+
+import (
+	"testing"
+
+	"github.com/prysmaticlabs/go-ssz"
+)
+
+const maxFuzzSeedSize = 1 << 16
+
+// fuzzTargets instantiates every type defined by the spec tests, so that each
+// of their layouts is exercised by the decoder when fuzzing.
+var fuzzTargets = []func() interface{}{
+	func() interface{} { return &singleFieldStruct{} },
+	func() interface{} { return &smallTestStruct{} },
+	func() interface{} { return &fixedTestStruct{} },
+	func() interface{} { return &varTestStruct{} },
+	func() interface{} { return &complexTestStruct{} },
+	func() interface{} { return &minimalFork{} },
+	func() interface{} { return &minimalCheckpoint{} },
+	func() interface{} { return &minimalValidator{} },
+	func() interface{} { return &minimalAttestationData{} },
+	func() interface{} { return &minimalAttestationAndCustodyBit{} },
+	func() interface{} { return &minimalIndexedAttestation{} },
+	func() interface{} { return &minimalPendingAttestation{} },
+	func() interface{} { return &minimalEth1Data{} },
+	func() interface{} { return &minimalHistoricalBatch{} },
+	func() interface{} { return &minimalDepositData{} },
+	func() interface{} { return &minimalBlockHeader{} },
+	func() interface{} { return &minimalProposerSlashing{} },
+	func() interface{} { return &minimalAttesterSlashing{} },
+	func() interface{} { return &minimalAttestation{} },
+	func() interface{} { return &minimalDeposit{} },
+	func() interface{} { return &minimalVoluntaryExit{} },
+	func() interface{} { return &minimalBlockBody{} },
+	func() interface{} { return &minimalBlock{} },
+	func() interface{} { return &minimalAggregateAndProof{} },
+	func() interface{} { return &minimalBeaconState{} },
+	func() interface{} { return &mainnetFork{} },
+	func() interface{} { return &mainnetCheckpoint{} },
+	func() interface{} { return &mainnetValidator{} },
+	func() interface{} { return &mainnetAttestationData{} },
+	func() interface{} { return &mainnetAttestationAndCustodyBit{} },
+	func() interface{} { return &mainnetIndexedAttestation{} },
+	func() interface{} { return &mainnetPendingAttestation{} },
+	func() interface{} { return &mainnetEth1Data{} },
+	func() interface{} { return &mainnetHistoricalBatch{} },
+	func() interface{} { return &mainnetDepositData{} },
+	func() interface{} { return &MainnetBlockHeader{} },
+	func() interface{} { return &mainnetProposerSlashing{} },
+	func() interface{} { return &mainnetAttesterSlashing{} },
+	func() interface{} { return &mainnetAttestation{} },
+	func() interface{} { return &mainnetDeposit{} },
+	func() interface{} { return &mainnetVoluntaryExit{} },
+	func() interface{} { return &mainnetBlockBody{} },
+	func() interface{} { return &mainnetBlock{} },
+	func() interface{} { return &mainnetAggregateAndProof{} },
+	func() interface{} { return &mainnetBeaconState{} },
+}
+
+// FuzzUnmarshal checks that decoding arbitrary bytes into any of the spec test
+// types returns an error rather than panicking. The first byte of the input selects
+// the target type, and the corpus is seeded with the encoding of the block and
+// state fixtures and the zero value of every type.
+func FuzzUnmarshal(f *testing.F) {
+	block := &SszBenchmarkBlock{}
+	populateStructFromYaml(f, "./yaml/ssz_single_block.yaml", block)
+	state := &SszBenchmarkState{}
+	populateStructFromYaml(f, "./yaml/ssz_single_state.yaml", state)
+	var fixtures [][]byte
+	for _, val := range []interface{}{block.Value, state.Value} {
+		enc, err := ssz.Marshal(val)
+		if err != nil {
+			f.Fatal(err)
+		}
+		fixtures = append(fixtures, enc)
+	}
+	for i, newTarget := range fuzzTargets {
+		for _, enc := range fixtures {
+			f.Add(append([]byte{byte(i)}, enc...))
+		}
+		// Zero-valued mainnet states encode to megabytes of fixed-size vectors,
+		// which would only slow the fuzzer down without reaching new code.
+		if enc, err := ssz.Marshal(newTarget()); err == nil && len(enc) > 0 && len(enc) <= maxFuzzSeedSize {
+			f.Add(append([]byte{byte(i)}, enc...))
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		newTarget := fuzzTargets[int(data[0])%len(fuzzTargets)]
+		// Only the absence of panics matters here, decoding errors are expected.
+		_ = ssz.Unmarshal(data[1:], newTarget())
+	})
+}
@@ -1,9 +1,12 @@
 package ssz
 
 import (
+	"context"
 	"fmt"
 	"reflect"
-	"strings"
+	"runtime"
+	"sync"
+	"sync/atomic"
 
 	fssz "github.com/ferranbt/fastssz"
 	"github.com/pkg/errors"
@@ -46,6 +49,26 @@ import (
 // This will treat `Field2` as type [][32]byte when marshaling a
 // struct of that type.
 func Marshal(val interface{}) ([]byte, error) {
+	return marshal(context.Background(), val)
+}
+
+// MarshalContext behaves like Marshal, but stops at the next container or list element
+// once ctx is done, returning the error of ctx.
+//
+//  ctx, cancel := context.WithTimeout(ctx, time.Second)
+//  defer cancel()
+//  encoded, err := MarshalContext(ctx, state)
+//  if err != nil {
+//      return fmt.Errorf("failed to marshal: %v", err)
+//  }
+func MarshalContext(ctx context.Context, val interface{}) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return marshal(ctx, val)
+}
+
+func marshal(ctx context.Context, val interface{}) ([]byte, error) {
 	if val == nil {
 		return nil, errors.New("untyped-value nil cannot be marshaled")
 	}
@@ -58,7 +81,7 @@ func Marshal(val interface{}) ([]byte, error) {
 
 	// We pre-allocate a buffer-size depending on the value's calculated total byte size.
 	buf := make([]byte, types.DetermineSize(rval))
-	factory, err := types.SSZFactory(rval, rval.Type())
+	factory, err := types.StateFactory(rval, rval.Type())
 	if err != nil {
 		return nil, err
 	}
@@ -66,13 +89,13 @@ func Marshal(val interface{}) ([]byte, error) {
 		if rval.IsNil() {
 			return buf, nil
 		}
-		if _, err := factory.Marshal(rval.Elem(), rval.Type().Elem(), buf, 0 /* start offset */); err != nil {
-			return nil, errors.Wrapf(err, "failed to marshal for type: %v", rval.Type().Elem())
+		if _, err := factory.MarshalContext(ctx, rval.Elem(), rval.Type().Elem(), buf, 0 /* start offset */); err != nil {
+			return nil, errors.Wrapf(withTypeName(err, rval.Type().Elem()), "failed to marshal for type: %v", rval.Type().Elem())
 		}
 		return buf, nil
 	}
-	if _, err := factory.Marshal(rval, rval.Type(), buf, 0 /* start offset */); err != nil {
-		return nil, errors.Wrapf(err, "failed to marshal for type: %v", rval.Type())
+	if _, err := factory.MarshalContext(ctx, rval, rval.Type(), buf, 0 /* start offset */); err != nil {
+		return nil, errors.Wrapf(withTypeName(err, rval.Type()), "failed to marshal for type: %v", rval.Type())
 	}
 	return buf, nil
 }
@@ -90,6 +113,38 @@ func Marshal(val interface{}) ([]byte, error) {
 //      return fmt.Errorf("failed to unmarshal: %v", err)
 //  }
 func Unmarshal(input []byte, val interface{}) error {
+	return UnmarshalWithOptions(input, val, DecodeOptions{})
+}
+
+// UnmarshalWithOptions behaves like Unmarshal, but bounds the memory allocated and
+// the nesting depth reached while decoding by the limits set in opts. Decoding stops
+// before allocating anything beyond them, returning a *DecodeError which matches
+// ErrLimitExceeded. Types implementing their own UnmarshalSSZ are not bounded.
+//
+//  opts := ssz.DecodeOptions{MaxAllocation: 1 << 20, MaxDepth: 8}
+//  if err := UnmarshalWithOptions(untrustedBytes, &targetStruct, opts); err != nil {
+//      return fmt.Errorf("failed to unmarshal: %v", err)
+//  }
+func UnmarshalWithOptions(input []byte, val interface{}, opts DecodeOptions) error {
+	return unmarshal(types.NewDecodeState(opts), input, val)
+}
+
+// UnmarshalContext behaves like Unmarshal, but stops at the next container or list
+// once ctx is done, returning an error which matches the error of ctx.
+//
+//  ctx, cancel := context.WithTimeout(ctx, time.Second)
+//  defer cancel()
+//  if err := UnmarshalContext(ctx, encodedBytes, &targetStruct); err != nil {
+//      return fmt.Errorf("failed to unmarshal: %v", err)
+//  }
+func UnmarshalContext(ctx context.Context, input []byte, val interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return unmarshal(types.NewDecodeStateContext(ctx, DecodeOptions{}), input, val)
+}
+
+func unmarshal(state *types.DecodeState, input []byte, val interface{}) error {
 	if val == nil {
 		return errors.New("cannot unmarshal into untyped, nil value")
 	}
@@ -108,26 +163,95 @@ func Unmarshal(input []byte, val interface{}) error {
 	if rval.IsNil() {
 		return errors.New("cannot output to pointer of nil value")
 	}
-	factory, err := types.SSZFactory(rval.Elem(), rtyp.Elem())
+	factory, err := types.StateFactory(rval.Elem(), rtyp.Elem())
 	if err != nil {
 		return err
 	}
-	if _, err := factory.Unmarshal(rval.Elem(), rval.Elem().Type(), input, 0); err != nil {
-		return errors.Wrapf(err, "could not unmarshal input into type: %v", rval.Elem().Type())
+	if _, err := factory.UnmarshalWithState(rval.Elem(), rval.Elem().Type(), input, 0, state); err != nil {
+		return errors.Wrapf(withTypeName(err, rval.Elem().Type()), "could not unmarshal input into type: %v", rval.Elem().Type())
 	}
 
 	fixedSize := types.DetermineSize(rval)
 	totalLength := uint64(len(input))
 	if totalLength != fixedSize {
-		return fmt.Errorf(
-			"unexpected amount of data, expected: %d, received: %d",
-			fixedSize,
-			totalLength,
-		)
+		return withTypeName(&DecodeError{
+			Offset:   fixedSize,
+			Expected: fixedSize,
+			Actual:   totalLength,
+			Err:      ErrSizeMismatch,
+		}, rval.Elem().Type())
 	}
 	return nil
 }
 
+// UnmarshalFields decodes only the named fields of the SSZ encoded input into the
+// struct pointed to by val, leaving its other fields untouched. Fields are found from
+// the fixed-size part and offsets of the encoding, so the rest of the input is never
+// decoded. Nested fields are named by dot separated paths:
+//
+//  var state BeaconState
+//  if err := UnmarshalFields(encodedState, &state, "Slot", "Fork", "LatestBlockHeader.Slot"); err != nil {
+//      return fmt.Errorf("failed to unmarshal: %v", err)
+//  }
+func UnmarshalFields(input []byte, val interface{}, fields ...string) error {
+	if val == nil {
+		return errors.New("cannot unmarshal into untyped, nil value")
+	}
+	rval := reflect.ValueOf(val)
+	if rval.Kind() != reflect.Ptr {
+		return errors.New("can only unmarshal into a pointer target")
+	}
+	if rval.IsNil() {
+		return errors.New("cannot output to pointer of nil value")
+	}
+	if err := types.UnmarshalFields(input, rval.Elem(), fields, nil); err != nil {
+		return errors.Wrapf(withTypeName(err, rval.Elem().Type()), "could not unmarshal fields of type: %v", rval.Elem().Type())
+	}
+	return nil
+}
+
+// FieldBytes returns the slice of the SSZ encoded input, of a value of type typ, which
+// holds the encoding of the value at path. Paths name fields separated by dots and select
+// list or vector elements by index, such as "Validators[3].Pubkey".
+func FieldBytes(input []byte, typ reflect.Type, path string) ([]byte, error) {
+	if typ == nil {
+		return nil, errors.New("cannot locate field of untyped, nil value")
+	}
+	data, err := types.FieldBytes(input, typ, path)
+	if err != nil {
+		return nil, errors.Wrapf(withTypeName(err, typ), "could not locate %s in type: %v", path, typ)
+	}
+	return data, nil
+}
+
+// ValueView is a read-only view over SSZ encoded bytes, navigated with Field and
+// Index without decoding into Go values.
+type ValueView = types.View
+
+// View validates the SSZ encoded input as a value of type typ once, and returns a
+// read-only view over it. Accessors of the view follow offsets lazily and return
+// sub-slices of input, so input must not be modified while the view is in use.
+//
+//  view, err := View(encodedBlock, reflect.TypeOf(BeaconBlock{}))
+//  if err != nil {
+//      return err
+//  }
+//  slotView, err := view.Field("Slot")
+//  if err != nil {
+//      return err
+//  }
+//  slot, err := slotView.Uint64()
+func View(input []byte, typ reflect.Type) (*ValueView, error) {
+	if typ == nil {
+		return nil, errors.New("cannot view untyped, nil value")
+	}
+	view, err := types.NewView(input, typ)
+	if err != nil {
+		return nil, errors.Wrapf(withTypeName(err, typ), "invalid encoding of type: %v", typ)
+	}
+	return view, nil
+}
+
 // HashTreeRoot determines the root hash using SSZ's Merkleization.
 // Given a struct with the following fields, one can tree hash it as follows:
 //  type exampleStruct struct {
@@ -144,15 +268,132 @@ func Unmarshal(input []byte, val interface{}) error {
 //      return errors.Wrap(err, "failed to compute root")
 //  }
 func HashTreeRoot(val interface{}) ([32]byte, error) {
+	h := hashStatePool.Get().(*HashState)
+	defer hashStatePool.Put(h)
+	h.Reset(context.Background())
+	return HashTreeRootWith(h, val)
+}
+
+// HashTreeRootContext behaves like HashTreeRoot, but stops at the next container or
+// list element once ctx is done, returning the error of ctx. Roots computed before
+// then may still be cached, while the roots of unfinished values are not.
+//
+//  ctx, cancel := context.WithTimeout(ctx, time.Second)
+//  defer cancel()
+//  root, err := HashTreeRootContext(ctx, state)
+//  if err != nil {
+//      return errors.Wrap(err, "failed to compute root")
+//  }
+func HashTreeRootContext(ctx context.Context, val interface{}) ([32]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return [32]byte{}, err
+	}
+	return HashTreeRootWith(types.NewHashStateContext(ctx), val)
+}
+
+// HashTreeRootWith behaves like HashTreeRoot, computing the root with the scratch space
+// of h, which is reused by the next roots computed with it.
+//
+//  h := NewHashState()
+//  for _, block := range blocks {
+//      root, err := HashTreeRootWith(h, block)
+//      if err != nil {
+//          return errors.Wrap(err, "failed to compute root")
+//      }
+//  }
+func HashTreeRootWith(h *HashState, val interface{}) ([32]byte, error) {
 	if val == nil {
 		return [32]byte{}, errors.New("untyped nil is not supported")
 	}
 	rval := reflect.ValueOf(val)
-	factory, err := types.SSZFactory(rval, rval.Type())
+	factory, err := types.StateFactory(rval, rval.Type())
 	if err != nil {
 		return [32]byte{}, errors.Wrapf(err, "could not generate tree hasher for type: %v", rval.Type())
 	}
-	return factory.Root(rval, rval.Type(), "", 0)
+	return factory.RootWithState(rval, rval.Type(), "", 0, h)
+}
+
+// HashTreeRootBatch determines the root hashes of many independent values at once, such
+// as the attestations of a block, spreading them across as many goroutines as there
+// are processors. The tree hasher of each distinct type is resolved once for the batch,
+// each goroutine reuses the scratch space of a single HashState, and the roots are
+// returned in the order of the values. If any value fails, the error of the first
+// failing one is returned.
+//
+//  roots, err := HashTreeRootBatch([]interface{}{att1, att2, att3})
+//  if err != nil {
+//      return errors.Wrap(err, "failed to compute roots")
+//  }
+func HashTreeRootBatch(values []interface{}) ([][32]byte, error) {
+	rvals := make([]reflect.Value, len(values))
+	factories := make([]types.StateSSZAble, len(values))
+	byType := make(map[reflect.Type]types.StateSSZAble)
+	for i, val := range values {
+		if val == nil {
+			return nil, errors.Errorf("untyped nil is not supported at index %d", i)
+		}
+		rvals[i] = reflect.ValueOf(val)
+		typ := rvals[i].Type()
+		factory, ok := byType[typ]
+		if !ok {
+			var err error
+			factory, err = types.StateFactory(rvals[i], typ)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not generate tree hasher for type: %v", typ)
+			}
+			byType[typ] = factory
+		}
+		factories[i] = factory
+	}
+
+	roots := make([][32]byte, len(values))
+	errs := make([]error, len(values))
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(values) {
+		workers = len(values)
+	}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			h := NewHashState()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(values) {
+					return
+				}
+				roots[i], errs[i] = factories[i].RootWithState(rvals[i], rvals[i].Type(), "", 0, h)
+			}
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not compute root of value at index %d", i)
+		}
+	}
+	return roots, nil
+}
+
+// HashTreeRootFromBytes determines the root hash of the SSZ encoded input, a value of
+// type typ, without unmarshaling it. Its result is the same as the one of HashTreeRoot
+// on the decoded value, and the input is validated as Unmarshal would beforehand.
+//
+//  root, err := HashTreeRootFromBytes(encodedBlock, reflect.TypeOf(BeaconBlock{}))
+//  if err != nil {
+//      return errors.Wrap(err, "failed to compute root")
+//  }
+func HashTreeRootFromBytes(input []byte, typ reflect.Type) ([32]byte, error) {
+	if typ == nil {
+		return [32]byte{}, errors.New("untyped nil is not supported")
+	}
+	root, err := types.RootFromBytes(input, typ, 0)
+	if err != nil {
+		return [32]byte{}, errors.Wrapf(withTypeName(err, typ), "could not compute root of type: %v", typ)
+	}
+	return root, nil
 }
 
 // HashTreeRootBitfield determines the root hash of a bitfield type using SSZ's Merkleization.
@@ -180,11 +421,14 @@ func HashTreeRootWithCapacity(val interface{}, maxCapacity uint64) ([32]byte, er
 	if rval.Kind() != reflect.Slice {
 		return [32]byte{}, fmt.Errorf("expected slice-kind input, received %v", rval.Kind())
 	}
-	factory, err := types.SSZFactory(rval, rval.Type())
+	factory, err := types.StateFactory(rval, rval.Type())
 	if err != nil {
 		return [32]byte{}, errors.Wrapf(err, "could not generate tree hasher for type: %v", rval.Type())
 	}
-	return factory.Root(rval, rval.Type(), "", maxCapacity)
+	h := hashStatePool.Get().(*HashState)
+	defer hashStatePool.Put(h)
+	h.Reset(context.Background())
+	return factory.RootWithState(rval, rval.Type(), "", maxCapacity, h)
 }
 
 // SigningRoot truncates the last property of the struct passed in
@@ -201,25 +445,7 @@ func SigningRoot(val interface{}) ([32]byte, error) {
 		if valObj.IsNil() {
 			return [32]byte{}, errors.New("nil pointer given")
 		}
-		elem := valObj.Elem()
-		elemType := valObj.Elem().Type()
-		totalFields := 0
-		for i := 0; i < elemType.NumField(); i++ {
-			// We skip protobuf related metadata fields.
-			if strings.Contains(elemType.Field(i).Name, "XXX_") {
-				continue
-			}
-			totalFields++
-		}
-		return types.StructFactory.FieldsHasher(elem, elemType, totalFields-1)
-	}
-	totalFields := 0
-	for i := 0; i < valObj.Type().NumField(); i++ {
-		// We skip protobuf related metadata fields.
-		if strings.Contains(valObj.Type().Field(i).Name, "XXX_") {
-			continue
-		}
-		totalFields++
+		return types.StructFactory.SigningRoot(valObj.Elem(), valObj.Elem().Type())
 	}
-	return types.StructFactory.FieldsHasher(valObj, valObj.Type(), totalFields-1)
+	return types.StructFactory.SigningRoot(valObj, valObj.Type())
 }
@@ -2,10 +2,14 @@ package ssz
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/hex"
 	"reflect"
+	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -598,6 +602,12 @@ func TestSigningRoot(t *testing.T) {
 		StateRoot      []byte
 		TruncatedField []byte
 	}
+	// Protobuf metadata fields are not counted, so the signature is still truncated.
+	type truncateWithMetadataCase struct {
+		Slot          uint64
+		Signature     []byte
+		XXX_sizecache int32
+	}
 	var signingRootTests = []signingRootTest{
 		{
 			Val1: &truncateSignatureCase{Slot: 20, Signature: []byte{'A', 'B'}},
@@ -645,6 +655,10 @@ func TestSigningRoot(t *testing.T) {
 				TruncatedField: []byte("SHOULDNT"),
 			},
 		},
+		{
+			Val1: &truncateWithMetadataCase{Slot: 8, Signature: []byte("DOESNT")},
+			Val2: &truncateWithMetadataCase{Slot: 8, Signature: []byte("MATTER")},
+		},
 		{
 			Val1: nil,
 			Err:  errors.New("value cannot be nil"),
@@ -798,3 +812,728 @@ func hexDecodeOrDie(t *testing.T, s string) []byte {
 	}
 	return res
 }
+
+func TestUnmarshal_MalformedInput(t *testing.T) {
+	type inner struct {
+		A uint16
+		B []uint64
+	}
+	type outer struct {
+		Slot  uint64
+		Items []inner
+		Roots [4][32]byte
+		Tail  []byte
+	}
+	valid, err := Marshal(&outer{
+		Slot:  1,
+		Items: []inner{{A: 1, B: []uint64{2}}, {A: 3}},
+		Tail:  []byte{4, 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		input []byte
+		err   error
+	}{
+		{
+			name:  "TruncatedFixedPart",
+			input: valid[:10],
+			err:   ErrShortInput,
+		},
+		{
+			name:  "OffsetPastEnd",
+			input: append(append([]byte{}, valid[:8]...), append([]byte{0xff, 0xff, 0xff, 0x00}, valid[12:]...)...),
+			err:   ErrOffsetOutOfRange,
+		},
+		{
+			name:  "DecreasingOffsets",
+			input: append(append([]byte{}, valid[:140]...), append([]byte{100, 0, 0, 0}, valid[144:]...)...),
+			err:   ErrInvalidOffset,
+		},
+		{
+			name:  "TruncatedElement",
+			input: valid[:len(valid)-7],
+			err:   ErrOffsetOutOfRange,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Unmarshal(tt.input, &outer{})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected error %v, received %v", tt.err, err)
+			}
+		})
+	}
+}
+
+type partialHeader struct {
+	Slot       uint64
+	ParentRoot [32]byte
+}
+
+type partialValidator struct {
+	PublicKey             []byte
+	WithdrawalCredentials []byte
+}
+
+type partialState struct {
+	Slot       uint64
+	Fork       *fork
+	Header     partialHeader
+	Validators []*partialValidator `ssz-max:"16"`
+	Roots      [][]byte            `ssz-size:"4,32"`
+	Balances   []uint64            `ssz-max:"16"`
+}
+
+func newPartialState() *partialState {
+	state := &partialState{
+		Slot: 42,
+		Fork: &fork{
+			PreviousVersion: [4]byte{1},
+			CurrentVersion:  [4]byte{2},
+			Epoch:           7,
+		},
+		Header:   partialHeader{Slot: 41, ParentRoot: [32]byte{9}},
+		Roots:    [][]byte{make([]byte, 32), make([]byte, 32), make([]byte, 32), make([]byte, 32)},
+		Balances: []uint64{32, 31, 30},
+	}
+	for i := 0; i < 3; i++ {
+		state.Validators = append(state.Validators, &partialValidator{
+			PublicKey:             []byte{byte(i)},
+			WithdrawalCredentials: []byte{byte(i), 1},
+		})
+	}
+	state.Roots[2][0] = 5
+	return state
+}
+
+func TestUnmarshalFields(t *testing.T) {
+	state := newPartialState()
+	enc, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := &partialState{}
+	if err := UnmarshalFields(enc, dec, "Slot", "Fork", "Header.Slot", "Balances"); err != nil {
+		t.Fatal(err)
+	}
+	want := &partialState{
+		Slot:     state.Slot,
+		Fork:     state.Fork,
+		Header:   partialHeader{Slot: state.Header.Slot},
+		Balances: state.Balances,
+	}
+	if !DeepEqual(want, dec) {
+		t.Errorf("Expected %v, received %v", want, dec)
+	}
+	if err := UnmarshalFields(enc, dec, "Validators", "Roots", "Header"); err != nil {
+		t.Fatal(err)
+	}
+	if !DeepEqual(state, dec) {
+		t.Errorf("Expected %v, received %v", state, dec)
+	}
+	if err := UnmarshalFields(enc, dec, "Missing"); err == nil {
+		t.Error("Expected unknown field to fail")
+	}
+}
+
+func TestFieldBytes(t *testing.T) {
+	state := newPartialState()
+	enc, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path  string
+		value interface{}
+	}{
+		{path: "Slot", value: state.Slot},
+		{path: "Fork", value: state.Fork},
+		{path: "Header.ParentRoot", value: state.Header.ParentRoot},
+		{path: "Validators", value: state.Validators},
+		{path: "Validators[1]", value: state.Validators[1]},
+		{path: "Validators[2].WithdrawalCredentials", value: state.Validators[2].WithdrawalCredentials},
+		{path: "Roots[2]", value: [32]byte{5}},
+		{path: "Balances[1]", value: state.Balances[1]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			want, err := Marshal(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := FieldBytes(enc, reflect.TypeOf(state), tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(want, got) {
+				t.Errorf("Expected %#x, received %#x", want, got)
+			}
+		})
+	}
+	for _, path := range []string{"", "Slot.Epoch", "Validators[3]", "Roots[4]", "Validators.[0]", "Balances[x]"} {
+		if _, err := FieldBytes(enc, reflect.TypeOf(state), path); err == nil {
+			t.Errorf("Expected path %q to fail", path)
+		}
+	}
+	// Offsets are validated as they are when decoding: the validators, the first
+	// variable-size field, start right after the 200 byte fixed-size part, and the
+	// balances do not start before them.
+	corruptOffsets := []struct {
+		validators, balances uint32
+		path                 string
+	}{
+		{validators: 196, balances: 200, path: "Validators"},
+		{validators: 200, balances: 199, path: "Balances"},
+	}
+	for _, tt := range corruptOffsets {
+		corrupt := append([]byte{}, enc...)
+		binary.LittleEndian.PutUint32(corrupt[8+16+40:], tt.validators)
+		binary.LittleEndian.PutUint32(corrupt[196:], tt.balances)
+		if err := Unmarshal(corrupt, &partialState{}); !errors.Is(err, ErrInvalidOffset) {
+			t.Errorf("Expected ErrInvalidOffset decoding offsets %d and %d, received %v", tt.validators, tt.balances, err)
+		}
+		if _, err := FieldBytes(corrupt, reflect.TypeOf(state), tt.path); !errors.Is(err, ErrInvalidOffset) {
+			t.Errorf("Expected ErrInvalidOffset locating %s, received %v", tt.path, err)
+		}
+	}
+	// Offsets leading to the field are still validated.
+	enc[8+16+40+3] = 0xff
+	if _, err := FieldBytes(enc, reflect.TypeOf(state), "Validators[0]"); !errors.Is(err, ErrOffsetOutOfRange) {
+		t.Errorf("Expected ErrOffsetOutOfRange, received %v", err)
+	}
+}
+
+type partialDeposit struct {
+	Proof  [][]byte `ssz-size:"2,32"`
+	Amount uint64
+}
+
+type partialDeposits struct {
+	Deposits []partialDeposit `ssz-max:"4"`
+}
+
+func TestFieldBytes_ElementsWithTaggedVectors(t *testing.T) {
+	val := &partialDeposits{
+		Deposits: []partialDeposit{
+			{Proof: [][]byte{make([]byte, 32), make([]byte, 32)}, Amount: 1},
+			{Proof: [][]byte{make([]byte, 32), make([]byte, 32)}, Amount: 2},
+		},
+	}
+	enc, err := Marshal(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := FieldBytes(enc, reflect.TypeOf(val), "Deposits[1].Amount")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{2, 0, 0, 0, 0, 0, 0, 0}) {
+		t.Errorf("Expected amount of second deposit, received %#x", got)
+	}
+}
+
+func TestView(t *testing.T) {
+	state := newPartialState()
+	enc, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err := View(enc, reflect.TypeOf(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slot, err := view.Field("Slot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := slot.Uint64(); err != nil || v != state.Slot {
+		t.Errorf("Expected slot %d, received %d (%v)", state.Slot, v, err)
+	}
+	validators, err := view.Field("Validators")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if validators.Len() != uint64(len(state.Validators)) {
+		t.Errorf("Expected %d validators, received %d", len(state.Validators), validators.Len())
+	}
+	validator, err := validators.Index(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creds, err := validator.Field("WithdrawalCredentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(creds.Bytes(), state.Validators[2].WithdrawalCredentials) {
+		t.Errorf("Expected %#x, received %#x", state.Validators[2].WithdrawalCredentials, creds.Bytes())
+	}
+	// Views share memory with the input instead of copying it.
+	if &creds.Bytes()[0] != &enc[len(enc)-len(creds.Bytes())-3*8] {
+		t.Error("Expected view bytes to be a sub-slice of the input")
+	}
+	if _, err := validators.Index(3); err == nil {
+		t.Error("Expected out of range index to fail")
+	}
+
+	roots := []struct {
+		view  *ValueView
+		value interface{}
+	}{
+		{view: view, value: state},
+		{view: validator, value: state.Validators[2]},
+		{view: slot, value: state.Slot},
+	}
+	for _, tt := range roots {
+		want, err := HashTreeRoot(tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := tt.view.HashTreeRoot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want != got {
+			t.Errorf("Expected root %#x, received %#x", want, got)
+		}
+	}
+	balances, err := view.Field("Balances")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := HashTreeRootWithCapacity(state.Balances, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := balances.HashTreeRoot(); err != nil || got != want {
+		t.Errorf("Expected balances root %#x, received %#x (%v)", want, got, err)
+	}
+}
+
+func TestView_ElementsWithTaggedVectors(t *testing.T) {
+	val := &partialDeposits{
+		Deposits: []partialDeposit{
+			{Proof: [][]byte{make([]byte, 32), make([]byte, 32)}, Amount: 1},
+			{Proof: [][]byte{make([]byte, 32), make([]byte, 32)}, Amount: 2},
+		},
+	}
+	enc, err := Marshal(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	view, err := View(enc, reflect.TypeOf(val))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deposits, err := view.Field("Deposits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deposits.Len() != 2 {
+		t.Errorf("Expected 2 deposits, received %d", deposits.Len())
+	}
+}
+
+func TestView_ValidatesUpFront(t *testing.T) {
+	state := newPartialState()
+	enc, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt the offset of the last validator, which sits after the 200 byte fixed-size part.
+	enc[200+2*4+3] = 0xff
+	if _, err := View(enc, reflect.TypeOf(state)); !errors.Is(err, ErrOffsetOutOfRange) {
+		t.Errorf("Expected ErrOffsetOutOfRange, received %v", err)
+	}
+	state.Balances = make([]uint64, 17)
+	enc, err = Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := View(enc, reflect.TypeOf(state)); !errors.Is(err, ErrListTooLong) {
+		t.Errorf("Expected ErrListTooLong, received %v", err)
+	}
+}
+
+func TestHashTreeRootFromBytes(t *testing.T) {
+	type bitlistContainer struct {
+		Bits     bitfield.Bitlist `ssz-max:"2048"`
+		Votes    []uint16         `ssz-max:"1024"`
+		Name     string           `ssz-max:"64"`
+		Checksum [3]uint32
+	}
+	// Fields with protobuf metadata names are left out of encodings and roots alike.
+	type metadataContainer struct {
+		Slot   uint64
+		MeXXX_ uint64
+	}
+	tests := []interface{}{
+		uint64(12),
+		true,
+		[4]byte{1, 2, 3, 4},
+		[]uint64{1, 2, 3, 4, 5},
+		[]byte{},
+		"hello",
+		[][32]byte{{1}, {2}, {3}},
+		[2][]uint32{{1, 2}, {3}},
+		[3]fork{{Epoch: 1}, {Epoch: 2}, {Epoch: 3}},
+		newPartialState(),
+		&partialState{Roots: make([][]byte, 4)},
+		&bitlistContainer{
+			Bits:     bitfield.Bitlist{0x0f, 0x01},
+			Votes:    []uint16{7, 8, 9},
+			Name:     "ssz",
+			Checksum: [3]uint32{1, 2, 3},
+		},
+		bitlistContainer{},
+		&metadataContainer{Slot: 1, MeXXX_: 2},
+	}
+	for _, tt := range tests {
+		t.Run(reflect.TypeOf(tt).String(), func(t *testing.T) {
+			want, err := HashTreeRoot(tt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			enc, err := Marshal(tt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := HashTreeRootFromBytes(enc, reflect.TypeOf(tt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want != got {
+				t.Errorf("Expected root %#x, received %#x", want, got)
+			}
+		})
+	}
+	if _, err := HashTreeRootFromBytes([]byte{2}, reflect.TypeOf(true)); !errors.Is(err, ErrInvalidBool) {
+		t.Errorf("Expected ErrInvalidBool, received %v", err)
+	}
+}
+
+func TestHashTreeRoot_BitlistOverLimit(t *testing.T) {
+	type votes struct {
+		Slot uint64
+		Bits bitfield.Bitlist `ssz-max:"8"`
+	}
+	val := &votes{Slot: 1, Bits: bitfield.NewBitlist(20)}
+	enc, err := Marshal(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typ := reflect.TypeOf(val)
+	roots := map[string]func() ([32]byte, error){
+		"HashTreeRoot": func() ([32]byte, error) {
+			return HashTreeRoot(val)
+		},
+		"Track": func() ([32]byte, error) {
+			tracked, err := Track(val)
+			if err != nil {
+				return [32]byte{}, err
+			}
+			return tracked.Root()
+		},
+		"HashTreeRootFromBytes": func() ([32]byte, error) {
+			return HashTreeRootFromBytes(enc, typ)
+		},
+		"View": func() ([32]byte, error) {
+			view, err := View(enc, typ)
+			if err != nil {
+				return [32]byte{}, err
+			}
+			return view.HashTreeRoot()
+		},
+		"Lazy": func() ([32]byte, error) {
+			lazy, err := NewLazy(bytes.NewReader(enc), int64(len(enc)), typ)
+			if err != nil {
+				return [32]byte{}, err
+			}
+			return lazy.HashTreeRoot()
+		},
+	}
+	for name, root := range roots {
+		if _, err := root(); !errors.Is(err, ErrListTooLong) {
+			t.Errorf("%s: expected ErrListTooLong, received %v", name, err)
+		}
+	}
+}
+
+func TestHashTreeRootBatch(t *testing.T) {
+	values := make([]interface{}, 0, 200)
+	for i := 0; i < 100; i++ {
+		values = append(values, &truncateSignatureCase{
+			Slot:              uint64(i),
+			PreviousBlockRoot: []byte{'a', byte(i)},
+			Signature:         []byte("TESTING23"),
+		})
+		values = append(values, fork{Epoch: uint64(i)})
+	}
+	roots, err := HashTreeRootBatch(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roots) != len(values) {
+		t.Fatalf("Expected %d roots, received %d", len(values), len(roots))
+	}
+	for i, val := range values {
+		want, err := HashTreeRoot(val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if roots[i] != want {
+			t.Errorf("Expected root %#x of value %d, received %#x", want, i, roots[i])
+		}
+	}
+
+	values[150] = nil
+	if _, err := HashTreeRootBatch(values); err == nil {
+		t.Error("Expected untyped nil to fail")
+	}
+	values[150] = make(chan int)
+	if _, err := HashTreeRootBatch(values); err == nil {
+		t.Error("Expected unsupported type to fail")
+	}
+}
+
+func TestHashTreeRootBatch_WithCaches(t *testing.T) {
+	type rootsHolder struct {
+		Slot       uint64
+		BlockRoots [][]byte `ssz-size:"16,32"`
+	}
+	values := make([]interface{}, 64)
+	for i := range values {
+		h := &rootsHolder{Slot: uint64(i), BlockRoots: make([][]byte, 16)}
+		for j := range h.BlockRoots {
+			root := [32]byte{byte(j), byte(i % 4)}
+			h.BlockRoots[j] = root[:]
+		}
+		values[i] = h
+	}
+	want := make([][32]byte, len(values))
+	for i, val := range values {
+		root, err := HashTreeRoot(val)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[i] = root
+	}
+
+	// Run with -race, the values hashed at once share the layers cached for their field.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	types.ToggleCache(true)
+	types.ToggleContainerCache(true)
+	defer types.ToggleCache(false)
+	defer types.ToggleContainerCache(false)
+	for n := 0; n < 4; n++ {
+		roots, err := HashTreeRootBatch(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range values {
+			if roots[i] != want[i] {
+				t.Errorf("Expected root %#x of value %d, received %#x", want[i], i, roots[i])
+			}
+		}
+	}
+}
+
+// countdownContext is cancelled once it was checked a given number of times, so that
+// calls are cancelled part way through.
+type countdownContext struct {
+	context.Context
+	remaining int64
+	done      chan struct{}
+}
+
+func newCountdownContext(checks int64) *countdownContext {
+	done := make(chan struct{})
+	close(done)
+	return &countdownContext{Context: context.Background(), remaining: checks, done: done}
+}
+
+func (c *countdownContext) Done() <-chan struct{} {
+	if atomic.AddInt64(&c.remaining, -1) < 0 {
+		return c.done
+	}
+	return nil
+}
+
+func (c *countdownContext) Err() error {
+	if atomic.LoadInt64(&c.remaining) < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestContext_Cancelled(t *testing.T) {
+	type validator struct {
+		Pubkey  []byte `ssz-size:"48"`
+		Balance uint64
+	}
+	type state struct {
+		Slot       uint64
+		Validators []*validator `ssz-max:"1024"`
+		Names      [][]byte     `ssz-max:"16" ssz-size:"?,4"`
+	}
+	val := &state{Slot: 1, Names: [][]byte{{1, 2, 3, 4}}}
+	for i := 0; i < 100; i++ {
+		val.Validators = append(val.Validators, &validator{Pubkey: make([]byte, 48), Balance: uint64(i)})
+	}
+	enc, err := Marshal(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types.ToggleContainerCache(true)
+	defer types.ToggleContainerCache(false)
+	root, err := HashTreeRoot(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	types.ClearCache()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, ctx := range []context.Context{cancelled, newCountdownContext(50)} {
+		if _, err := MarshalContext(ctx, val); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected marshaling to be cancelled, received %v", err)
+		}
+	}
+	for _, ctx := range []context.Context{cancelled, newCountdownContext(50)} {
+		if err := UnmarshalContext(ctx, enc, &state{}); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected unmarshaling to be cancelled, received %v", err)
+		}
+	}
+	for _, ctx := range []context.Context{cancelled, newCountdownContext(50)} {
+		if _, err := HashTreeRootContext(ctx, val); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected hashing to be cancelled, received %v", err)
+		}
+	}
+
+	// Cancelled calls leave the cache consistent with complete ones.
+	types.ToggleCacheVerification(true)
+	defer types.ToggleCacheVerification(false)
+	got, err := HashTreeRootContext(context.Background(), val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != root {
+		t.Errorf("Expected root %#x, received %#x", root, got)
+	}
+	dec := &state{}
+	if err := UnmarshalContext(context.Background(), enc, dec); err != nil {
+		t.Fatal(err)
+	}
+	if !DeepEqual(val, dec) {
+		t.Errorf("Expected %v, received %v", val, dec)
+	}
+	if enc2, err := MarshalContext(context.Background(), dec); err != nil || !bytes.Equal(enc, enc2) {
+		t.Errorf("Expected encoding %#x, received %#x, %v", enc, enc2, err)
+	}
+}
+
+func TestHashTreeRoot_NestedListLimits(t *testing.T) {
+	type nested struct {
+		Lists [][]uint64 `ssz-max:"16,32"`
+		Names []string   `ssz-max:"?,8"`
+	}
+	val := &nested{
+		Lists: [][]uint64{{1, 2, 3}, {}, {4}},
+		Names: []string{"alpha", "beta"},
+	}
+	// Each level is hashed as the list of the roots of its elements, with its own limit.
+	listRoots := make([][32]byte, len(val.Lists))
+	for i, list := range val.Lists {
+		r, err := HashTreeRootWithCapacity(list, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		listRoots[i] = r
+	}
+	nameRoots := make([][32]byte, len(val.Names))
+	for i, name := range val.Names {
+		r, err := HashTreeRootWithCapacity([]byte(name), 8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nameRoots[i] = r
+	}
+	var fieldRoots struct {
+		Lists, Names [32]byte
+	}
+	var err error
+	if fieldRoots.Lists, err = HashTreeRootWithCapacity(listRoots, 16); err != nil {
+		t.Fatal(err)
+	}
+	if fieldRoots.Names, err = HashTreeRootWithCapacity(nameRoots, uint64(len(nameRoots))); err != nil {
+		t.Fatal(err)
+	}
+	want, err := HashTreeRoot(fieldRoots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := HashTreeRoot(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != want {
+		t.Errorf("HashTreeRoot() = %#x, want %#x", root, want)
+	}
+	enc, err := Marshal(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromBytes, err := HashTreeRootFromBytes(enc, reflect.TypeOf(val))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromBytes != want {
+		t.Errorf("HashTreeRootFromBytes() = %#x, want %#x", fromBytes, want)
+	}
+	lazy, err := NewLazy(bytes.NewReader(enc), int64(len(enc)), reflect.TypeOf(val))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazyRoot, err := lazy.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lazyRoot != want {
+		t.Errorf("Lazy.HashTreeRoot() = %#x, want %#x", lazyRoot, want)
+	}
+	tracker, err := Track(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracked, err := tracker.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tracked != want {
+		t.Errorf("Tracker.Root() = %#x, want %#x", tracked, want)
+	}
+
+	// Elements reached through a view keep the limit of their level.
+	view, err := View(enc, reflect.TypeOf(val))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lists, err := view.Field("Lists")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := lists.Index(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstRoot, err := first.HashTreeRoot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if firstRoot != listRoots[0] {
+		t.Errorf("Lists[0] root = %#x, want %#x", firstRoot, listRoots[0])
+	}
+}
@@ -0,0 +1,41 @@
+package ssz
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/go-ssz/types"
+)
+
+// Tracker computes the hash tree root of a tracked value, rehashing only what was
+// mutated since its previous root.
+type Tracker = types.Tracker
+
+// Track returns a tracker of the value pointed to by val. Its Root method returns the
+// same root as HashTreeRoot, but only rehashes the fields and list elements recorded as
+// mutated since the previous root, through the Set or MarkDirty methods of the tracker.
+// Mutations which are not recorded are not reflected in the root.
+//
+//  tracker, err := Track(&state)
+//  if err != nil {
+//      return err
+//  }
+//  state.Validators[3].EffectiveBalance = 32000000000
+//  if err := tracker.MarkDirty("Validators[3].EffectiveBalance"); err != nil {
+//      return err
+//  }
+//  if err := tracker.Set("Slot", uint64(10)); err != nil {
+//      return err
+//  }
+//  root, err := tracker.Root()
+func Track(val interface{}) (*Tracker, error) {
+	if val == nil {
+		return nil, errors.New("untyped nil is not supported")
+	}
+	rval := reflect.ValueOf(val)
+	t, err := types.NewTracker(rval)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not track value of type: %v", rval.Type())
+	}
+	return t, nil
+}
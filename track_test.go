@@ -0,0 +1,119 @@
+package ssz
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTrack(t *testing.T) {
+	state := newLazyState()
+	tracker, err := Track(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		mutate func() error
+	}{
+		{name: "no mutation", mutate: func() error { return nil }},
+		{name: "basic field", mutate: func() error {
+			return tracker.Set("Slot", uint64(12))
+		}},
+		{name: "packed list element", mutate: func() error {
+			state.Balances[5] = 99
+			state.Balances[19999] = 1
+			if err := tracker.MarkDirty("Balances[5]"); err != nil {
+				return err
+			}
+			return tracker.MarkDirty("Balances[19999]")
+		}},
+		{name: "nested field of list element", mutate: func() error {
+			state.Validators[7].PublicKey[0] = 1
+			return tracker.MarkDirty("Validators[7].PublicKey")
+		}},
+		{name: "replaced list element", mutate: func() error {
+			return tracker.Set("Validators[8]", &partialValidator{PublicKey: []byte{1, 2, 3}})
+		}},
+		{name: "vector element", mutate: func() error {
+			state.Roots[100][3] = 7
+			return tracker.MarkDirty("Roots[100]")
+		}},
+		{name: "appended list elements", mutate: func() error {
+			state.Validators = append(state.Validators, &partialValidator{}, &partialValidator{PublicKey: []byte{4}})
+			return tracker.MarkDirty("Validators")
+		}},
+		{name: "replaced list", mutate: func() error {
+			return tracker.Set("Names", []string{"x"})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.mutate(); err != nil {
+				t.Fatal(err)
+			}
+			want, err := HashTreeRoot(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tracker.Root()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want != got {
+				t.Errorf("Expected root %#x, received %#x", want, got)
+			}
+		})
+	}
+}
+
+func TestTrack_OnlyRehashesRecordedMutations(t *testing.T) {
+	state := newLazyState()
+	tracker, err := Track(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := tracker.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Validators[3].WithdrawalCredentials = bytes.Repeat([]byte{9}, 32)
+	cached, err := tracker.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached != before {
+		t.Error("Expected unrecorded mutation to be ignored")
+	}
+	if err := tracker.MarkDirty("Validators[3].WithdrawalCredentials"); err != nil {
+		t.Fatal(err)
+	}
+	want, err := HashTreeRoot(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tracker.Root()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != got {
+		t.Errorf("Expected root %#x, received %#x", want, got)
+	}
+}
+
+func TestTrack_InvalidPaths(t *testing.T) {
+	tracker, err := Track(newLazyState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"", "Missing", "Slot[1]", "Validators.PublicKey", "Validators[0].Missing"} {
+		if err := tracker.MarkDirty(path); err == nil {
+			t.Errorf("Expected error marking %q", path)
+		}
+	}
+	if err := tracker.Set("Slot", "ten"); err == nil {
+		t.Error("Expected error setting field to value of the wrong type")
+	}
+	if _, err := Track(lazyState{}); err == nil {
+		t.Error("Expected error tracking value which is not a pointer")
+	}
+}
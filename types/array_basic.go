@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"reflect"
 	"sync"
 
@@ -19,102 +20,112 @@ type basicArraySSZ struct {
 }
 
 func newBasicArraySSZ() *basicArraySSZ {
-	cache, _ := ristretto.NewCache(&ristretto.Config{
-		NumCounters: BasicArraySizeCache, // number of keys to track frequency of (1M).
-		MaxCost:     1 << 22,             // maximum cost of cache (3MB).
-		// 100,000 roots will take up approximately 3 MB in memory.
-		BufferItems: 64, // number of keys per Get buffer.
-	})
+	cache, _ := newHashCache("basic array", DefaultCacheConfig().BasicArray)
 	return &basicArraySSZ{
 		hashCache: cache,
 	}
 }
 
-func (b *basicArraySSZ) Root(val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64) ([32]byte, error) {
+func (b *basicArraySSZ) root(val reflect.Value, typ reflect.Type, fieldName string, limits listLimits, state *HashState) ([32]byte, error) {
+	if state == nil {
+		state = NewHashState()
+	}
 	numItems := val.Len()
-	hashKeyElements := make([]byte, BytesPerChunk*numItems)
-	emptyKey := highwayhash.Sum(hashKeyElements, fastSumHashKey[:])
-	leaves := make([][]byte, numItems)
-	offset := 0
-	var factory SSZAble
+	var factory sszFactory
 	var err error
 	if numItems > 0 {
-		factory, err = SSZFactory(val.Index(0), typ.Elem())
+		factory, err = factoryOf(val.Index(0), typ.Elem())
 		if err != nil {
 			return [32]byte{}, err
 		}
 	}
+	mark := state.mark()
+	defer state.pop(mark)
 	for i := 0; i < numItems; i++ {
-		r, err := factory.Root(val.Index(i), typ.Elem(), "", 0)
+		r, err := factory.root(val.Index(i), typ.Elem(), "", nil, state)
 		if err != nil {
 			return [32]byte{}, err
 		}
-		leaves[i] = r[:]
-		copy(hashKeyElements[offset:offset+32], r[:])
-		offset += 32
+		state.pushRoot(r)
+	}
+	computeRoot := func() ([32]byte, error) {
+		state.packChunks(mark)
+		count := state.chunks(mark)
+		return state.merkleize(mark, count)
+	}
+	if !cacheConfig.BasicArray.Enabled {
+		return computeRoot()
 	}
-	hashKey := highwayhash.Sum(hashKeyElements, fastSumHashKey[:])
-	if enableCache && hashKey != emptyKey {
+	hashKey := highwayhash.Sum(state.stack[mark:], fastSumHashKey[:])
+	emptyKey := highwayhash.Sum(make([]byte, len(state.stack)-mark), fastSumHashKey[:])
+	if hashKey != emptyKey {
 		res, ok := b.hashCache.Get(string(hashKey[:]))
 		if res != nil && ok {
-			return res.([32]byte), nil
+			return verifyCachedRoot(fieldName, res.([32]byte), computeRoot)
 		}
 	}
-	chunks, err := pack(leaves)
-	if err != nil {
-		return [32]byte{}, err
-	}
-	root, err := bitwiseMerkleize(chunks, uint64(len(chunks)), uint64(len(chunks)))
+	root, err := computeRoot()
 	if err != nil {
 		return [32]byte{}, err
 	}
-	if enableCache && hashKey != emptyKey {
+	if hashKey != emptyKey {
 		b.hashCache.Set(string(hashKey[:]), root, 32)
 	}
 	return root, nil
 }
 
-func (b *basicArraySSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+func (b *basicArraySSZ) marshal(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
 	index := startOffset
 	var err error
 	if val.Len() == 0 {
 		return index, nil
 	}
-	factory, err := SSZFactory(val.Index(0), typ.Elem())
+	factory, err := factoryOf(val.Index(0), typ.Elem())
 	if err != nil {
 		return 0, err
 	}
 	for i := 0; i < val.Len(); i++ {
-		index, err = factory.Marshal(val.Index(i), typ.Elem(), buf, index)
+		index, err = factory.marshal(ctx, val.Index(i), typ.Elem(), buf, index)
 		if err != nil {
-			return 0, err
+			return 0, annotateEncodeError(err, indexPath(i))
 		}
 	}
 	return index, nil
 }
 
-func (b *basicArraySSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64) (uint64, error) {
+func (b *basicArraySSZ) unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64, state *DecodeState) (uint64, error) {
+	if err := state.enter(startOffset); err != nil {
+		return 0, err
+	}
+	defer state.leave()
+	// Vectors of integers are decoded by copying the input into their memory as a
+	// whole on little-endian platforms, when it holds all of their elements.
+	if val.Type() == typ && val.CanAddr() && uint64(val.Len())*uint64(typ.Elem().Size()) <= remainingBytes(input, startOffset) {
+		if dst, ok := bulkBytes(val); ok {
+			return startOffset + uint64(copy(dst, input[startOffset:])), nil
+		}
+	}
 	i := 0
 	index := startOffset
 	size := val.Len()
 	var err error
-	var factory SSZAble
+	var factory sszFactory
 	for i < size {
 		if val.Index(i).Kind() == reflect.Ptr {
 			instantiateConcreteTypeForElement(val.Index(i), typ.Elem().Elem())
-			factory, err = SSZFactory(val.Index(i), typ.Elem().Elem())
+			factory, err = factoryOf(val.Index(i), typ.Elem().Elem())
 			if err != nil {
 				return 0, err
 			}
 		} else {
-			factory, err = SSZFactory(val.Index(i), typ.Elem())
+			factory, err = factoryOf(val.Index(i), typ.Elem())
 			if err != nil {
 				return 0, err
 			}
 		}
-		index, err = factory.Unmarshal(val.Index(i), typ.Elem(), input, index)
+		index, err = factory.unmarshal(val.Index(i), typ.Elem(), input, index, state)
 		if err != nil {
-			return 0, err
+			return 0, annotateDecodeError(err, indexPath(i), 0)
 		}
 		i++
 	}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"encoding/binary"
 	"reflect"
 )
@@ -11,17 +12,19 @@ func newCompositeArraySSZ() *compositeArraySSZ {
 	return &compositeArraySSZ{}
 }
 
-func (b *compositeArraySSZ) Root(val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64) ([32]byte, error) {
-	var factory SSZAble
+func (b *compositeArraySSZ) root(val reflect.Value, typ reflect.Type, fieldName string, limits listLimits, state *HashState) ([32]byte, error) {
+	if state == nil {
+		state = NewHashState()
+	}
+	var factory sszFactory
 	var err error
 	numItems := val.Len()
 	if numItems > 0 {
-		factory, err = SSZFactory(val.Index(0), typ.Elem())
+		factory, err = factoryOf(val.Index(0), typ.Elem())
 		if err != nil {
 			return [32]byte{}, err
 		}
 	}
-	roots := make([][]byte, numItems)
 	elemSize := uint64(0)
 	if isBasicType(typ.Elem().Kind()) {
 		elemSize = determineFixedSize(val, typ.Elem())
@@ -29,43 +32,40 @@ func (b *compositeArraySSZ) Root(val reflect.Value, typ reflect.Type, fieldName
 		elemSize = 32
 	}
 	limit := (uint64(val.Len())*elemSize + 31) / 32
+	mark := state.mark()
+	defer state.pop(mark)
 	for i := 0; i < val.Len(); i++ {
-		r, err := factory.Root(val.Index(i), typ.Elem(), "", 0)
+		if err := state.checkContext(); err != nil {
+			return [32]byte{}, err
+		}
+		r, err := factory.root(val.Index(i), typ.Elem(), "", limits.inner(), state)
 		if err != nil {
 			return [32]byte{}, err
 		}
-		roots[i] = r[:]
-	}
-	chunks, err := pack(roots)
-	if err != nil {
-		return [32]byte{}, err
-	}
-	if val.Len() == 0 {
-		chunks = [][]byte{}
+		state.pushRoot(r)
 	}
-	root, err := bitwiseMerkleize(chunks, uint64(len(chunks)), limit)
-	if err != nil {
-		return [32]byte{}, err
-	}
-	return root, nil
+	return state.merkleize(mark, limit)
 }
 
-func (b *compositeArraySSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+func (b *compositeArraySSZ) marshal(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
 	index := startOffset
 	if val.Len() == 0 {
 		return index, nil
 	}
-	factory, err := SSZFactory(val.Index(0), typ.Elem())
+	factory, err := factoryOf(val.Index(0), typ.Elem())
 	if err != nil {
 		return 0, err
 	}
 	if !isVariableSizeType(typ.Elem()) {
 		for i := 0; i < val.Len(); i++ {
+			if err := checkContext(ctx); err != nil {
+				return 0, err
+			}
 			// If each element is not variable size, we simply encode sequentially and write
 			// into the buffer at the last index we wrote at.
-			index, err = factory.Marshal(val.Index(i), typ.Elem(), buf, index)
+			index, err = factory.marshal(ctx, val.Index(i), typ.Elem(), buf, index)
 			if err != nil {
-				return 0, err
+				return 0, annotateEncodeError(err, indexPath(i))
 			}
 		}
 		return index, nil
@@ -76,10 +76,13 @@ func (b *compositeArraySSZ) Marshal(val reflect.Value, typ reflect.Type, buf []b
 	// If the elements are variable size, we need to include offset indices
 	// in the serialized output list.
 	for i := 0; i < val.Len(); i++ {
-		nextOffsetIndex, err = factory.Marshal(val.Index(i), typ.Elem(), buf, currentOffsetIndex)
-		if err != nil {
+		if err := checkContext(ctx); err != nil {
 			return 0, err
 		}
+		nextOffsetIndex, err = factory.marshal(ctx, val.Index(i), typ.Elem(), buf, currentOffsetIndex)
+		if err != nil {
+			return 0, annotateEncodeError(err, indexPath(i))
+		}
 		// Write the offset.
 		offsetBuf := make([]byte, BytesPerLengthOffset)
 		binary.LittleEndian.PutUint32(offsetBuf, uint32(currentOffsetIndex-startOffset))
@@ -93,20 +96,41 @@ func (b *compositeArraySSZ) Marshal(val reflect.Value, typ reflect.Type, buf []b
 	return index, nil
 }
 
-func (b *compositeArraySSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64) (uint64, error) {
+func (b *compositeArraySSZ) unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64, state *DecodeState) (uint64, error) {
+	if typ.Len() == 0 {
+		return startOffset, nil
+	}
+	if err := state.enter(startOffset); err != nil {
+		return 0, err
+	}
+	defer state.leave()
+	firstOffset, err := readFirstOffset(input, startOffset)
+	if err != nil {
+		return 0, err
+	}
+	// A vector holds exactly one offset per element.
+	if numOffsets := (firstOffset - startOffset) / BytesPerLengthOffset; numOffsets != uint64(typ.Len()) {
+		return 0, &DecodeError{
+			Offset:   startOffset,
+			Expected: uint64(typ.Len()),
+			Actual:   numOffsets,
+			Err:      ErrVectorLength,
+		}
+	}
 	currentIndex := startOffset
 	nextIndex := currentIndex
-	offsetVal := input[startOffset : startOffset+BytesPerLengthOffset]
-	firstOffset := startOffset + uint64(binary.LittleEndian.Uint32(offsetVal))
 	currentOffset := firstOffset
 	nextOffset := currentOffset
 	endOffset := uint64(len(input))
 	i := 0
 	if val.Kind() == reflect.Slice {
+		if err := state.allocate(typ.Elem(), uint64(typ.Len()), startOffset); err != nil {
+			return 0, err
+		}
 		instantiatedArray := reflect.MakeSlice(val.Type(), typ.Len(), typ.Len())
 		val.Set(instantiatedArray)
 	}
-	factory, err := SSZFactory(val.Index(0), typ.Elem())
+	factory, err := factoryOf(val.Index(0), typ.Elem())
 	if err != nil {
 		return 0, err
 	}
@@ -115,14 +139,16 @@ func (b *compositeArraySSZ) Unmarshal(val reflect.Value, typ reflect.Type, input
 		if nextIndex == firstOffset {
 			nextOffset = endOffset
 		} else {
-			nextOffsetVal := input[nextIndex : nextIndex+BytesPerLengthOffset]
-			nextOffset = startOffset + uint64(binary.LittleEndian.Uint32(nextOffsetVal))
+			nextOffset, err = readNextOffset(input, startOffset, nextIndex, currentOffset)
+			if err != nil {
+				return 0, annotateDecodeError(err, indexPath(i+1), 0)
+			}
 		}
 		if val.Index(i).Kind() == reflect.Ptr {
 			instantiateConcreteTypeForElement(val.Index(i), typ.Elem().Elem())
 		}
-		if _, err := factory.Unmarshal(val.Index(i), typ.Elem(), input[currentOffset:nextOffset], 0); err != nil {
-			return 0, err
+		if _, err := factory.unmarshal(val.Index(i), typ.Elem(), input[currentOffset:nextOffset], 0, state); err != nil {
+			return 0, annotateDecodeError(err, indexPath(i), currentOffset)
 		}
 		i++
 		currentIndex = nextIndex
@@ -2,6 +2,7 @@ package types
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"reflect"
 	"sync"
@@ -15,28 +16,38 @@ import (
 const RootsArraySizeCache = 100000
 
 type rootsArraySSZ struct {
-	hashCache    *ristretto.Cache
+	hashCache *ristretto.Cache
+	// lock guards the layers and leaves cached for each field, and their sizes, as
+	// roots may be computed from many goroutines at once.
 	lock         sync.Mutex
 	cachedLeaves map[string][][]byte
 	layers       map[string][][][]byte
+	// layerSizes holds the memory in bytes of the layers and leaves cached for each
+	// field, which add up to layerBytes.
+	layerSizes map[string]uint64
+	layerBytes uint64
 }
 
 func newRootsArraySSZ() *rootsArraySSZ {
-	cache, _ := ristretto.NewCache(&ristretto.Config{
-		NumCounters: RootsArraySizeCache, // number of keys to track frequency of (100000).
-		MaxCost:     1 << 23,             // maximum cost of cache (3MB).
-		// 100,000 roots will take up approximately 3 MB in memory.
-		BufferItems: 64, // number of keys per Get buffer.
-	})
+	cache, _ := newHashCache("roots array", DefaultCacheConfig().RootsArray)
 	return &rootsArraySSZ{
 		hashCache:    cache,
 		cachedLeaves: make(map[string][][]byte),
 		layers:       make(map[string][][][]byte),
+		layerSizes:   make(map[string]uint64),
 	}
 }
 
-func (a *rootsArraySSZ) Root(val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64) ([32]byte, error) {
+func (a *rootsArraySSZ) root(val reflect.Value, typ reflect.Type, fieldName string, limits listLimits, state *HashState) ([32]byte, error) {
+	if state == nil {
+		state = NewHashState()
+	}
 	numItems := val.Len()
+	if !cacheConfig.RootsArray.Enabled && numItems > 0 {
+		return a.stackRoot(val, state)
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
 	// We make sure to look into the cache only if a field name is provided, that is,
 	// if this function is called when calling HashTreeRoot on a struct type that has
 	// a field which is an array of roots. An example is:
@@ -46,7 +57,7 @@ func (a *rootsArraySSZ) Root(val reflect.Value, typ reflect.Type, fieldName stri
 	// }
 	//
 	// which would allow us to look into the cache by the field "BlockRoots".
-	if enableCache && fieldName != "" {
+	if cacheConfig.RootsArray.Enabled && fieldName != "" {
 		if _, ok := a.layers[fieldName]; !ok {
 			depth := merkle.GetDepth(uint64(numItems))
 			a.layers[fieldName] = make([][][]byte, depth+1)
@@ -69,7 +80,7 @@ func (a *rootsArraySSZ) Root(val reflect.Value, typ reflect.Type, fieldName stri
 		leaves[i] = item[:]
 		copy(hashKeyElements[offset:offset+32], leaves[i])
 		offset += 32
-		if enableCache && fieldName != "" {
+		if cacheConfig.RootsArray.Enabled && fieldName != "" {
 			if _, ok := a.cachedLeaves[fieldName]; ok {
 				if !bytes.Equal(leaves[i], a.cachedLeaves[fieldName][i]) {
 					changedIndices = append(changedIndices, i)
@@ -78,33 +89,63 @@ func (a *rootsArraySSZ) Root(val reflect.Value, typ reflect.Type, fieldName stri
 		}
 	}
 	chunks := leaves
+	computeRoot := func() ([32]byte, error) {
+		return a.merkleize(append([][]byte{}, chunks...), ""), nil
+	}
 	// Recompute the root from the modified branches from the previous call
 	// to this function.
 	if len(changedIndices) > 0 {
 		var rt [32]byte
 		for i := 0; i < len(changedIndices); i++ {
 			rt = a.recomputeRoot(changedIndices[i], chunks, fieldName)
+			a.cachedLeaves[fieldName][changedIndices[i]] = chunks[changedIndices[i]]
 		}
-		return rt, nil
+		return verifyCachedRoot(fieldName, rt, computeRoot)
 	}
 	hashKey := highwayhash.Sum(hashKeyElements, fastSumHashKey[:])
-	if enableCache && hashKey != emptyKey {
+	if cacheConfig.RootsArray.Enabled && hashKey != emptyKey {
 		res, ok := a.hashCache.Get(string(hashKey[:]))
 		if res != nil && ok {
-			return res.([32]byte), nil
+			return verifyCachedRoot(fieldName, res.([32]byte), computeRoot)
 		}
 	}
 	root := a.merkleize(chunks, fieldName)
-	if enableCache && fieldName != "" {
+	if cacheConfig.RootsArray.Enabled && fieldName != "" {
 		a.cachedLeaves[fieldName] = leaves
+		a.accountLayers(fieldName)
 	}
-	if enableCache && hashKey != emptyKey {
+	if cacheConfig.RootsArray.Enabled && hashKey != emptyKey {
 		a.hashCache.Set(string(hashKey[:]), root, 32)
 	}
 	return root, nil
 }
 
-func (a *rootsArraySSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+// stackRoot returns the root of a non-empty vector of roots, merkleized on the stack
+// of state, when no layers are cached.
+func (a *rootsArraySSZ) stackRoot(val reflect.Value, state *HashState) ([32]byte, error) {
+	mark := state.mark()
+	defer state.pop(mark)
+	for i := 0; i < val.Len(); i++ {
+		item := val.Index(i)
+		switch {
+		case item.Kind() == reflect.Slice && item.Type().Elem().Kind() == reflect.Uint8:
+			state.pushZeroes(BytesPerChunk)
+			copy(state.stack[len(state.stack)-BytesPerChunk:], item.Bytes())
+		case item.Kind() == reflect.Array && item.CanAddr():
+			state.pushZeroes(BytesPerChunk)
+			copy(state.stack[len(state.stack)-BytesPerChunk:], item.Slice(0, item.Len()).Bytes())
+		default:
+			res, ok := item.Interface().([32]byte)
+			if !ok {
+				return [32]byte{}, fmt.Errorf("expected array or slice of len 32, received %v", item)
+			}
+			state.pushRoot(res)
+		}
+	}
+	return state.merkleize(mark, uint64(val.Len()))
+}
+
+func (a *rootsArraySSZ) marshal(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
 	index := startOffset
 	if val.Len() == 0 {
 		return index, nil
@@ -114,6 +155,15 @@ func (a *rootsArraySSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte,
 		if res, ok := val.Index(i).Interface().([32]byte); ok {
 			item = res
 		} else if res, ok := val.Index(i).Interface().([]byte); ok {
+			// Nil roots are encoded as zero roots, anything else must be exactly 32 bytes.
+			if len(res) != 0 && len(res) != 32 {
+				return 0, &EncodeError{
+					Path:     indexPath(i),
+					Expected: 32,
+					Actual:   uint64(len(res)),
+					Err:      ErrVectorLength,
+				}
+			}
 			item = toBytes32(res)
 		} else {
 			return 0, fmt.Errorf("expected array or slice of len 32, received %v", val.Index(i))
@@ -124,12 +174,25 @@ func (a *rootsArraySSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte,
 	return index, nil
 }
 
-func (a *rootsArraySSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64) (uint64, error) {
+func (a *rootsArraySSZ) unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64, state *DecodeState) (uint64, error) {
 	i := 0
 	index := startOffset
 	for i < val.Len() {
-		val.Index(i).SetBytes(input[index : index+uint64(32)])
-		index += uint64(32)
+		if index+32 > uint64(len(input)) {
+			return 0, &DecodeError{
+				Path:     indexPath(i),
+				Offset:   index,
+				Expected: 32,
+				Actual:   remainingBytes(input, index),
+				Err:      ErrShortInput,
+			}
+		}
+		if val.Index(i).Kind() == reflect.Array {
+			reflect.Copy(val.Index(i), reflect.ValueOf(input[index:index+32]))
+		} else {
+			val.Index(i).SetBytes(input[index : index+32])
+		}
+		index += 32
 		i++
 	}
 	return index, nil
@@ -137,6 +200,7 @@ func (a *rootsArraySSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []b
 
 func (a *rootsArraySSZ) recomputeRoot(idx int, chunks [][]byte, fieldName string) [32]byte {
 	root := chunks[idx]
+	a.layers[fieldName][0][idx] = root
 	for i := 0; i < len(a.layers[fieldName])-1; i++ {
 		subIndex := (uint64(idx) / (1 << uint64(i))) ^ 1
 		isLeft := uint64(idx) / (1 << uint64(i))
@@ -161,34 +225,94 @@ func (a *rootsArraySSZ) merkleize(chunks [][]byte, fieldName string) [32]byte {
 		copy(root[:], chunks[0])
 		return root
 	}
-	for !isPowerOf2(len(chunks)) {
-		chunks = append(chunks, make([]byte, BytesPerChunk))
-	}
-	hashLayer := chunks
-	if enableCache && fieldName != "" {
-		a.layers[fieldName][0] = hashLayer
+	width := len(chunks)
+	for !isPowerOf2(width) {
+		width++
 	}
 	// We keep track of the hash layers of a Merkle trie until we reach
 	// the top layer of length 1, which contains the single root element.
 	//        [Root]      -> Top layer has length 1.
 	//    [E]       [F]   -> This layer has length 2.
 	// [A]  [B]  [C]  [D] -> The bottom layer has length 4 (needs to be a power of two).
-	i := 1
-	for len(hashLayer) > 1 {
-		layer := [][]byte{}
-		for i := 0; i < len(hashLayer); i += 2 {
-			hashedChunk := hash(append(hashLayer[i], hashLayer[i+1]...))
-			layer = append(layer, hashedChunk[:])
+	// The layers are laid out one after the other in a single buffer, from the bottom
+	// layer up, and each layer is hashed into the next one as a whole.
+	buf := make([]byte, (2*width-1)*BytesPerChunk)
+	for i, chunk := range chunks {
+		copy(buf[i*BytesPerChunk:], chunk)
+	}
+	layer := buf[:width*BytesPerChunk]
+	rest := buf[width*BytesPerChunk:]
+	for i := 0; ; i++ {
+		if cacheConfig.RootsArray.Enabled && fieldName != "" {
+			a.layers[fieldName][i] = splitChunks(layer)
 		}
-		hashLayer = layer
-		if enableCache && fieldName != "" {
-			a.layers[fieldName][i] = hashLayer
+		if len(layer) == BytesPerChunk {
+			break
 		}
-		i++
+		parent := rest[:len(layer)/2]
+		rest = rest[len(layer)/2:]
+		hashLayer(parent, layer)
+		layer = parent
 	}
-	var root [32]byte
-	copy(root[:], hashLayer[0])
-	return root
+	return toBytes32(layer)
+}
+
+// splitChunks returns the chunks of a layer of a Merkle trie, sharing its memory.
+func splitChunks(layer []byte) [][]byte {
+	chunks := make([][]byte, len(layer)/BytesPerChunk)
+	for i := range chunks {
+		chunks[i] = layer[i*BytesPerChunk : (i+1)*BytesPerChunk]
+	}
+	return chunks
+}
+
+// accountLayers records the memory held by the layers and leaves cached for fieldName,
+// dropping the layers of other fields, and then of fieldName itself, while the total
+// exceeds the configured maximum.
+func (a *rootsArraySSZ) accountLayers(fieldName string) {
+	size := uint64(len(a.cachedLeaves[fieldName]) * BytesPerChunk)
+	for _, layer := range a.layers[fieldName] {
+		size += uint64(len(layer) * BytesPerChunk)
+	}
+	a.layerBytes += size - a.layerSizes[fieldName]
+	a.layerSizes[fieldName] = size
+	limit := cacheConfig.MaxLayerBytes
+	if limit == 0 || a.layerBytes <= limit {
+		return
+	}
+	for name := range a.layerSizes {
+		if name != fieldName {
+			a.dropLayers(name)
+		}
+	}
+	if a.layerBytes > limit {
+		a.dropLayers(fieldName)
+	}
+}
+
+func (a *rootsArraySSZ) dropLayers(fieldName string) {
+	a.layerBytes -= a.layerSizes[fieldName]
+	delete(a.layerSizes, fieldName)
+	delete(a.layers, fieldName)
+	delete(a.cachedLeaves, fieldName)
+}
+
+// cachedLayerBytes returns the memory held by the layers and leaves cached for every
+// field.
+func (a *rootsArraySSZ) cachedLayerBytes() uint64 {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.layerBytes
+}
+
+// clearLayers drops the layers and leaves cached for every field.
+func (a *rootsArraySSZ) clearLayers() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.cachedLeaves = make(map[string][][]byte)
+	a.layers = make(map[string][][][]byte)
+	a.layerSizes = make(map[string]uint64)
+	a.layerBytes = 0
 }
 
 func isPowerOf2(n int) bool {
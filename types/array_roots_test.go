@@ -22,7 +22,7 @@ func BenchmarkRootsArray_Root_WithCache(b *testing.B) {
 	typ := v.Type()
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		if _, err := ss.Root(v, typ, "BlockRoots", 0); err != nil {
+		if _, err := ss.root(v, typ, "BlockRoots", nil, nil); err != nil {
 			b.Fatal(err)
 		}
 	}
@@ -42,7 +42,7 @@ func BenchmarkRootsArray_Root_MinimalChanges(b *testing.B) {
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		bs.BlockRoots[i%len(bs.BlockRoots)] = [32]byte{4, 5, 6}
-		if _, err := ss.Root(v, typ, "BlockRoots", 0); err != nil {
+		if _, err := ss.root(v, typ, "BlockRoots", nil, nil); err != nil {
 			b.Fatal(err)
 		}
 	}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"reflect"
@@ -12,24 +13,23 @@ import (
 // BasicTypeCacheSize for HashTreeRoot.
 const BasicTypeCacheSize = 100000
 
+// maxUncachedBasicChunks is the number of chunks up to which the roots of basic values,
+// such as public keys and signatures, are never cached.
+const maxUncachedBasicChunks = 4
+
 type basicSSZ struct {
 	hashCache *ristretto.Cache
 	lock      sync.Mutex
 }
 
 func newBasicSSZ() *basicSSZ {
-	cache, _ := ristretto.NewCache(&ristretto.Config{
-		NumCounters: BasicTypeCacheSize, // number of keys to track frequency of (100K).
-		MaxCost:     1 << 23,            // maximum cost of cache (3MB).
-		// 100,000 roots will take up approximately 3 MB in memory.
-		BufferItems: 64, // number of keys per Get buffer.
-	})
+	cache, _ := newHashCache("basic type", DefaultCacheConfig().BasicType)
 	return &basicSSZ{
 		hashCache: cache,
 	}
 }
 
-func (b *basicSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+func (b *basicSSZ) marshal(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
 	kind := typ.Kind()
 	switch {
 	case kind == reflect.Bool:
@@ -47,18 +47,27 @@ func (b *basicSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, star
 	case kind == reflect.Array && typ.Elem().Kind() == reflect.Uint8:
 		return marshalByteArray(val, typ, buf, startOffset)
 	case kind == reflect.Array && isBasicType(typ.Elem().Kind()):
-		return b.marshalBasicArray(val, typ, buf, startOffset)
+		return b.marshalBasicArray(ctx, val, typ, buf, startOffset)
 	default:
 		return 0, fmt.Errorf("type %v is not serializable", val.Type())
 	}
 }
 
-func (b *basicSSZ) Unmarshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
-	if startOffset >= uint64(len(buf)) {
-		return 0, fmt.Errorf("startOffset %d is greater than length of input %d", startOffset, len(buf))
+func (b *basicSSZ) unmarshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64, state *DecodeState) (uint64, error) {
+	kind := typ.Kind()
+	size := determineFixedSize(val, typ)
+	// Every basic value needs its full size available in the input, which also
+	// guarantees the fixed-size reads below stay within bounds.
+	remaining := remainingBytes(buf, startOffset)
+	if remaining == 0 || (isBasicType(kind) && size > remaining) {
+		return 0, &DecodeError{
+			Offset:   startOffset,
+			Expected: size,
+			Actual:   remaining,
+			Err:      ErrShortInput,
+		}
 	}
 
-	kind := typ.Kind()
 	switch {
 	case kind == reflect.Bool:
 		return unmarshalBool(val, typ, buf, startOffset)
@@ -75,53 +84,66 @@ func (b *basicSSZ) Unmarshal(val reflect.Value, typ reflect.Type, buf []byte, st
 	case kind == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
 		return unmarshalByteArray(val, typ, buf, startOffset)
 	case kind == reflect.Array && isBasicType(typ.Elem().Kind()):
-		return basicArrayFactory.Unmarshal(val, typ, buf, startOffset)
+		return basicArrayFactory.unmarshal(val, typ, buf, startOffset, state)
 	default:
 		return 0, fmt.Errorf("type %v is not serializable", val.Type())
 	}
 }
 
-func (b *basicSSZ) Root(val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64) ([32]byte, error) {
-	var chunks [][]byte
-	var err error
-	var hashKey string
-	newVal := reflect.New(val.Type()).Elem()
-	newVal.Set(val)
+func (b *basicSSZ) root(val reflect.Value, typ reflect.Type, fieldName string, limits listLimits, state *HashState) ([32]byte, error) {
+	if state == nil {
+		state = NewHashState()
+	}
 	if val.Type().Kind() == reflect.Slice && val.IsNil() {
+		newVal := reflect.New(val.Type()).Elem()
 		newVal.Set(reflect.MakeSlice(val.Type(), typ.Len(), typ.Len()))
+		val = newVal
 	}
-	buf := make([]byte, DetermineSize(newVal))
-	if _, err := b.Marshal(newVal, typ, buf, 0); err != nil {
-		return [32]byte{}, err
-	}
-	hashKey = string(buf)
-	res, ok := b.hashCache.Get(string(hashKey))
-	if res != nil && ok {
-		return res.([32]byte), nil
-	}
-
 	// In order to find the root of a basic type, we simply marshal it,
 	// split the marshaling into chunks, and compute the most simple
 	// Merkleization over the chunks.
-	chunks, err = pack([][]byte{buf})
-	if err != nil {
+	mark := state.mark()
+	defer state.pop(mark)
+	state.pushZeroes(int(DetermineSize(val)))
+	if _, err := b.marshal(state.ctx, val, typ, state.stack, uint64(mark)); err != nil {
 		return [32]byte{}, err
 	}
-	root, err := bitwiseMerkleize(chunks, uint64(len(chunks)), uint64(len(chunks)))
+	// Values of up to maxUncachedBasicChunks chunks are hashed again rather than looked
+	// up, which costs about as much and allocates nothing.
+	size := len(state.stack) - mark
+	if size <= BytesPerChunk {
+		return toBytes32(state.stack[mark:]), nil
+	}
+	state.packChunks(mark)
+	if !cacheConfig.BasicType.Enabled || size <= maxUncachedBasicChunks*BytesPerChunk {
+		return state.merkleize(mark, state.chunks(mark))
+	}
+	hashKey := string(state.stack[mark : mark+size])
+	computeRoot := func() ([32]byte, error) {
+		return state.merkleize(mark, state.chunks(mark))
+	}
+	res, ok := b.hashCache.Get(hashKey)
+	if res != nil && ok {
+		return verifyCachedRoot(fieldName, res.([32]byte), computeRoot)
+	}
+	root, err := computeRoot()
 	if err != nil {
 		return [32]byte{}, err
 	}
-	b.hashCache.Set(string(hashKey), root, 32)
+	b.hashCache.Set(hashKey, root, 32)
 	return root, nil
 }
 
-func (b *basicSSZ) marshalBasicArray(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+func (b *basicSSZ) marshalBasicArray(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+	if enc, ok := bulkBytes(val); ok {
+		return startOffset + uint64(copy(buf[startOffset:], enc)), nil
+	}
 	index := startOffset
 	var err error
 	for i := 0; i < val.Len(); i++ {
-		index, err = b.Marshal(val.Index(i), typ.Elem(), buf, index)
+		index, err = b.marshal(ctx, val.Index(i), typ.Elem(), buf, index)
 		if err != nil {
-			return 0, err
+			return 0, annotateEncodeError(err, indexPath(i))
 		}
 	}
 	return index, nil
@@ -139,18 +161,24 @@ func marshalByteArray(val reflect.Value, typ reflect.Type, buf []byte, startOffs
 		copy(buf[startOffset:], item)
 		return startOffset + uint64(typ.Len()), nil
 	}
+	if val.Len() != typ.Len() {
+		return 0, &EncodeError{
+			Expected: uint64(typ.Len()),
+			Actual:   uint64(val.Len()),
+			Err:      ErrVectorLength,
+		}
+	}
 	copy(buf[startOffset:], val.Bytes())
 	return startOffset + uint64(val.Len()), nil
 }
 
 func unmarshalByteArray(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64) (uint64, error) {
-	offset := startOffset + uint64(len(input))
-	val.SetBytes(input[startOffset:offset])
-	return offset, nil
+	val.SetBytes(input[startOffset:])
+	return uint64(len(input)), nil
 }
 
 func marshalBool(val reflect.Value, buf []byte, startOffset uint64) (uint64, error) {
-	if val.Interface().(bool) {
+	if val.Bool() {
 		buf[startOffset] = uint8(1)
 	} else {
 		buf[startOffset] = uint8(0)
@@ -165,13 +193,13 @@ func unmarshalBool(val reflect.Value, typ reflect.Type, input []byte, startOffse
 	} else if v == 1 {
 		val.SetBool(true)
 	} else {
-		return 0, fmt.Errorf("expected 0 or 1 but received %d", v)
+		return 0, &DecodeError{Offset: startOffset, Err: ErrInvalidBool}
 	}
 	return startOffset + 1, nil
 }
 
 func marshalUint8(val reflect.Value, buf []byte, startOffset uint64) (uint64, error) {
-	buf[startOffset] = val.Interface().(uint8)
+	buf[startOffset] = uint8(val.Uint())
 	return startOffset + 1, nil
 }
 
@@ -181,7 +209,7 @@ func unmarshalUint8(val reflect.Value, typ reflect.Type, input []byte, startOffs
 }
 
 func marshalUint16(val reflect.Value, buf []byte, startOffset uint64) (uint64, error) {
-	binary.LittleEndian.PutUint16(buf[startOffset:], val.Interface().(uint16))
+	binary.LittleEndian.PutUint16(buf[startOffset:], uint16(val.Uint()))
 	return startOffset + 2, nil
 }
 
@@ -194,7 +222,7 @@ func unmarshalUint16(val reflect.Value, typ reflect.Type, input []byte, startOff
 }
 
 func marshalInt32(val reflect.Value, buf []byte, startOffset uint64) (uint64, error) {
-	binary.LittleEndian.PutUint32(buf[startOffset:], uint32(val.Interface().(int32)))
+	binary.LittleEndian.PutUint32(buf[startOffset:], uint32(val.Int()))
 	return startOffset + 4, nil
 }
 
@@ -207,7 +235,7 @@ func unmarshalInt32(val reflect.Value, typ reflect.Type, input []byte, startOffs
 }
 
 func marshalUint32(val reflect.Value, buf []byte, startOffset uint64) (uint64, error) {
-	binary.LittleEndian.PutUint32(buf[startOffset:], val.Interface().(uint32))
+	binary.LittleEndian.PutUint32(buf[startOffset:], uint32(val.Uint()))
 	return startOffset + 4, nil
 }
 
@@ -220,7 +248,7 @@ func unmarshalUint32(val reflect.Value, typ reflect.Type, input []byte, startOff
 }
 
 func marshalUint64(val reflect.Value, buf []byte, startOffset uint64) (uint64, error) {
-	binary.LittleEndian.PutUint64(buf[startOffset:], val.Interface().(uint64))
+	binary.LittleEndian.PutUint64(buf[startOffset:], val.Uint())
 	return startOffset + 8, nil
 }
 
@@ -36,6 +36,15 @@ func BitlistRoot(bfield bitfield.Bitfield, maxCapacity uint64) ([32]byte, error)
 	return mixInLength(root, output), nil
 }
 
+// bitlistFieldRoot computes the hash tree root of a bitlist held by a container field,
+// which must not hold more bits than the capacity of the field, as decoding it would fail.
+func bitlistFieldRoot(bfield bitfield.Bitlist, maxCapacity uint64) ([32]byte, error) {
+	if maxCapacity > 0 && bfield.Len() > maxCapacity {
+		return [32]byte{}, &EncodeError{Expected: maxCapacity, Actual: bfield.Len(), Err: ErrListTooLong}
+	}
+	return BitlistRoot(bfield, maxCapacity)
+}
+
 // Bitvector4Root computes the hash tree root of a bitvector4 type as outlined in the
 // Simple Serialize official specification document.
 func Bitvector4Root(bfield bitfield.Bitfield, maxCapacity uint64) ([32]byte, error) {
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// hostLittleEndian reports whether the platform stores integers in little-endian byte
+// order, the byte order of Simple Serialize, in which case the memory of a list or
+// vector of integers is its serialization.
+var hostLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// isBulkKind reports whether lists and vectors of elements of kind can be serialized
+// by copying their memory on little-endian platforms. Booleans are left out, as their
+// encoding has to be validated when decoding.
+func isBulkKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Uint8, reflect.Uint16, reflect.Int32, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// bulkBytes returns the memory of the elements of a slice or array of integers, which
+// is their serialization, or false when the elements have to be encoded one by one,
+// such as on big-endian platforms. Arrays which are not addressable are copied once.
+func bulkBytes(val reflect.Value) ([]byte, bool) {
+	if !hostLittleEndian || !isBulkKind(val.Type().Elem().Kind()) {
+		return nil, false
+	}
+	size := val.Len() * int(val.Type().Elem().Size())
+	if size == 0 {
+		return []byte{}, true
+	}
+	if val.Kind() == reflect.Array && !val.CanAddr() {
+		addressable := reflect.New(val.Type()).Elem()
+		addressable.Set(val)
+		val = addressable
+	}
+	return unsafe.Slice((*byte)(unsafe.Pointer(val.Index(0).UnsafeAddr())), size), true
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type bulkContainer struct {
+	Balances  []uint64 `ssz-max:"1024"`
+	Ports     []uint16 `ssz-max:"64"`
+	Deltas    []int32  `ssz-max:"64"`
+	Data      []byte   `ssz-max:"64"`
+	Slashings [5]uint64
+	Counts    [3]uint32
+	Flags     []bool `ssz-max:"8"`
+}
+
+func TestBulkBasicLists(t *testing.T) {
+	v := bulkContainer{
+		Balances:  []uint64{32000000000, 31999999999, 0, 1 << 63},
+		Ports:     []uint16{1, 0xff00, 9000},
+		Deltas:    []int32{-1, 0, 1 << 30},
+		Data:      []byte{1, 2, 3},
+		Slashings: [5]uint64{1, 2, 3, 4, 5},
+		Counts:    [3]uint32{7, 0, 0xffffffff},
+		Flags:     []bool{true, false},
+	}
+	typ := reflect.TypeOf(v)
+	encode := func() ([]byte, [32]byte) {
+		buf := make([]byte, determineVariableSize(reflect.ValueOf(v), typ))
+		if _, err := StructFactory.marshal(context.Background(), reflect.ValueOf(v), typ, buf, 0); err != nil {
+			t.Fatal(err)
+		}
+		root, err := StructFactory.root(reflect.ValueOf(v), typ, "", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf, root
+	}
+	enc, root := encode()
+
+	// Encode and decode element by element, as on big-endian platforms.
+	hostLittleEndian = false
+	wantEnc, wantRoot := encode()
+	var want bulkContainer
+	if _, err := StructFactory.unmarshal(reflect.ValueOf(&want).Elem(), typ, wantEnc, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	hostLittleEndian = true
+
+	if !bytes.Equal(enc, wantEnc) {
+		t.Errorf("Expected encoding %#x, received %#x", wantEnc, enc)
+	}
+	if root != wantRoot {
+		t.Errorf("Expected root %#x, received %#x", wantRoot, root)
+	}
+	var got bulkContainer
+	if _, err := StructFactory.unmarshal(reflect.ValueOf(&got).Elem(), typ, enc, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(got, v) {
+		t.Errorf("Expected decoded value %+v, received %+v", v, got)
+	}
+}
+
+func TestBulkBasicLists_SizeMismatch(t *testing.T) {
+	var got []uint64
+	_, err := basicSliceFactory.unmarshal(reflect.ValueOf(&got).Elem(), reflect.TypeOf(got), make([]byte, 12), 0, nil)
+	if !errors.Is(err, ErrSizeMismatch) {
+		t.Errorf("Expected ErrSizeMismatch, received %v", err)
+	}
+}
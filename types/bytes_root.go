@@ -0,0 +1,209 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+
+	"github.com/prysmaticlabs/go-bitfield"
+)
+
+// RootFromBytes computes the hash tree root of a value of type typ directly from its
+// SSZ encoding, without decoding it into a Go value. Basic values and vectors are
+// chunked in place, offsets are followed for variable-size parts, and lists are limited
+// by maxCapacity at the top level and by ssz-max tags below. The encoding is validated
+// before any hashing, and the root is the same as the one of the decoded value.
+func RootFromBytes(input []byte, typ reflect.Type, maxCapacity uint64) ([32]byte, error) {
+	limits := capacityLimits(maxCapacity)
+	if err := validateEncoding(input, typ, limits); err != nil {
+		return [32]byte{}, err
+	}
+	return rootFromBytes(input, derefType(typ), limits)
+}
+
+// rootFromBytes mirrors the Root implementation of the factory chosen by SSZFactory for typ,
+// over an encoding which has already been validated, applying limits to the value and to
+// the lists nested within it.
+func rootFromBytes(input []byte, typ reflect.Type, limits listLimits) ([32]byte, error) {
+	factory, err := factoryOf(reflect.Value{}, typ)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("type %v is not serializable", typ)
+	}
+	switch factory {
+	case codecFactory:
+		c, _ := codecOf(typ)
+		return c.rootFromBytes(input)
+	case basicFactory:
+		chunks, err := pack([][]byte{input})
+		if err != nil {
+			return [32]byte{}, err
+		}
+		return bitwiseMerkleize(chunks, uint64(len(chunks)), uint64(len(chunks)))
+	case stringFactory:
+		limit := (limits.outer() + 31) / 32
+		if limit == 0 {
+			limit = 1
+		}
+		return packedListRoot(input, uint64(len(input)), limit)
+	case basicSliceFactory:
+		return basicListRootFromBytes(input, typ, limits.outer())
+	case compositeSliceFactory:
+		return compositeListRootFromBytes(input, typ, limits)
+	case rootsArrayFactory:
+		numItems := len(input) / BytesPerChunk
+		if numItems == 0 {
+			return [32]byte{}, nil
+		}
+		chunks := make([][]byte, numItems)
+		for i := 0; i < numItems; i++ {
+			chunks[i] = input[i*BytesPerChunk : (i+1)*BytesPerChunk]
+		}
+		return bitwiseMerkleize(chunks, uint64(numItems), uint64(numItems))
+	case basicArrayFactory, compositeArrayFactory:
+		roots, err := elementRootsFromBytes(input, typ, limits.inner())
+		if err != nil {
+			return [32]byte{}, err
+		}
+		if isVariableSizeType(typ.Elem()) {
+			if len(roots) == 0 {
+				return bitwiseMerkleize([][]byte{}, 0, 0)
+			}
+			return bitwiseMerkleize(roots, uint64(len(roots)), uint64(len(roots)))
+		}
+		chunks, err := pack(roots)
+		if err != nil {
+			return [32]byte{}, err
+		}
+		return bitwiseMerkleize(chunks, uint64(len(chunks)), uint64(len(chunks)))
+	default:
+		return structRootFromBytes(input, typ)
+	}
+}
+
+// basicListRootFromBytes computes the root of a list of fixed-size elements. Basic
+// elements are packed straight from the input, other elements contribute their roots.
+func basicListRootFromBytes(input []byte, typ reflect.Type, maxCapacity uint64) ([32]byte, error) {
+	elem := derefType(typ.Elem())
+	numItems := encodedListLength(input, typ)
+	elemSize := uint64(BytesPerChunk)
+	if isBasicType(elem.Kind()) {
+		elemSize = determineFixedTypeSize(elem)
+	}
+	limit := (maxCapacity*elemSize + 31) / 32
+	if limit == 0 {
+		if numItems == 0 {
+			limit = 1
+		} else {
+			limit = numItems
+		}
+	}
+	if isBasicType(elem.Kind()) {
+		return packedListRoot(input, numItems, limit)
+	}
+	roots, err := elementRootsFromBytes(input, typ, nil)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	chunks, err := pack(roots)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	root, err := bitwiseMerkleize(chunks, uint64(len(chunks)), limit)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return mixInLength(root, lengthChunk(numItems)), nil
+}
+
+// compositeListRootFromBytes computes the root of a list of variable-size elements, whose
+// own nested lists are limited by the inner limits.
+func compositeListRootFromBytes(input []byte, typ reflect.Type, limits listLimits) ([32]byte, error) {
+	maxCapacity := limits.outer()
+	if len(input) == 0 && maxCapacity == 0 {
+		root, err := bitwiseMerkleize([][]byte{}, 0, 0)
+		if err != nil {
+			return [32]byte{}, err
+		}
+		return mixInLength(root, lengthChunk(0)), nil
+	}
+	roots, err := elementRootsFromBytes(input, typ, limits.inner())
+	if err != nil {
+		return [32]byte{}, err
+	}
+	chunks, err := pack(roots)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	limit := maxCapacity
+	if maxCapacity == 0 {
+		limit = uint64(len(roots))
+	}
+	root, err := bitwiseMerkleize(chunks, uint64(len(chunks)), limit)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return mixInLength(root, lengthChunk(uint64(len(roots)))), nil
+}
+
+// packedListRoot packs the encoding of a list of numItems basic elements into chunks in
+// place, and mixes the number of elements into their root.
+func packedListRoot(input []byte, numItems uint64, limit uint64) ([32]byte, error) {
+	chunks, err := pack([][]byte{input})
+	if err != nil {
+		return [32]byte{}, err
+	}
+	root, err := bitwiseMerkleize(chunks, uint64(len(chunks)), limit)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return mixInLength(root, lengthChunk(numItems)), nil
+}
+
+// elementRootsFromBytes returns the roots of every element of a list or vector, applying
+// elemLimits to each of them.
+func elementRootsFromBytes(input []byte, typ reflect.Type, elemLimits listLimits) ([][]byte, error) {
+	elem := derefType(typ.Elem())
+	numItems := encodedListLength(input, typ)
+	roots := make([][]byte, numItems)
+	for i := 0; i < int(numItems); i++ {
+		start, end, _, err := locateElement(input, typ, i)
+		if err != nil {
+			return nil, err
+		}
+		r, err := rootFromBytes(input[start:end], elem, elemLimits)
+		if err != nil {
+			return nil, annotateDecodeError(err, indexPath(i), start)
+		}
+		roots[i] = r[:]
+	}
+	return roots, nil
+}
+
+func structRootFromBytes(input []byte, typ reflect.Type) ([32]byte, error) {
+	layout, bounds, err := structBounds(input, typ)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	roots := make([][]byte, len(layout))
+	for i, item := range layout {
+		start, end := bounds[i][0], bounds[i][1]
+		fLimits := determineFieldLimits(item.field)
+		var r [32]byte
+		if item.field.Type == bitlistType && !hasCodec(item.fType) {
+			r, err = BitlistRoot(bitfield.Bitlist(input[start:end]), fLimits.outer())
+		} else {
+			r, err = rootFromBytes(input[start:end], derefType(item.fType), fLimits)
+		}
+		if err != nil {
+			return [32]byte{}, annotateDecodeError(err, item.field.Name, start)
+		}
+		roots[i] = r[:]
+	}
+	return bitwiseMerkleize(roots, uint64(len(roots)), uint64(len(roots)))
+}
+
+func lengthChunk(length uint64) []byte {
+	output := make([]byte, BytesPerChunk)
+	binary.LittleEndian.PutUint64(output, length)
+	return output
+}
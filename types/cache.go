@@ -0,0 +1,147 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/ristretto"
+)
+
+// CacheConfig configures the caches of hash tree roots kept by the factories of
+// basic types, arrays of basic types, arrays of roots and containers.
+type CacheConfig struct {
+	BasicType  FactoryCacheConfig
+	BasicArray FactoryCacheConfig
+	RootsArray FactoryCacheConfig
+	Container  FactoryCacheConfig
+	// MaxLayerBytes bounds the memory held by the Merkle layers and leaves cached for
+	// arrays of roots by field name. Once it is exceeded, the layers of other fields are
+	// dropped and rebuilt the next time those fields are hashed. Zero leaves the layers
+	// unbounded.
+	MaxLayerBytes uint64
+}
+
+// FactoryCacheConfig configures the cache of hash tree roots of a single factory.
+type FactoryCacheConfig struct {
+	Enabled bool
+	// Size is the number of keys whose access frequency is tracked to decide which
+	// roots are kept, which should be about ten times the number of roots cached.
+	Size int64
+	// MaxCost is the maximum memory in bytes held by the cached roots.
+	MaxCost int64
+}
+
+// CacheStats holds the statistics of the caches of hash tree roots since they were
+// configured or last cleared.
+type CacheStats struct {
+	BasicType  FactoryCacheStats
+	BasicArray FactoryCacheStats
+	RootsArray FactoryCacheStats
+	Container  FactoryCacheStats
+	// LayerBytes is the memory held by the Merkle layers and leaves cached for arrays
+	// of roots by field name.
+	LayerBytes uint64
+}
+
+// FactoryCacheStats holds the statistics of the cache of hash tree roots of a single
+// factory.
+type FactoryCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Cost is the memory in bytes held by the roots currently cached.
+	Cost uint64
+}
+
+var cacheConfig = DefaultCacheConfig()
+
+// DefaultCacheConfig returns the configuration the caches start with, under which only
+// the roots of basic types are cached until ToggleCache or ToggleContainerCache is called.
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		BasicType:  FactoryCacheConfig{Enabled: true, Size: BasicTypeCacheSize, MaxCost: 1 << 23},
+		BasicArray: FactoryCacheConfig{Size: BasicArraySizeCache, MaxCost: 1 << 22},
+		RootsArray: FactoryCacheConfig{Size: RootsArraySizeCache, MaxCost: 1 << 23},
+		Container:  FactoryCacheConfig{Size: ContainerCacheSize, MaxCost: 1 << 23},
+	}
+}
+
+// CurrentCacheConfig returns the configuration the caches are currently using.
+func CurrentCacheConfig() CacheConfig {
+	return cacheConfig
+}
+
+// ConfigureCache replaces the caches of hash tree roots with empty caches of the given
+// configuration. It must not be called while hash tree roots are being computed.
+func ConfigureCache(config CacheConfig) error {
+	basicCache, err := newHashCache("basic type", config.BasicType)
+	if err != nil {
+		return err
+	}
+	basicArrayCache, err := newHashCache("basic array", config.BasicArray)
+	if err != nil {
+		return err
+	}
+	rootsArrayCache, err := newHashCache("roots array", config.RootsArray)
+	if err != nil {
+		return err
+	}
+	containerCache, err := newHashCache("container", config.Container)
+	if err != nil {
+		return err
+	}
+	basicFactory.hashCache.Close()
+	basicArrayFactory.hashCache.Close()
+	rootsArrayFactory.hashCache.Close()
+	StructFactory.hashCache.Close()
+	basicFactory.hashCache = basicCache
+	basicArrayFactory.hashCache = basicArrayCache
+	rootsArrayFactory.hashCache = rootsArrayCache
+	StructFactory.hashCache = containerCache
+	rootsArrayFactory.clearLayers()
+	cacheConfig = config
+	return nil
+}
+
+// ClearCache empties the caches of hash tree roots, including the layers cached for
+// arrays of roots, and resets their statistics. It must not be called while hash tree
+// roots are being computed.
+func ClearCache() {
+	basicFactory.hashCache.Clear()
+	basicArrayFactory.hashCache.Clear()
+	rootsArrayFactory.hashCache.Clear()
+	StructFactory.hashCache.Clear()
+	rootsArrayFactory.clearLayers()
+}
+
+// Stats returns the statistics of the caches of hash tree roots.
+func Stats() CacheStats {
+	return CacheStats{
+		BasicType:  factoryCacheStats(basicFactory.hashCache),
+		BasicArray: factoryCacheStats(basicArrayFactory.hashCache),
+		RootsArray: factoryCacheStats(rootsArrayFactory.hashCache),
+		Container:  factoryCacheStats(StructFactory.hashCache),
+		LayerBytes: rootsArrayFactory.cachedLayerBytes(),
+	}
+}
+
+func newHashCache(name string, config FactoryCacheConfig) (*ristretto.Cache, error) {
+	if config.Size <= 0 || config.MaxCost <= 0 {
+		return nil, fmt.Errorf("%s cache size and max cost must be positive, received %d and %d", name, config.Size, config.MaxCost)
+	}
+	return ristretto.NewCache(&ristretto.Config{
+		NumCounters: config.Size,
+		MaxCost:     config.MaxCost,
+		BufferItems: 64, // number of keys per Get buffer.
+		Metrics:     true,
+	})
+}
+
+func factoryCacheStats(cache *ristretto.Cache) FactoryCacheStats {
+	metrics := cache.Metrics
+	return FactoryCacheStats{
+		Hits:      metrics.Hits(),
+		Misses:    metrics.Misses(),
+		Evictions: metrics.KeysEvicted(),
+		Cost:      metrics.CostAdded() - metrics.CostEvicted(),
+	}
+}
@@ -0,0 +1,148 @@
+package types
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConfigureCache_InvalidConfig(t *testing.T) {
+	config := DefaultCacheConfig()
+	config.Container.Size = 0
+	if err := ConfigureCache(config); err == nil {
+		t.Error("Expected error configuring cache of size zero")
+	}
+	if CurrentCacheConfig() != DefaultCacheConfig() {
+		t.Error("Expected invalid configuration to leave the caches untouched")
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	config := DefaultCacheConfig()
+	config.Container.Enabled = true
+	if err := ConfigureCache(config); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ConfigureCache(DefaultCacheConfig()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	v := cachedContainer{Epoch: 1, Roots: [][]byte{make([]byte, 32), make([]byte, 32)}, Data: []byte{1}}
+	// Roots are admitted to the cache asynchronously, so hash until one is served from it.
+	for i := 0; i < 100 && Stats().Container.Hits == 0; i++ {
+		if _, err := StructFactory.root(reflect.ValueOf(v), reflect.TypeOf(v), "", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := Stats()
+	if stats.Container.Hits == 0 || stats.Container.Misses == 0 {
+		t.Errorf("Expected container cache hits and misses, received %+v", stats.Container)
+	}
+	if stats.Container.Cost == 0 {
+		t.Error("Expected cached container roots to have a cost")
+	}
+	ClearCache()
+	if stats := Stats(); stats.Container != (FactoryCacheStats{}) {
+		t.Errorf("Expected cleared cache statistics, received %+v", stats.Container)
+	}
+}
+
+func TestCacheStats_LayerBytes(t *testing.T) {
+	config := DefaultCacheConfig()
+	config.RootsArray.Enabled = true
+	if err := ConfigureCache(config); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ConfigureCache(DefaultCacheConfig()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	// Distinct arrays, so that neither root is served from the cache of roots.
+	fields := map[string][4][32]byte{
+		"BlockRoots": {{1}, {2}, {3}, {4}},
+		"StateRoots": {{5}, {6}, {7}, {8}},
+	}
+	// The 4 leaves of an array, and its layers of 4, 2 and 1 nodes.
+	arrayBytes := uint64(11 * BytesPerChunk)
+	for _, field := range []string{"BlockRoots", "StateRoots"} {
+		roots := fields[field]
+		if _, err := rootsArrayFactory.root(reflect.ValueOf(roots), reflect.TypeOf(roots), field, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := Stats().LayerBytes; got != 2*arrayBytes {
+		t.Errorf("Expected %d bytes of layers, received %d", 2*arrayBytes, got)
+	}
+	ClearCache()
+	if got := Stats().LayerBytes; got != 0 {
+		t.Errorf("Expected no layers after clearing the cache, received %d bytes", got)
+	}
+
+	// Room for the layers of a single array.
+	config.MaxLayerBytes = arrayBytes
+	if err := ConfigureCache(config); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"BlockRoots", "StateRoots"} {
+		roots := fields[field]
+		if _, err := rootsArrayFactory.root(reflect.ValueOf(roots), reflect.TypeOf(roots), field, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := Stats().LayerBytes; got != arrayBytes {
+		t.Errorf("Expected %d bytes of layers, received %d", arrayBytes, got)
+	}
+	if _, ok := rootsArrayFactory.layers["BlockRoots"]; ok {
+		t.Error("Expected layers of the least recently hashed field to be dropped")
+	}
+}
+
+func TestCacheStats_WhileComputingRoots(t *testing.T) {
+	type blockRoots struct {
+		BlockRoots [64][32]byte
+	}
+	type stateRoots struct {
+		StateRoots [64][32]byte
+	}
+	config := DefaultCacheConfig()
+	config.RootsArray.Enabled = true
+	// Room for the 64 leaves and 127 layer nodes of a single field, so that hashing
+	// one field drops the layers of the other and layers keep being accounted for.
+	config.MaxLayerBytes = (64 + 127) * uint64(BytesPerChunk)
+	if err := ConfigureCache(config); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ConfigureCache(DefaultCacheConfig()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				var v interface{} = blockRoots{BlockRoots: [64][32]byte{{byte(i), byte(j)}}}
+				if j%2 == 1 {
+					v = stateRoots{StateRoots: [64][32]byte{{byte(i), byte(j)}}}
+				}
+				if _, err := StructFactory.root(reflect.ValueOf(v), reflect.TypeOf(v), "", nil, nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	// Monitoring polls the statistics while roots are being computed.
+	for i := 0; i < 1000; i++ {
+		if got := Stats().LayerBytes; got > config.MaxLayerBytes {
+			t.Errorf("Expected at most %d bytes of layers, received %d", config.MaxLayerBytes, got)
+		}
+	}
+	wg.Wait()
+}
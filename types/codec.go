@@ -0,0 +1,337 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec encodes, decodes and hashes values of a type go-ssz cannot walk by reflection,
+// or cannot be given methods, such as types of other packages. Codecs are registered for
+// a type with RegisterCodec, or under a name with RegisterNamedCodec for the fields
+// tagged with it, as in `ssz-codec:"name"`. Values are handed to a codec as values of the
+// type it was registered for, which may be nil pointers, or as values of the tagged field.
+type Codec interface {
+	// IsVariableSSZ reports whether values are variable-size, taking an offset in the
+	// fixed-size part of the containers and lists holding them.
+	IsVariableSSZ() bool
+	// FixedSizeSSZ returns the size of the encoding of every value of a fixed-size type.
+	FixedSizeSSZ() uint64
+	// SizeSSZ returns the size of the encoding of v.
+	SizeSSZ(v interface{}) uint64
+	// MarshalSSZTo appends the encoding of v to dst.
+	MarshalSSZTo(dst []byte, v interface{}) ([]byte, error)
+	// UnmarshalSSZ decodes a value from the whole of buf.
+	UnmarshalSSZ(buf []byte) (interface{}, error)
+	// HashTreeRootSSZ returns the hash tree root of v.
+	HashTreeRootSSZ(v interface{}) ([32]byte, error)
+}
+
+// registeredCodec is a codec along with its layout, which is read once.
+type registeredCodec struct {
+	codec Codec
+	// typ is the type the codec was registered for, which values are converted to,
+	// or nil for named codecs, which are handed the values of tagged fields as they are.
+	typ       reflect.Type
+	variable  bool
+	fixedSize uint64
+}
+
+var (
+	// codecs maps types to their codecs, and types without codecs to nil once they
+	// have been looked up. Pointer types are looked up by the type they point to.
+	codecs sync.Map
+	// namedCodecs maps the names of ssz-codec tags to codecs.
+	namedCodecs sync.Map
+	// codecFieldTypes maps the types fields tagged with codecs are given to the name
+	// of their codec, and codecFieldKeys maps them back from their field type and name.
+	codecFieldTypes sync.Map
+	codecFieldKeys  sync.Map
+)
+
+// RegisterCodec makes values of typ, and pointers to them, be encoded, decoded and hashed
+// by codec wherever they are nested, replacing any codec registered for typ before. Types
+// of basic kinds cannot have codecs, as basic values are packed into chunks along with the
+// values next to them rather than hashed on their own. Codecs have to be registered before
+// values of their types are first encoded, decoded or hashed, such as in init functions.
+func RegisterCodec(typ reflect.Type, codec Codec) error {
+	if typ == nil || codec == nil {
+		return errors.New("cannot register a nil codec or type")
+	}
+	if isBasicType(derefType(typ).Kind()) {
+		return fmt.Errorf("cannot register a codec for basic type %v", typ)
+	}
+	codecs.Store(derefType(typ), newRegisteredCodec(codec, typ))
+	return nil
+}
+
+// RegisterNamedCodec makes the fields tagged with `ssz-codec:"name"` be encoded, decoded
+// and hashed by codec, replacing any codec registered under name before. Codecs have to
+// be registered before the containers holding tagged fields are first used.
+func RegisterNamedCodec(name string, codec Codec) error {
+	if name == "" || codec == nil {
+		return errors.New("cannot register a nil codec or a codec without a name")
+	}
+	namedCodecs.Store(name, newRegisteredCodec(codec, nil))
+	return nil
+}
+
+func newRegisteredCodec(codec Codec, typ reflect.Type) *registeredCodec {
+	return &registeredCodec{
+		codec:     codec,
+		typ:       typ,
+		variable:  codec.IsVariableSSZ(),
+		fixedSize: codec.FixedSizeSSZ(),
+	}
+}
+
+// codecOf returns the codec values of typ are handled by: a codec registered for typ or
+// named by the tag of a field of typ, or the methods of a custom type.
+func codecOf(typ reflect.Type) (*registeredCodec, bool) {
+	typ = derefType(typ)
+	if isBasicType(typ.Kind()) {
+		return nil, false
+	}
+	if typ.PkgPath() == "" {
+		// Types declared outside of a package have no methods of their own, and only
+		// have codecs when given to fields tagged with them.
+		if typ.Kind() != reflect.Struct || typ.Name() != "" {
+			return nil, false
+		}
+		if name, ok := codecFieldTypes.Load(typ); ok {
+			if c, ok := namedCodecs.Load(name); ok {
+				return c.(*registeredCodec), true
+			}
+		}
+		return nil, false
+	}
+	if c, ok := codecs.Load(typ); ok {
+		if c == nil {
+			return nil, false
+		}
+		return c.(*registeredCodec), true
+	}
+	var c interface{}
+	if reflect.PtrTo(typ).Implements(customTypeType) {
+		c = newRegisteredCodec(customCodec{typ: typ}, reflect.PtrTo(typ))
+	}
+	// A codec registered meanwhile takes precedence over the methods of the type.
+	actual, _ := codecs.LoadOrStore(typ, c)
+	if actual == nil {
+		return nil, false
+	}
+	return actual.(*registeredCodec), true
+}
+
+// hasCodec reports whether values of typ are handled by a codec, which makes them opaque:
+// they are sized, validated and hashed as a whole, and nothing can be selected within them.
+func hasCodec(typ reflect.Type) bool {
+	_, ok := codecOf(typ)
+	return ok
+}
+
+// codecFieldType returns the type given to fields of type fieldType tagged with the
+// codec called name, which is distinct for every field type and name, so that the
+// codec is found from the type of the field wherever it is used.
+func codecFieldType(fieldType reflect.Type, name string) reflect.Type {
+	type codecFieldKey struct {
+		typ  reflect.Type
+		name string
+	}
+	key := codecFieldKey{typ: fieldType, name: name}
+	if typ, ok := codecFieldKeys.Load(key); ok {
+		return typ.(reflect.Type)
+	}
+	typ := reflect.StructOf([]reflect.StructField{{
+		Name: "Value",
+		Type: fieldType,
+		Tag:  reflect.StructTag(fmt.Sprintf("ssz-codec:%q", name)),
+	}})
+	codecFieldTypes.Store(typ, name)
+	actual, _ := codecFieldKeys.LoadOrStore(key, typ)
+	return actual.(reflect.Type)
+}
+
+// fieldCodecName returns the name of the codec a field is tagged with.
+func fieldCodecName(field reflect.StructField) (string, bool, error) {
+	name, ok := field.Tag.Lookup("ssz-codec")
+	if !ok {
+		return "", false, nil
+	}
+	if _, registered := namedCodecs.Load(name); !registered {
+		return "", false, fmt.Errorf("no codec registered under name %q", name)
+	}
+	return name, true, nil
+}
+
+// unwrapCodecFieldType returns the type of the field a codec field type was made for,
+// and any other type as it is.
+func unwrapCodecFieldType(typ reflect.Type) reflect.Type {
+	if _, ok := codecFieldTypes.Load(typ); ok {
+		return typ.Field(0).Type
+	}
+	return typ
+}
+
+// value returns what val is handed to the codec as, a value of the type the codec was
+// registered for. Values are addressed, through a copy when they are not addressable,
+// for codecs of pointer types, and nil pointers are replaced by empty values for codecs
+// of the types they point to.
+func (c *registeredCodec) value(val reflect.Value) interface{} {
+	switch {
+	case c.typ == nil || val.Type() == c.typ:
+		return val.Interface()
+	case c.typ.Kind() == reflect.Ptr && c.typ.Elem() == val.Type():
+		if val.CanAddr() {
+			return val.Addr().Interface()
+		}
+		addressable := reflect.New(val.Type())
+		addressable.Elem().Set(val)
+		return addressable.Interface()
+	case val.Kind() == reflect.Ptr && val.IsNil():
+		return c.value(reflect.New(val.Type().Elem()).Elem())
+	default:
+		return c.value(val.Elem())
+	}
+}
+
+// set stores a value decoded by the codec into val, converting it from a value of the
+// type the codec was registered for.
+func (c *registeredCodec) set(val reflect.Value, decoded interface{}) error {
+	result := reflect.ValueOf(decoded)
+	for {
+		switch {
+		case !result.IsValid():
+			val.Set(reflect.Zero(val.Type()))
+			return nil
+		case result.Type() == val.Type():
+			val.Set(result)
+			return nil
+		case result.Kind() == reflect.Ptr && result.Type().Elem() == val.Type():
+			if result.IsNil() {
+				result = reflect.Value{}
+				continue
+			}
+			val.Set(result.Elem())
+			return nil
+		case val.Kind() == reflect.Ptr:
+			if val.IsNil() {
+				instantiateConcreteTypeForElement(val, val.Type().Elem())
+			}
+			val = val.Elem()
+		default:
+			return fmt.Errorf("codec decoded %v, which cannot be stored into %v", result.Type(), val.Type())
+		}
+	}
+}
+
+func (c *registeredCodec) size(val reflect.Value) uint64 {
+	return c.codec.SizeSSZ(c.value(val))
+}
+
+// rootFromBytes decodes the encoding of a value and returns its root.
+func (c *registeredCodec) rootFromBytes(input []byte) ([32]byte, error) {
+	v, err := c.codec.UnmarshalSSZ(input)
+	if err != nil {
+		return [32]byte{}, &DecodeError{Err: err}
+	}
+	return c.codec.HashTreeRootSSZ(v)
+}
+
+// validate checks input decodes as a value, which is opaque to everything but its codec.
+func (c *registeredCodec) validate(input []byte) error {
+	if _, err := c.codec.UnmarshalSSZ(input); err != nil {
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+type codecSSZ struct{}
+
+func newCodecSSZ() *codecSSZ {
+	return &codecSSZ{}
+}
+
+func (b *codecSSZ) root(val reflect.Value, typ reflect.Type, fieldName string, limits listLimits, state *HashState) ([32]byte, error) {
+	c, ok := codecOf(typ)
+	if !ok {
+		return [32]byte{}, fmt.Errorf("type %v has no codec", typ)
+	}
+	if state != nil {
+		if err := state.checkContext(); err != nil {
+			return [32]byte{}, err
+		}
+	}
+	return c.codec.HashTreeRootSSZ(c.value(val))
+}
+
+func (b *codecSSZ) marshal(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+	c, ok := codecOf(typ)
+	if !ok {
+		return 0, fmt.Errorf("type %v has no codec", typ)
+	}
+	if err := checkContext(ctx); err != nil {
+		return 0, err
+	}
+	v := c.value(val)
+	size := c.codec.SizeSSZ(v)
+	if startOffset > uint64(len(buf)) || size > uint64(len(buf))-startOffset {
+		return 0, &EncodeError{
+			Expected: size,
+			Actual:   remainingBytes(buf, startOffset),
+			Err:      ErrSizeMismatch,
+		}
+	}
+	// The encoding is appended in place, as the buffer is sized for it.
+	enc, err := c.codec.MarshalSSZTo(buf[startOffset:startOffset:startOffset+size], v)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(len(enc)) != size {
+		return 0, &EncodeError{
+			Expected: size,
+			Actual:   uint64(len(enc)),
+			Err:      ErrSizeMismatch,
+		}
+	}
+	copy(buf[startOffset:], enc)
+	return startOffset + size, nil
+}
+
+func (b *codecSSZ) unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64, state *DecodeState) (uint64, error) {
+	c, ok := codecOf(typ)
+	if !ok {
+		return 0, fmt.Errorf("type %v has no codec", typ)
+	}
+	if err := state.enter(startOffset); err != nil {
+		return 0, err
+	}
+	defer state.leave()
+	if startOffset > uint64(len(input)) {
+		return 0, &DecodeError{Offset: startOffset, Err: ErrOffsetOutOfRange}
+	}
+	// Variable-size values are handed the input up to the next offset, while
+	// fixed-size ones are decoded from their share of it.
+	endOffset := uint64(len(input))
+	if !c.variable {
+		if c.fixedSize > endOffset-startOffset {
+			return 0, &DecodeError{
+				Offset:   startOffset,
+				Expected: c.fixedSize,
+				Actual:   remainingBytes(input, startOffset),
+				Err:      ErrShortInput,
+			}
+		}
+		endOffset = startOffset + c.fixedSize
+	}
+	decoded, err := c.codec.UnmarshalSSZ(input[startOffset:endOffset])
+	if err != nil {
+		return 0, &DecodeError{Offset: startOffset, Err: err}
+	}
+	if err := c.set(val, decoded); err != nil {
+		return 0, &DecodeError{Offset: startOffset, Err: err}
+	}
+	return endOffset, nil
+}
@@ -0,0 +1,87 @@
+package types
+
+import (
+	"reflect"
+)
+
+// Marshaler is implemented by custom types which encode themselves. SizeSSZ returns the
+// length of the encoding of the value, and MarshalSSZTo appends the encoding to dst.
+type Marshaler interface {
+	SizeSSZ() int
+	MarshalSSZTo(dst []byte) ([]byte, error)
+}
+
+// Unmarshaler is implemented by custom types which decode themselves from the whole of buf.
+type Unmarshaler interface {
+	UnmarshalSSZ(buf []byte) error
+}
+
+// HashRooter is implemented by custom types which compute their own hash tree root.
+type HashRooter interface {
+	HashTreeRootSSZ() ([32]byte, error)
+}
+
+// Layout is implemented by custom types to describe where they sit in the encoding of
+// the containers and lists holding them. It is called on empty values. Variable-size
+// types take an offset in the fixed-size part of their parent, while fixed-size types
+// take FixedSizeSSZ bytes, which must be the SizeSSZ of every value.
+type Layout interface {
+	IsVariableSSZ() bool
+	FixedSizeSSZ() uint64
+}
+
+// CustomType is implemented by types which are encoded, decoded and hashed by their own
+// methods rather than by reflection, such as wrappers around external types. Custom
+// types are opaque: they are sized, validated and hashed as a whole wherever they are
+// nested, and fields or elements cannot be selected within them. Types of basic kinds,
+// such as named integers, are never custom, as basic values are packed into chunks
+// along with the values next to them rather than hashed on their own.
+type CustomType interface {
+	Marshaler
+	Unmarshaler
+	HashRooter
+	Layout
+}
+
+var customTypeType = reflect.TypeOf((*CustomType)(nil)).Elem()
+
+// customCodec hands the values of a custom type to their own methods.
+type customCodec struct {
+	typ reflect.Type
+}
+
+// custom returns v as a custom type, which is an empty value for nil pointers.
+func (c customCodec) custom(v interface{}) CustomType {
+	if rv := reflect.ValueOf(v); rv.IsNil() {
+		return reflect.New(c.typ).Interface().(CustomType)
+	}
+	return v.(CustomType)
+}
+
+func (c customCodec) IsVariableSSZ() bool {
+	return reflect.New(c.typ).Interface().(CustomType).IsVariableSSZ()
+}
+
+func (c customCodec) FixedSizeSSZ() uint64 {
+	return reflect.New(c.typ).Interface().(CustomType).FixedSizeSSZ()
+}
+
+func (c customCodec) SizeSSZ(v interface{}) uint64 {
+	return uint64(c.custom(v).SizeSSZ())
+}
+
+func (c customCodec) MarshalSSZTo(dst []byte, v interface{}) ([]byte, error) {
+	return c.custom(v).MarshalSSZTo(dst)
+}
+
+func (c customCodec) UnmarshalSSZ(buf []byte) (interface{}, error) {
+	v := reflect.New(c.typ).Interface().(CustomType)
+	if err := v.UnmarshalSSZ(buf); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (c customCodec) HashTreeRootSSZ(v interface{}) ([32]byte, error) {
+	return c.custom(v).HashTreeRootSSZ()
+}
@@ -0,0 +1,191 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// ErrLimitExceeded is matched by every LimitError, allowing callers to check
+// for any exceeded decoding limit with errors.Is.
+var ErrLimitExceeded = errors.New("decoding limit exceeded")
+
+// DecodeOptions bounds the resources a single decoding call may use, so that a small
+// malicious payload cannot make the decoder allocate large amounts of memory or recurse
+// arbitrarily deep. A zero value for any of the limits means the limit is not enforced.
+// It also sets how many goroutines large lists may be decoded on.
+type DecodeOptions struct {
+	// MaxAllocation bounds the total number of bytes allocated for lists, vectors
+	// backed by slices and strings while decoding.
+	MaxAllocation uint64
+	// MaxListLength bounds the number of elements of any single list decoded
+	// from the input.
+	MaxListLength uint64
+	// MaxDepth bounds how deeply containers, lists and vectors may be nested.
+	MaxDepth uint64
+	// Workers is the number of goroutines lists of fixed-size containers, such as
+	// validator lists, are split across and decoded on. Lists are decoded serially
+	// when it is zero or one.
+	Workers int
+	// MinParallelLength is the length from which lists are decoded in parallel when
+	// Workers is set, DefaultMinParallelLength when zero.
+	MinParallelLength uint64
+}
+
+// DefaultMinParallelLength is the length from which lists of fixed-size containers are
+// decoded in parallel by default, below which starting workers costs more than it saves.
+const DefaultMinParallelLength = 1024
+
+// LimitError is the cause of a DecodeError returned when decoding would exceed
+// one of the limits set in DecodeOptions.
+type LimitError struct {
+	Limit     string
+	Max       uint64
+	Requested uint64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s of %d exceeded, requested %d", e.Limit, e.Max, e.Requested)
+}
+
+// Is reports whether target is ErrLimitExceeded.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// DecodeState tracks the resources used by a single decoding call against its
+// options, and the context the call is cancelled with. It is threaded through every
+// factory's Unmarshal, and a nil state enforces no limits.
+type DecodeState struct {
+	ctx       context.Context
+	opts      DecodeOptions
+	allocated uint64
+	depth     uint64
+}
+
+// NewDecodeState returns the state for a decoding call bounded by opts.
+func NewDecodeState(opts DecodeOptions) *DecodeState {
+	return &DecodeState{opts: opts}
+}
+
+// NewDecodeStateContext returns the state for a decoding call bounded by opts, which
+// stops with the error of ctx at the next container or list once ctx is done.
+func NewDecodeStateContext(ctx context.Context, opts DecodeOptions) *DecodeState {
+	return &DecodeState{ctx: ctx, opts: opts}
+}
+
+// workerState returns the state of a goroutine decoding part of a list whose limits
+// were enforced already, which only carries the context of the call.
+func (s *DecodeState) workerState() *DecodeState {
+	if s == nil || s.ctx == nil {
+		return nil
+	}
+	return &DecodeState{ctx: s.ctx}
+}
+
+// enter records that decoding descends into a nested value, failing if this
+// would exceed the maximum depth or the context of the call is done. Each successful
+// call must be paired with leave.
+func (s *DecodeState) enter(offset uint64) error {
+	if s == nil {
+		return nil
+	}
+	if s.ctx != nil {
+		if err := checkContext(s.ctx); err != nil {
+			return &DecodeError{Offset: offset, Err: err}
+		}
+	}
+	if s.opts.MaxDepth > 0 && s.depth+1 > s.opts.MaxDepth {
+		return s.limitError("MaxDepth", s.opts.MaxDepth, s.depth+1, offset)
+	}
+	s.depth++
+	return nil
+}
+
+func (s *DecodeState) leave() {
+	if s == nil {
+		return
+	}
+	s.depth--
+}
+
+// allocate accounts for a list of length elements of typ about to be allocated,
+// failing before anything is allocated if this would exceed the limits.
+func (s *DecodeState) allocate(typ reflect.Type, length uint64, offset uint64) error {
+	if s == nil {
+		return nil
+	}
+	if s.opts.MaxListLength > 0 && length > s.opts.MaxListLength {
+		return s.limitError("MaxListLength", s.opts.MaxListLength, length, offset)
+	}
+	return s.allocateElements(typ, length, offset)
+}
+
+// allocateElements accounts for the memory of length elements of typ about to be
+// allocated, regardless of the list length limit.
+func (s *DecodeState) allocateElements(typ reflect.Type, length uint64, offset uint64) error {
+	if s == nil {
+		return nil
+	}
+	size := uint64(typ.Size())
+	if typ.Kind() == reflect.Ptr {
+		// Pointer elements are instantiated along with the list.
+		size += uint64(typ.Elem().Size())
+	}
+	if size != 0 && length > math.MaxUint64/size {
+		return s.limitError("MaxAllocation", s.opts.MaxAllocation, math.MaxUint64, offset)
+	}
+	return s.allocateBytes(length*size, offset)
+}
+
+// allocatedBytes returns the number of bytes accounted for so far.
+func (s *DecodeState) allocatedBytes() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.allocated
+}
+
+// allocateBytes accounts for size bytes about to be allocated.
+func (s *DecodeState) allocateBytes(size uint64, offset uint64) error {
+	if s == nil {
+		return nil
+	}
+	if s.opts.MaxAllocation > 0 && s.allocated+size > s.opts.MaxAllocation {
+		return s.limitError("MaxAllocation", s.opts.MaxAllocation, s.allocated+size, offset)
+	}
+	s.allocated += size
+	return nil
+}
+
+// parallelWorkers returns the number of goroutines a list of length fixed-size
+// containers is decoded on, which is one for lists decoded serially.
+func (s *DecodeState) parallelWorkers(length uint64) int {
+	if s == nil || s.opts.Workers <= 1 {
+		return 1
+	}
+	minLength := s.opts.MinParallelLength
+	if minLength == 0 {
+		minLength = DefaultMinParallelLength
+	}
+	if length < minLength {
+		return 1
+	}
+	if uint64(s.opts.Workers) > length {
+		return int(length)
+	}
+	return s.opts.Workers
+}
+
+func (s *DecodeState) limitError(limit string, max uint64, requested uint64, offset uint64) error {
+	return &DecodeError{
+		Offset: offset,
+		Err: &LimitError{
+			Limit:     limit,
+			Max:       max,
+			Requested: requested,
+		},
+	}
+}
@@ -3,6 +3,7 @@ package types
 import (
 	"reflect"
 	"strings"
+	"sync"
 )
 
 // DetermineSize returns the required byte size of a buffer for
@@ -30,21 +31,62 @@ func isBasicType(kind reflect.Kind) bool {
 }
 
 func isBasicTypeArray(typ reflect.Type, kind reflect.Kind) bool {
-	return kind == reflect.Array && isBasicType(typ.Elem().Kind())
+	return kind == reflect.Array && isBasicType(typ.Elem().Kind()) && !hasCodec(typ)
 }
 
 func isRootsArray(val reflect.Value, typ reflect.Type) bool {
 	elemTyp := typ.Elem()
 	elemKind := elemTyp.Kind()
 	isByteArray := elemKind == reflect.Array && elemTyp.Elem().Kind() == reflect.Uint8
-	return isByteArray && elemTyp.Len() == 32
+	return isByteArray && elemTyp.Len() == 32 && !hasCodec(elemTyp)
+}
+
+// isProtobufMetadataField reports whether a container field holds protobuf metadata,
+// such as XXX_unrecognized, which is not part of the SSZ encoding or root of the
+// container.
+func isProtobufMetadataField(field reflect.StructField) bool {
+	return strings.Contains(field.Name, "XXX_")
+}
+
+// variableSizeTypes maps types to whether they are variable-size, which is looked up for
+// every element of lists, so that their codecs are looked up once per type.
+var variableSizeTypes sync.Map
+
+func isVariableSizeStruct(typ reflect.Type) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		if isProtobufMetadataField(typ.Field(i)) {
+			continue
+		}
+		f := typ.Field(i)
+		fType, err := determineFieldType(f)
+		if err != nil {
+			return false
+		}
+		if isVariableSizeType(fType) {
+			return true
+		}
+	}
+	return false
 }
 
 func isVariableSizeType(typ reflect.Type) bool {
+	if isBasicType(typ.Kind()) {
+		return false
+	}
+	if variable, ok := variableSizeTypes.Load(typ); ok {
+		return variable.(bool)
+	}
+	variable := resolveVariableSize(typ)
+	variableSizeTypes.Store(typ, variable)
+	return variable
+}
+
+func resolveVariableSize(typ reflect.Type) bool {
+	if c, ok := codecOf(typ); ok {
+		return c.variable
+	}
 	kind := typ.Kind()
 	switch {
-	case isBasicType(kind):
-		return false
 	case isBasicTypeArray(typ, kind):
 		return false
 	case kind == reflect.Slice:
@@ -54,20 +96,7 @@ func isVariableSizeType(typ reflect.Type) bool {
 	case kind == reflect.Array:
 		return isVariableSizeType(typ.Elem())
 	case kind == reflect.Struct:
-		for i := 0; i < typ.NumField(); i++ {
-			if strings.Contains(typ.Field(i).Name, "XXX_") {
-				continue
-			}
-			f := typ.Field(i)
-			fType, err := determineFieldType(f)
-			if err != nil {
-				return false
-			}
-			if isVariableSizeType(fType) {
-				return true
-			}
-		}
-		return false
+		return isVariableSizeStruct(typ)
 	case kind == reflect.Ptr:
 		return isVariableSizeType(typ.Elem())
 	}
@@ -75,6 +104,14 @@ func isVariableSizeType(typ reflect.Type) bool {
 }
 
 func determineFixedSize(val reflect.Value, typ reflect.Type) uint64 {
+	if c, ok := codecOf(typ); ok {
+		return c.fixedSize
+	}
+	return fixedSizeOf(val, typ)
+}
+
+// fixedSizeOf returns the size of a fixed-size value whose type has no codec.
+func fixedSizeOf(val reflect.Value, typ reflect.Type) uint64 {
 	kind := typ.Kind()
 	switch {
 	case kind == reflect.Bool:
@@ -92,15 +129,11 @@ func determineFixedSize(val reflect.Value, typ reflect.Type) uint64 {
 	case kind == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
 		return uint64(val.Len())
 	case kind == reflect.Array || kind == reflect.Slice:
-		var num uint64
-		for i := 0; i < val.Len(); i++ {
-			num += determineFixedSize(val.Index(i), typ.Elem())
-		}
-		return num
+		return determineElemsSize(val, typ.Elem())
 	case kind == reflect.Struct:
 		totalSize := uint64(0)
 		for i := 0; i < typ.NumField(); i++ {
-			if strings.Contains(typ.Field(i).Name, "XXX_") {
+			if isProtobufMetadataField(typ.Field(i)) {
 				continue
 			}
 			f := typ.Field(i)
@@ -114,15 +147,62 @@ func determineFixedSize(val reflect.Value, typ reflect.Type) uint64 {
 	case kind == reflect.Ptr:
 		if val.IsNil() {
 			newElem := reflect.New(typ.Elem()).Elem()
-			return determineVariableSize(newElem, newElem.Type())
+			return variableSizeOf(newElem, newElem.Type())
 		}
-		return determineFixedSize(val.Elem(), typ.Elem())
+		return fixedSizeOf(val.Elem(), typ.Elem())
+	default:
+		return 0
+	}
+}
+
+// determineFixedTypeSize returns the encoded size of a fixed-size type from the type
+// alone. Unlike determineFixedSize, it follows ssz-size tags of nested fields instead
+// of the lengths of the slices in a value, which are empty in a freshly created value.
+func determineFixedTypeSize(typ reflect.Type) uint64 {
+	if c, ok := codecOf(typ); ok {
+		return c.fixedSize
+	}
+	kind := typ.Kind()
+	switch {
+	case kind == reflect.Bool || kind == reflect.Uint8:
+		return 1
+	case kind == reflect.Uint16:
+		return 2
+	case kind == reflect.Uint32 || kind == reflect.Int32:
+		return 4
+	case kind == reflect.Uint64:
+		return 8
+	case kind == reflect.Array:
+		return uint64(typ.Len()) * determineFixedTypeSize(typ.Elem())
+	case kind == reflect.Struct:
+		totalSize := uint64(0)
+		for i := 0; i < typ.NumField(); i++ {
+			if isProtobufMetadataField(typ.Field(i)) {
+				continue
+			}
+			fType, err := determineFieldType(typ.Field(i))
+			if err != nil {
+				return 0
+			}
+			totalSize += determineFixedTypeSize(fType)
+		}
+		return totalSize
+	case kind == reflect.Ptr:
+		return determineFixedTypeSize(typ.Elem())
 	default:
 		return 0
 	}
 }
 
 func determineVariableSize(val reflect.Value, typ reflect.Type) uint64 {
+	if c, ok := codecOf(typ); ok {
+		return c.size(val)
+	}
+	return variableSizeOf(val, typ)
+}
+
+// variableSizeOf returns the size of a value whose type has no codec.
+func variableSizeOf(val reflect.Value, typ reflect.Type) uint64 {
 	kind := typ.Kind()
 	switch {
 	case kind == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
@@ -130,20 +210,11 @@ func determineVariableSize(val reflect.Value, typ reflect.Type) uint64 {
 	case kind == reflect.String:
 		return uint64(val.Len())
 	case kind == reflect.Slice || kind == reflect.Array:
-		totalSize := uint64(0)
-		for i := 0; i < val.Len(); i++ {
-			varSize := DetermineSize(val.Index(i))
-			if isVariableSizeType(typ.Elem()) {
-				totalSize += varSize + BytesPerLengthOffset
-			} else {
-				totalSize += varSize
-			}
-		}
-		return totalSize
+		return determineElemsSize(val, typ.Elem())
 	case kind == reflect.Struct:
 		totalSize := uint64(0)
 		for i := 0; i < typ.NumField(); i++ {
-			if strings.Contains(typ.Field(i).Name, "XXX_") {
+			if isProtobufMetadataField(typ.Field(i)) {
 				continue
 			}
 			f := typ.Field(i)
@@ -163,10 +234,32 @@ func determineVariableSize(val reflect.Value, typ reflect.Type) uint64 {
 	case kind == reflect.Ptr:
 		if val.IsNil() {
 			newElem := reflect.New(typ.Elem()).Elem()
-			return determineVariableSize(newElem, newElem.Type())
+			return variableSizeOf(newElem, newElem.Type())
 		}
-		return determineVariableSize(val.Elem(), val.Elem().Type())
+		return variableSizeOf(val.Elem(), val.Elem().Type())
 	default:
 		return 0
 	}
 }
+
+// determineElemsSize returns the size of the elements of a list or vector, looking up the
+// codec of their type and whether it is variable-size once rather than for every element.
+func determineElemsSize(val reflect.Value, elemTyp reflect.Type) uint64 {
+	c, hasElemCodec := codecOf(elemTyp)
+	variable := isVariableSizeType(elemTyp)
+	totalSize := uint64(0)
+	for i := 0; i < val.Len(); i++ {
+		elem := val.Index(i)
+		switch {
+		case hasElemCodec && variable:
+			totalSize += c.size(elem) + BytesPerLengthOffset
+		case hasElemCodec:
+			totalSize += c.fixedSize
+		case variable:
+			totalSize += variableSizeOf(elem, elemTyp) + BytesPerLengthOffset
+		default:
+			totalSize += fixedSizeOf(elem, elemTyp)
+		}
+	}
+	return totalSize
+}
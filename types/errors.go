@@ -0,0 +1,151 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// ErrOffsetOutOfRange is returned when an offset read from the input points
+	// outside of the bytes available to the value being decoded.
+	ErrOffsetOutOfRange = errors.New("offset out of range")
+	// ErrInvalidOffset is returned when an offset is well within the input but
+	// inconsistent with the layout, such as offsets which decrease.
+	ErrInvalidOffset = errors.New("invalid offset")
+	// ErrListTooLong is returned when a list holds more elements than allowed
+	// by its ssz-max tag.
+	ErrListTooLong = errors.New("list exceeds maximum length")
+	// ErrInvalidBool is returned when a boolean is encoded as anything other than 0 or 1.
+	ErrInvalidBool = errors.New("invalid boolean value")
+	// ErrShortInput is returned when the input ends before a value is fully decoded.
+	ErrShortInput = errors.New("input too short")
+	// ErrSizeMismatch is returned when the input length does not match the
+	// length required by the type being decoded.
+	ErrSizeMismatch = errors.New("unexpected input size")
+	// ErrVectorLength is returned when a fixed-size value does not have the
+	// number of elements required by its type or ssz-size tag.
+	ErrVectorLength = errors.New("unexpected vector length")
+	// ErrCacheMismatch is returned when cache verification finds a cached root
+	// which differs from the root computed without the cache.
+	ErrCacheMismatch = errors.New("cached root does not match computed root")
+)
+
+// DecodeError describes a failure to decode SSZ input, recording the path of
+// the field which failed, such as BeaconState.Validators[1023].Pubkey, and the byte
+// offset into the input at which decoding failed. The underlying cause is one of the
+// sentinel errors in this package and can be matched with errors.Is.
+type DecodeError struct {
+	Path     string
+	Offset   uint64
+	Expected uint64
+	Actual   uint64
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	return formatPathError(e.Path, fmt.Sprintf("%v at offset %d", e.Err, e.Offset), e.Expected, e.Actual)
+}
+
+// Unwrap returns the sentinel cause of the decoding failure.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncodeError describes a failure to encode a value, recording the path of the
+// field which could not be encoded. The underlying cause is one of the sentinel
+// errors in this package and can be matched with errors.Is.
+type EncodeError struct {
+	Path     string
+	Expected uint64
+	Actual   uint64
+	Err      error
+}
+
+func (e *EncodeError) Error() string {
+	return formatPathError(e.Path, e.Err.Error(), e.Expected, e.Actual)
+}
+
+// Unwrap returns the sentinel cause of the encoding failure.
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// CacheMismatchError records a root served from a cache which differs from the root
+// computed without the cache, along with the path of the field it was cached for.
+type CacheMismatchError struct {
+	Path     string
+	Cached   [32]byte
+	Computed [32]byte
+}
+
+func (e *CacheMismatchError) Error() string {
+	return formatPathError(e.Path, fmt.Sprintf("%v: cached %#x, computed %#x", ErrCacheMismatch, e.Cached, e.Computed), 0, 0)
+}
+
+// Unwrap returns ErrCacheMismatch.
+func (e *CacheMismatchError) Unwrap() error {
+	return ErrCacheMismatch
+}
+
+// JoinFieldPath appends a child path, either a field name or an index such as [3],
+// to a parent path, inserting a dot separator where needed.
+func JoinFieldPath(parent string, child string) string {
+	switch {
+	case parent == "":
+		return child
+	case child == "":
+		return parent
+	case child[0] == '[':
+		return parent + child
+	default:
+		return parent + "." + child
+	}
+}
+
+func formatPathError(path string, msg string, expected uint64, actual uint64) string {
+	// Sizes are only meaningful when they differ, errors without size
+	// information leave both at zero.
+	if expected != actual {
+		msg = fmt.Sprintf("%s: expected %d, received %d", msg, expected, actual)
+	}
+	if path == "" {
+		return msg
+	}
+	return path + ": " + msg
+}
+
+// annotateDecodeError prefixes the path of a decoding error with the name of the
+// enclosing field or index, and shifts its offset by the position of the child's
+// input within the parent's input. Decoding errors wrapped by other errors are
+// annotated too, while other errors are returned untouched.
+func annotateDecodeError(err error, elem string, base uint64) error {
+	var e *DecodeError
+	if errors.As(err, &e) {
+		e.Path = JoinFieldPath(elem, e.Path)
+		e.Offset += base
+	}
+	return err
+}
+
+// annotateEncodeError prefixes the path of an encoding error with the name of the
+// enclosing field or index. Other errors are returned untouched.
+func annotateEncodeError(err error, elem string) error {
+	var e *EncodeError
+	if errors.As(err, &e) {
+		e.Path = JoinFieldPath(elem, e.Path)
+	}
+	return err
+}
+
+// remainingBytes returns the number of bytes of input left from offset onwards.
+func remainingBytes(input []byte, offset uint64) uint64 {
+	if offset >= uint64(len(input)) {
+		return 0
+	}
+	return uint64(len(input)) - offset
+}
+
+func indexPath(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
@@ -0,0 +1,14 @@
+package types
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAnnotateDecodeError_WrappedError(t *testing.T) {
+	decodeErr := &DecodeError{Path: "[2]", Offset: 2, Err: ErrInvalidBool}
+	err := annotateDecodeError(fmt.Errorf("could not decode flags: %w", decodeErr), "Flags", 8)
+	if decodeErr.Path != "Flags[2]" || decodeErr.Offset != 10 {
+		t.Errorf("Unexpected path %q at offset %d of %v", decodeErr.Path, decodeErr.Offset, err)
+	}
+}
@@ -1,15 +1,64 @@
 package types
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"sync"
 )
 
-var enableCache = false
+var enableCacheVerification = false
 
-// ToggleCache enables caching of ssz hash tree root. It is disabled by default.
+// ToggleCache enables caching of ssz hash tree root of arrays. It is disabled by default.
+// See ConfigureCache for finer control over the caches.
 func ToggleCache(val bool) {
-	enableCache = val
+	cacheConfig.BasicArray.Enabled = val
+	cacheConfig.RootsArray.Enabled = val
+}
+
+// ToggleCacheVerification enables checking every root served from a cache against the
+// root computed without it, returning a *CacheMismatchError when they differ. It is meant
+// for debugging stale caches and is disabled by default, as it defeats caching.
+func ToggleCacheVerification(val bool) {
+	enableCacheVerification = val
+}
+
+// checkContext returns the error of ctx once it is done, so that long computations
+// stop at the next container or list element.
+func checkContext(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
+
+// verifyCachedRoot returns the cached root of the value at path, after checking it
+// against the root computed from scratch when cache verification is enabled.
+func verifyCachedRoot(path string, cached [32]byte, computeRoot func() ([32]byte, error)) ([32]byte, error) {
+	if !enableCacheVerification {
+		return cached, nil
+	}
+	computed, err := computeRoot()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	if computed != cached {
+		return [32]byte{}, &CacheMismatchError{Path: path, Cached: cached, Computed: computed}
+	}
+	return cached, nil
+}
+
+// ToggleContainerCache enables caching of the hash tree roots of containers by their
+// serialized bytes, so that containers which did not change are not rehashed, such as
+// most elements of a list of containers. Only containers holding no containers of their
+// own are cached. It is disabled by default.
+func ToggleContainerCache(val bool) {
+	cacheConfig.Container.Enabled = val
 }
 
 // StructFactory exports an implementation of a interface
@@ -23,6 +72,8 @@ var compositeArrayFactory = newCompositeArraySSZ()
 var basicSliceFactory = newBasicSliceSSZ()
 var stringFactory = newStringSSZ()
 var compositeSliceFactory = newCompositeSliceSSZ()
+var fastsszFactory = newFastSSZ()
+var codecFactory = newCodecSSZ()
 
 // SSZAble defines a type which can marshal/unmarshal and compute its
 // hash tree root according to the Simple Serialize specification.
@@ -33,13 +84,114 @@ type SSZAble interface {
 	Unmarshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error)
 }
 
+// sszFactory is implemented by every factory. Its methods thread the context of an
+// encoding, the state of a decoding and the scratch space of a root through the
+// values nested within the one they are called on, which SSZAble starts afresh.
+type sszFactory interface {
+	root(val reflect.Value, typ reflect.Type, fieldName string, limits listLimits, state *HashState) ([32]byte, error)
+	marshal(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error)
+	unmarshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64, state *DecodeState) (uint64, error)
+}
+
+// StateSSZAble is an SSZAble whose methods also take the context of a call, the state
+// of a decoding or the scratch space of a root, which they thread through the values
+// nested within the one they are called on.
+type StateSSZAble interface {
+	SSZAble
+	RootContext(ctx context.Context, val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64) ([32]byte, error)
+	RootWithState(val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64, state *HashState) ([32]byte, error)
+	MarshalContext(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error)
+	UnmarshalWithState(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64, state *DecodeState) (uint64, error)
+}
+
+// sszAble exposes a factory as StateSSZAble.
+type sszAble struct {
+	factory sszFactory
+}
+
+func (s *sszAble) Root(val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64) ([32]byte, error) {
+	return s.factory.root(val, typ, fieldName, capacityLimits(maxCapacity), nil)
+}
+
+func (s *sszAble) Marshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+	return s.factory.marshal(context.Background(), val, typ, buf, startOffset)
+}
+
+func (s *sszAble) Unmarshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+	return s.factory.unmarshal(val, typ, buf, startOffset, nil)
+}
+
+func (s *sszAble) RootContext(ctx context.Context, val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64) ([32]byte, error) {
+	return s.factory.root(val, typ, fieldName, capacityLimits(maxCapacity), NewHashStateContext(ctx))
+}
+
+func (s *sszAble) RootWithState(val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64, state *HashState) ([32]byte, error) {
+	return s.factory.root(val, typ, fieldName, capacityLimits(maxCapacity), state)
+}
+
+func (s *sszAble) MarshalContext(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+	return s.factory.marshal(ctx, val, typ, buf, startOffset)
+}
+
+func (s *sszAble) UnmarshalWithState(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64, state *DecodeState) (uint64, error) {
+	return s.factory.unmarshal(val, typ, buf, startOffset, state)
+}
+
+// exportedFactories holds the StateSSZAble of every factory, so that looking one up
+// does not allocate.
+var exportedFactories = make(map[sszFactory]*sszAble)
+
+func init() {
+	for _, factory := range []sszFactory{
+		StructFactory, basicFactory, basicArrayFactory, rootsArrayFactory, compositeArrayFactory,
+		basicSliceFactory, stringFactory, compositeSliceFactory, fastsszFactory, codecFactory,
+	} {
+		exportedFactories[factory] = &sszAble{factory: factory}
+	}
+}
+
 // SSZFactory recursively walks down a type and determines which SSZ-able
 // core type it belongs to, and then returns and implementation of
 // SSZ-able that contains marshal, unmarshal, and hash tree root related
-// functions for use.
+// functions for use. Containers with methods generated by fastssz are
+// marshaled, unmarshaled and hashed with them wherever they are nested,
+// as are types with codecs, registered or of their own methods.
 func SSZFactory(val reflect.Value, typ reflect.Type) (SSZAble, error) {
+	return StateFactory(val, typ)
+}
+
+// StateFactory behaves like SSZFactory, returning a StateSSZAble.
+func StateFactory(val reflect.Value, typ reflect.Type) (StateSSZAble, error) {
+	factory, err := factoryOf(val, typ)
+	if err != nil {
+		return nil, err
+	}
+	return exportedFactories[factory], nil
+}
+
+// factories maps types to the factories of their values, resolved once per type rather
+// than for every value, as the codecs of types are looked up along the way.
+var factories sync.Map
+
+// factoryOf returns the factory of values of typ.
+func factoryOf(val reflect.Value, typ reflect.Type) (sszFactory, error) {
+	if factory, ok := factories.Load(typ); ok {
+		return factory.(sszFactory), nil
+	}
+	factory, err := resolveFactory(typ)
+	if err != nil {
+		return nil, err
+	}
+	factories.Store(typ, factory)
+	return factory, nil
+}
+
+// resolveFactory determines the factory of values of typ from its type alone.
+func resolveFactory(typ reflect.Type) (sszFactory, error) {
 	kind := typ.Kind()
 	switch {
+	case hasCodec(typ):
+		return codecFactory, nil
 	case isBasicType(kind) || isBasicTypeArray(typ, typ.Kind()):
 		return basicFactory, nil
 	case kind == reflect.String:
@@ -55,7 +207,7 @@ func SSZFactory(val reflect.Value, typ reflect.Type) (SSZAble, error) {
 		}
 	case kind == reflect.Array:
 		switch {
-		case isRootsArray(val, typ):
+		case isRootsArray(reflect.Value{}, typ):
 			return rootsArrayFactory, nil
 		case isBasicTypeArray(typ.Elem(), typ.Elem().Kind()):
 			return basicArrayFactory, nil
@@ -65,9 +217,12 @@ func SSZFactory(val reflect.Value, typ reflect.Type) (SSZAble, error) {
 			return compositeArrayFactory, nil
 		}
 	case kind == reflect.Struct:
+		if implementsFastSSZ(typ) {
+			return fastsszFactory, nil
+		}
 		return StructFactory, nil
 	case kind == reflect.Ptr:
-		return SSZFactory(val.Elem(), typ.Elem())
+		return factoryOf(reflect.Value{}, typ.Elem())
 	default:
 		return nil, fmt.Errorf("unsupported kind: %v", kind)
 	}
@@ -0,0 +1,174 @@
+package types
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	fssz "github.com/ferranbt/fastssz"
+)
+
+// hashRoot is implemented by containers with generated hash tree root methods, which
+// every version of fastssz generates.
+type hashRoot interface {
+	HashTreeRoot() ([32]byte, error)
+}
+
+// hashWithHasher is implemented by containers whose generated hash tree root methods
+// hash into a fastssz hasher, which can be taken from its pool.
+type hashWithHasher interface {
+	HashTreeRootWith(hh *fssz.Hasher) error
+}
+
+var (
+	marshalerType      = reflect.TypeOf((*fssz.Marshaler)(nil)).Elem()
+	unmarshalerType    = reflect.TypeOf((*fssz.Unmarshaler)(nil)).Elem()
+	hashRootType       = reflect.TypeOf((*hashRoot)(nil)).Elem()
+	hashWithHasherType = reflect.TypeOf((*hashWithHasher)(nil)).Elem()
+)
+
+// fastsszStructs maps container types to whether they, or pointers to them, implement
+// any of the fastssz interfaces, which is looked up for every element of lists of
+// containers.
+var fastsszStructs sync.Map
+
+// implementsFastSSZ returns whether values of the container type typ, or pointers to
+// them, marshal, unmarshal or hash themselves with methods generated by fastssz.
+func implementsFastSSZ(typ reflect.Type) bool {
+	if implements, ok := fastsszStructs.Load(typ); ok {
+		return implements.(bool)
+	}
+	ptr := reflect.PtrTo(typ)
+	implements := ptr.Implements(marshalerType) ||
+		ptr.Implements(unmarshalerType) ||
+		ptr.Implements(hashRootType) ||
+		ptr.Implements(hashWithHasherType)
+	fastsszStructs.Store(typ, implements)
+	return implements
+}
+
+// fastsszSSZ delegates to the methods generated by fastssz of containers implementing
+// them, at whatever depth they are nested, and falls back to reflection for the methods
+// a container does not implement. The encoding and root of a container must be the same
+// either way, as the size of its encoding is still determined by reflection.
+type fastsszSSZ struct{}
+
+func newFastSSZ() *fastsszSSZ {
+	return &fastsszSSZ{}
+}
+
+// methods returns the value whose methods are delegated to, a pointer to the container
+// held by val where possible, as generated methods have pointer receivers. Nil pointers
+// are left to reflection, which treats them as empty containers.
+func (f *fastsszSSZ) methods(val reflect.Value) (interface{}, bool) {
+	switch {
+	case val.Kind() == reflect.Ptr:
+		if val.IsNil() {
+			return nil, false
+		}
+		return val.Interface(), true
+	case val.CanAddr():
+		return val.Addr().Interface(), true
+	case val.CanInterface():
+		return val.Interface(), true
+	default:
+		return nil, false
+	}
+}
+
+func (f *fastsszSSZ) root(val reflect.Value, typ reflect.Type, fieldName string, limits listLimits, state *HashState) ([32]byte, error) {
+	v, ok := f.methods(val)
+	if !ok {
+		return StructFactory.root(val, typ, fieldName, limits, state)
+	}
+	if state != nil {
+		if err := state.checkContext(); err != nil {
+			return [32]byte{}, err
+		}
+	}
+	if h, ok := v.(hashWithHasher); ok {
+		hh := fssz.DefaultHasherPool.Get()
+		defer fssz.DefaultHasherPool.Put(hh)
+		if err := h.HashTreeRootWith(hh); err != nil {
+			return [32]byte{}, err
+		}
+		return hh.HashRoot()
+	}
+	if h, ok := v.(hashRoot); ok {
+		return h.HashTreeRoot()
+	}
+	return StructFactory.root(val, typ, fieldName, limits, state)
+}
+
+func (f *fastsszSSZ) marshal(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+	v, ok := f.methods(val)
+	if !ok {
+		return StructFactory.marshal(ctx, val, typ, buf, startOffset)
+	}
+	m, ok := v.(fssz.Marshaler)
+	if !ok {
+		return StructFactory.marshal(ctx, val, typ, buf, startOffset)
+	}
+	if err := checkContext(ctx); err != nil {
+		return 0, err
+	}
+	size := uint64(m.SizeSSZ())
+	if startOffset > uint64(len(buf)) || size > uint64(len(buf))-startOffset {
+		return 0, &EncodeError{
+			Expected: size,
+			Actual:   remainingBytes(buf, startOffset),
+			Err:      ErrSizeMismatch,
+		}
+	}
+	// The encoding is appended in place, as the buffer is sized for it.
+	enc, err := m.MarshalSSZTo(buf[startOffset : startOffset : startOffset+size])
+	if err != nil {
+		return 0, err
+	}
+	if uint64(len(enc)) != size {
+		return 0, &EncodeError{
+			Expected: size,
+			Actual:   uint64(len(enc)),
+			Err:      ErrSizeMismatch,
+		}
+	}
+	copy(buf[startOffset:], enc)
+	return startOffset + size, nil
+}
+
+func (f *fastsszSSZ) unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64, state *DecodeState) (uint64, error) {
+	v, ok := f.methods(val)
+	if !ok {
+		return StructFactory.unmarshal(val, typ, input, startOffset, state)
+	}
+	u, ok := v.(fssz.Unmarshaler)
+	if !ok {
+		return StructFactory.unmarshal(val, typ, input, startOffset, state)
+	}
+	if err := state.enter(startOffset); err != nil {
+		return 0, err
+	}
+	defer state.leave()
+	if startOffset > uint64(len(input)) {
+		return 0, &DecodeError{Offset: startOffset, Err: ErrOffsetOutOfRange}
+	}
+	// Variable-size containers are handed the input up to the next offset, while
+	// fixed-size ones are decoded from their share of it.
+	endOffset := uint64(len(input))
+	if elem := derefType(typ); !isVariableSizeType(elem) {
+		size := determineFixedTypeSize(elem)
+		if size > endOffset-startOffset {
+			return 0, &DecodeError{
+				Offset:   startOffset,
+				Expected: size,
+				Actual:   remainingBytes(input, startOffset),
+				Err:      ErrShortInput,
+			}
+		}
+		endOffset = startOffset + size
+	}
+	if err := u.UnmarshalSSZ(input[startOffset:endOffset]); err != nil {
+		return 0, &DecodeError{Offset: startOffset, Err: err}
+	}
+	return endOffset, nil
+}
@@ -0,0 +1,124 @@
+package types
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+
+	"github.com/protolambda/zssz/merkle"
+)
+
+// HashState holds the scratch space of hash tree root computations, so that it can be
+// reused from one computation to the next. It is threaded through every factory's Root,
+// where the chunks of the values being merkleized are laid out on a single stack, the
+// innermost value last. Once the stack has grown to the size of the values hashed with
+// it, roots are computed without allocating, apart from the caches enabled with
+// ConfigureCache. A HashState must not be used by several goroutines at once.
+type HashState struct {
+	ctx   context.Context
+	stack []byte
+}
+
+// NewHashState returns a state for computing hash tree roots.
+func NewHashState() *HashState {
+	return &HashState{ctx: context.Background()}
+}
+
+// NewHashStateContext returns a state for computing hash tree roots which stop with
+// the error of ctx at the next container or list element once ctx is done.
+func NewHashStateContext(ctx context.Context) *HashState {
+	return &HashState{ctx: ctx}
+}
+
+// Reset empties the stack and sets the context roots computed with the state stop
+// with, keeping the memory of the stack for the next computation.
+func (s *HashState) Reset(ctx context.Context) {
+	s.ctx = ctx
+	s.stack = s.stack[:0]
+}
+
+// checkContext returns the error of the context of the computation once it is done.
+func (s *HashState) checkContext() error {
+	return checkContext(s.ctx)
+}
+
+// mark returns the top of the stack, where the chunks of a value are pushed.
+func (s *HashState) mark() int {
+	return len(s.stack)
+}
+
+// chunks returns the number of chunks pushed above mark.
+func (s *HashState) chunks(mark int) uint64 {
+	return uint64((len(s.stack) - mark) / BytesPerChunk)
+}
+
+// pop drops everything pushed above mark.
+func (s *HashState) pop(mark int) {
+	s.stack = s.stack[:mark]
+}
+
+// pushRoot pushes a chunk onto the stack.
+func (s *HashState) pushRoot(root [32]byte) {
+	s.stack = append(s.stack, root[:]...)
+}
+
+// pushZeroes pushes size zero bytes onto the stack, into which values are serialized.
+func (s *HashState) pushZeroes(size int) {
+	s.stack = append(s.stack, make([]byte, size)...)
+}
+
+// packChunks pads the bytes pushed above mark into whole chunks, packing nothing into
+// a single zero chunk, as pack does.
+func (s *HashState) packChunks(mark int) {
+	size := len(s.stack) - mark
+	if size == 0 {
+		s.pushZeroes(BytesPerChunk)
+		return
+	}
+	if remainder := size % BytesPerChunk; remainder != 0 {
+		s.pushZeroes(BytesPerChunk - remainder)
+	}
+}
+
+// merkleize returns the root of the chunks pushed above mark, as bitwiseMerkleize does
+// for a tree of limit chunks, and pops them. Each layer is hashed into the space above
+// it and moved down in its place, so the tree never takes more than one and a half
+// times the room of its chunks.
+func (s *HashState) merkleize(mark int, limit uint64) ([32]byte, error) {
+	defer s.pop(mark)
+	count := s.chunks(mark)
+	if count > limit {
+		return [32]byte{}, errors.New("merkleizing list that is too large, over limit")
+	}
+	if limit == 0 {
+		return [32]byte{}, nil
+	}
+	depth := uint64(merkle.GetDepth(limit))
+	hashing := currentHashing()
+	if count == 0 {
+		return hashing.zeroHashes[depth], nil
+	}
+	for i := uint64(0); i < depth; i++ {
+		if (len(s.stack)-mark)/BytesPerChunk%2 == 1 {
+			s.pushRoot(hashing.zeroHashes[i])
+		}
+		top := len(s.stack)
+		size := (top - mark) / 2
+		s.pushZeroes(size)
+		hashing.hashLayer(s.stack[top:], s.stack[mark:top])
+		copy(s.stack[mark:], s.stack[top:])
+		s.stack = s.stack[:mark+size]
+	}
+	return toBytes32(s.stack[mark:]), nil
+}
+
+// mixInLength returns the root of a list of length elements whose elements have the
+// given root, as mixInLength does.
+func (s *HashState) mixInLength(root [32]byte, length uint64) [32]byte {
+	mark := s.mark()
+	defer s.pop(mark)
+	s.pushRoot(root)
+	s.pushZeroes(BytesPerChunk)
+	binary.LittleEndian.PutUint64(s.stack[mark+BytesPerChunk:], length)
+	return hash(s.stack[mark:])
+}
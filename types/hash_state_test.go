@@ -0,0 +1,87 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestHashState_Merkleize(t *testing.T) {
+	for _, h := range []Hasher{SHA256Hasher, nodeHasher{}} {
+		SetHasher(h)
+		state := NewHashState()
+		for count := uint64(0); count <= 9; count++ {
+			chunks := make([][]byte, count)
+			for i := range chunks {
+				chunks[i] = make([]byte, 32)
+				chunks[i][0] = byte(i + 1)
+			}
+			for _, limit := range []uint64{count, count + 1, 16, 1000} {
+				want, err := bitwiseMerkleize(chunks, count, limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Values pushed below the chunks must be left untouched.
+				state.pushRoot([32]byte{0xff})
+				mark := state.mark()
+				for _, chunk := range chunks {
+					state.pushRoot(toBytes32(chunk))
+				}
+				root, err := state.merkleize(mark, limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if root != want {
+					t.Errorf("Expected root %#x of %d chunks with limit %d, received %#x", want, count, limit, root)
+				}
+				if state.mark() != mark || state.stack[0] != 0xff {
+					t.Errorf("Expected stack to be popped to its mark %d, received %d", mark, state.mark())
+				}
+				state.pop(0)
+			}
+		}
+		mark := state.mark()
+		state.pushRoot([32]byte{1})
+		state.pushRoot([32]byte{2})
+		if _, err := state.merkleize(mark, 1); err == nil {
+			t.Error("Expected merkleizing more chunks than the limit to fail")
+		}
+	}
+	SetHasher(nil)
+}
+
+func TestHashState_PackChunks(t *testing.T) {
+	state := NewHashState()
+	for _, size := range []int{0, 1, 31, 32, 33, 100} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i + 1)
+		}
+		want, err := pack([][]byte{data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		state.stack = append(state.stack, data...)
+		state.packChunks(0)
+		if state.chunks(0) != uint64(len(want)) {
+			t.Fatalf("Expected %d chunks of %d bytes, received %d", len(want), size, state.chunks(0))
+		}
+		for i, chunk := range want {
+			if string(state.stack[i*32:(i+1)*32]) != string(chunk) {
+				t.Errorf("Expected chunk %d of %d bytes to be %#x, received %#x", i, size, chunk, state.stack[i*32:(i+1)*32])
+			}
+		}
+		state.pop(0)
+	}
+}
+
+func TestHashState_MixInLength(t *testing.T) {
+	state := NewHashState()
+	root := [32]byte{1, 2, 3}
+	length := make([]byte, 32)
+	length[0] = 5
+	if want, got := mixInLength(root, length), state.mixInLength(root, 5); got != want {
+		t.Errorf("Expected %#x, received %#x", want, got)
+	}
+	if state.mark() != 0 {
+		t.Errorf("Expected empty stack, received %d bytes", state.mark())
+	}
+}
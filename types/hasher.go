@@ -0,0 +1,130 @@
+package types
+
+import (
+	"sync/atomic"
+
+	"github.com/minio/sha256-simd"
+)
+
+// Hasher is the hash function nodes of Merkle trees are computed with when determining
+// hash tree roots. Simple Serialize specifies SHA-256, but other implementations of it,
+// such as batched or hardware-specific ones, or other hash functions altogether for
+// formats derived from SSZ, can be configured with SetHasher.
+type Hasher interface {
+	// Hash returns the digest of data, which is usually the concatenation of two
+	// 32-byte nodes of a Merkle tree.
+	Hash(data []byte) [32]byte
+}
+
+// BatchHasher is a Hasher which hashes many 64-byte inputs at once, such as the pairs
+// of nodes of a whole layer of a Merkle tree. When the configured hasher implements it,
+// layers of Merkle trees are hashed with HashPairs rather than node by node.
+type BatchHasher interface {
+	Hasher
+	// HashPairs hashes each 64-byte input of src into the 32-byte digest at the same
+	// position of dst, which must not overlap src and holds half as many bytes.
+	HashPairs(dst []byte, src []byte)
+}
+
+// SHA256Hasher hashes with SHA-256, as specified by Simple Serialize. It is the
+// hasher used by default.
+var SHA256Hasher Hasher = sha256Hasher{}
+
+type sha256Hasher struct{}
+
+func (sha256Hasher) Hash(data []byte) [32]byte {
+	return sha256.Sum256(data)
+}
+
+// HashPairs hashes many pairs at a time with gohashtree where the processor supports
+// it, and pair by pair otherwise.
+func (sha256Hasher) HashPairs(dst []byte, src []byte) {
+	if hashPairsVector(dst, src) {
+		return
+	}
+	hashPairsScalar(dst, src)
+}
+
+// hashPairsScalar hashes the pairs of src into dst one at a time.
+func hashPairsScalar(dst []byte, src []byte) {
+	for i := 0; i < len(dst)/32; i++ {
+		digest := sha256.Sum256(src[64*i : 64*i+64])
+		copy(dst[32*i:], digest[:])
+	}
+}
+
+// hashing is the hash function of hash tree roots along with the roots of the trees of
+// zero chunks computed with it, which SetHasher replaces as a whole.
+type hashing struct {
+	hasher Hasher
+	// zeroHashes holds at index i the root of a tree of 2^i zero chunks.
+	zeroHashes [][32]byte
+}
+
+// defaultHashing hashes with SHA256Hasher, until SetHasher is first called.
+var defaultHashing = newHashing(SHA256Hasher)
+
+// configuredHashing holds the *hashing configured with SetHasher.
+var configuredHashing atomic.Value
+
+// newHashing returns the hashing of h, computing the roots of the trees of zero chunks
+// of every depth up to 99 with it.
+func newHashing(h Hasher) *hashing {
+	zeroes := make([][32]byte, 100)
+	for i := 1; i < len(zeroes); i++ {
+		zeroes[i] = h.Hash(append(zeroes[i-1][:], zeroes[i-1][:]...))
+	}
+	return &hashing{hasher: h, zeroHashes: zeroes}
+}
+
+// currentHashing returns the hashing hash tree roots are computed with.
+func currentHashing() *hashing {
+	if h, ok := configuredHashing.Load().(*hashing); ok {
+		return h
+	}
+	return defaultHashing
+}
+
+// SetHasher configures the hash function of hash tree roots, recomputing the roots of
+// the trees of zero chunks for it and clearing the roots cached with the previous one.
+// A nil hasher restores SHA256Hasher. It is safe to call while hash tree roots are
+// being computed, though those roots may then be computed with either hash function
+// and cached as such, and trackers created beforehand must not be used afterwards.
+func SetHasher(h Hasher) {
+	if h == nil {
+		configuredHashing.Store(defaultHashing)
+	} else {
+		configuredHashing.Store(newHashing(h))
+	}
+	ClearCache()
+}
+
+// CurrentHasher returns the hash function hash tree roots are computed with.
+func CurrentHasher() Hasher {
+	return currentHashing().hasher
+}
+
+// zeroHashes returns the roots of the trees of zero chunks of the configured hasher,
+// holding at index i the root of a tree of 2^i zero chunks.
+func zeroHashes() [][32]byte {
+	return currentHashing().zeroHashes
+}
+
+// hashLayer hashes the pairs of consecutive 32-byte nodes of src into the nodes of dst,
+// the layer above src in a Merkle tree, in a single pass with the configured hasher.
+func hashLayer(dst []byte, src []byte) {
+	currentHashing().hashLayer(dst, src)
+}
+
+// hashLayer hashes the pairs of consecutive 32-byte nodes of src into the nodes of dst
+// with the hasher of h.
+func (h *hashing) hashLayer(dst []byte, src []byte) {
+	if b, ok := h.hasher.(BatchHasher); ok {
+		b.HashPairs(dst, src)
+		return
+	}
+	for i := 0; i < len(dst)/32; i++ {
+		digest := h.hasher.Hash(src[64*i : 64*i+64])
+		copy(dst[32*i:], digest[:])
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !amd64 || noasm || appengine
+// +build !amd64 noasm appengine
+
+package types
+
+// hashPairsVector reports that pairs are not hashed with vector instructions on this
+// platform.
+func hashPairsVector(dst []byte, src []byte) bool {
+	return false
+}
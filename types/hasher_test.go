@@ -0,0 +1,119 @@
+package types
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"reflect"
+	"testing"
+)
+
+// truncatedSHA512Hasher hashes with the first 32 bytes of SHA-512, counting the
+// nodes it hashes.
+type truncatedSHA512Hasher struct {
+	count int
+}
+
+func (h *truncatedSHA512Hasher) Hash(data []byte) [32]byte {
+	h.count++
+	var out [32]byte
+	sum := sha512.Sum512(data)
+	copy(out[:], sum[:])
+	return out
+}
+
+func TestSetHasher(t *testing.T) {
+	v := cachedContainer{Epoch: 1, Roots: [][]byte{make([]byte, 32), make([]byte, 32)}, Data: []byte{1}}
+	want, err := StructFactory.root(reflect.ValueOf(v), reflect.TypeOf(v), "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &truncatedSHA512Hasher{}
+	SetHasher(h)
+	defer SetHasher(nil)
+	if CurrentHasher() != h {
+		t.Fatal("Expected configured hasher to be current")
+	}
+	zeroes := make([]byte, 64)
+	if zeroHashes()[1] != h.Hash(zeroes) {
+		t.Error("Expected zero hashes to be recomputed with the configured hasher")
+	}
+	h.count = 0
+	root, err := StructFactory.root(reflect.ValueOf(v), reflect.TypeOf(v), "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.count == 0 {
+		t.Error("Expected root to be computed with the configured hasher")
+	}
+	if root == want {
+		t.Error("Expected root computed with another hash function to differ")
+	}
+
+	SetHasher(nil)
+	if root, err := StructFactory.root(reflect.ValueOf(v), reflect.TypeOf(v), "", nil, nil); err != nil || root != want {
+		t.Errorf("Expected SHA-256 root %#x after restoring the default hasher, received %#x, %v", want, root, err)
+	}
+}
+
+// nodeHasher hashes with SHA-256 without implementing BatchHasher.
+type nodeHasher struct{}
+
+func (nodeHasher) Hash(data []byte) [32]byte {
+	return SHA256Hasher.Hash(data)
+}
+
+func TestHashLayer(t *testing.T) {
+	src := make([]byte, 5*64)
+	for i := range src {
+		src[i] = byte(i)
+	}
+	want := make([]byte, 0, 5*32)
+	for i := 0; i < 5; i++ {
+		digest := SHA256Hasher.Hash(src[64*i : 64*i+64])
+		want = append(want, digest[:]...)
+	}
+	for _, h := range []Hasher{SHA256Hasher, nodeHasher{}} {
+		SetHasher(h)
+		dst := make([]byte, 5*32)
+		hashLayer(dst, src)
+		if !bytes.Equal(dst, want) {
+			t.Errorf("Expected layer %#x with %T, received %#x", want, h, dst)
+		}
+	}
+	SetHasher(nil)
+}
+
+func TestHashPairs_LargeLayers(t *testing.T) {
+	for _, numPairs := range []int{1, 3, 8, 16*9 + 5, 1024} {
+		src := make([]byte, 64*numPairs)
+		for i := range src {
+			src[i] = byte(i * 7)
+		}
+		want := make([]byte, 32*numPairs)
+		hashPairsScalar(want, src)
+		dst := make([]byte, 32*numPairs)
+		SHA256Hasher.(BatchHasher).HashPairs(dst, src)
+		if !bytes.Equal(dst, want) {
+			t.Errorf("HashPairs() of %d pairs differs from hashing them one at a time", numPairs)
+		}
+	}
+}
+
+func BenchmarkHashPairs(b *testing.B) {
+	src := make([]byte, 64*4096)
+	for i := range src {
+		src[i] = byte(i)
+	}
+	dst := make([]byte, 32*4096)
+	b.Run("batched", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			SHA256Hasher.(BatchHasher).HashPairs(dst, src)
+		}
+	})
+	b.Run("scalar", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			hashPairsScalar(dst, src)
+		}
+	})
+}
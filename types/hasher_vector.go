@@ -0,0 +1,23 @@
+//go:build amd64 && !noasm && !appengine
+// +build amd64,!noasm,!appengine
+
+package types
+
+import (
+	"github.com/klauspost/cpuid/v2"
+	"github.com/prysmaticlabs/gohashtree"
+)
+
+// hasVectorSHA256 is set on processors with AVX, which the slowest code path of
+// gohashtree needs. It picks the fastest of its SHA extension, AVX-512, AVX2 and AVX
+// code paths for the processor itself.
+var hasVectorSHA256 = cpuid.CPU.Supports(cpuid.AVX)
+
+// hashPairsVector hashes the pairs of src into dst as HashPairs does, many at a time
+// in the vector registers of the processor, and reports whether it did.
+func hashPairsVector(dst []byte, src []byte) bool {
+	if !hasVectorSHA256 || len(dst) == 0 {
+		return false
+	}
+	return gohashtree.Hash(dst, src[:2*len(dst)]) == nil
+}
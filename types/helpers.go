@@ -2,11 +2,10 @@ package types
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"reflect"
 
-	"github.com/minio/sha256-simd"
-	"github.com/protolambda/zssz/htr"
 	"github.com/protolambda/zssz/merkle"
 )
 
@@ -15,17 +14,8 @@ var (
 	BytesPerChunk = 32
 	// BytesPerLengthOffset defines a constant for off-setting serialized chunks.
 	BytesPerLengthOffset = uint64(4)
-	zeroHashes           = make([][32]byte, 100)
 )
 
-func init() {
-	for i := 1; i < 100; i++ {
-		leaf := append(zeroHashes[i-1][:], zeroHashes[i-1][:]...)
-		result := hash(leaf)
-		copy(zeroHashes[i][:], result[:])
-	}
-}
-
 // Given ordered BYTES_PER_CHUNK-byte chunks, if necessary utilize zero chunks so that the
 // number of chunks is a power of two, Merkleize the chunks, and return the root.
 // Note that merkleize on a single chunk is simply that chunk, i.e. the identity
@@ -34,11 +24,31 @@ func bitwiseMerkleize(chunks [][]byte, count uint64, limit uint64) ([32]byte, er
 	if count > limit {
 		return [32]byte{}, errors.New("merkleizing list that is too large, over limit")
 	}
-	hasher := htr.HashFn(hash)
-	leafIndexer := func(i uint64) []byte {
-		return chunks[i]
+	if limit == 0 {
+		return [32]byte{}, nil
+	}
+	depth := uint64(merkle.GetDepth(limit))
+	hashing := currentHashing()
+	if count == 0 {
+		return hashing.zeroHashes[depth], nil
+	}
+	layer := make([]byte, count*32, (count+1)*32)
+	for i := uint64(0); i < count; i++ {
+		copy(layer[i*32:(i+1)*32], chunks[i])
+	}
+	// Hash each layer into the one above as a whole, alternating between two buffers,
+	// and pad layers of odd length with the root of a tree of zero chunks of the same
+	// height.
+	above := make([]byte, 0, (count/2+2)*32)
+	for i := uint64(0); i < depth; i++ {
+		if len(layer)/32%2 == 1 {
+			layer = append(layer, hashing.zeroHashes[i][:]...)
+		}
+		next := above[:len(layer)/2]
+		hashing.hashLayer(next, layer)
+		layer, above = next, layer[:0]
 	}
-	return merkle.Merkleize(hasher, count, limit, leafIndexer), nil
+	return toBytes32(layer), nil
 }
 
 // Given ordered objects of the same basic type, serialize them, pack them into BYTES_PER_CHUNK-byte
@@ -63,47 +73,29 @@ func pack(serializedItems [][]byte) ([][]byte, error) {
 		// If each item has exactly BYTES_PER_CHUNK length, we return the list of serialized items.
 		return serializedItems, nil
 	}
-	// We flatten the list in order to pack its items into byte chunks correctly.
-	orderedItems := []byte{}
+	// We flatten the list in order to pack its items into byte chunks correctly. The
+	// buffer holds whole chunks, so the last chunk is right-padded with zero bytes.
+	numItems := 0
 	for _, item := range serializedItems {
-		orderedItems = append(orderedItems, item...)
-	}
-	numItems := len(orderedItems)
-	chunks := [][]byte{}
-	for i := 0; i < numItems; i += BytesPerChunk {
-		j := i + BytesPerChunk
-		// We create our upper bound index of the chunk, if it is greater than numItems,
-		// we set it as numItems itself.
-		if j > numItems {
-			j = numItems
-		}
-		// We create chunks from the list of items based on the
-		// indices determined above.
-		chunks = append(chunks, orderedItems[i:j])
+		numItems += len(item)
+	}
+	orderedItems := make([]byte, (numItems+BytesPerChunk-1)/BytesPerChunk*BytesPerChunk)
+	offset := 0
+	for _, item := range serializedItems {
+		offset += copy(orderedItems[offset:], item)
 	}
-	// Right-pad the last chunk with zero bytes if it does not
-	// have length BytesPerChunk.
-	lastChunk := chunks[len(chunks)-1]
-	for len(lastChunk) < BytesPerChunk {
-		lastChunk = append(lastChunk, 0)
+	// We create chunks from the buffer without copying it.
+	chunks := make([][]byte, 0, len(orderedItems)/BytesPerChunk)
+	for i := 0; i < len(orderedItems); i += BytesPerChunk {
+		chunks = append(chunks, orderedItems[i:i+BytesPerChunk])
 	}
-	chunks[len(chunks)-1] = lastChunk
 	return chunks, nil
 }
 
 // Given a Merkle root root and a length length ("uint256" little-endian serialization)
 // return hash(root + length).
 func mixInLength(root [32]byte, length []byte) [32]byte {
-	var hash [32]byte
-	h := sha256.New()
-	h.Write(root[:])
-	h.Write(length)
-	// The hash interface never returns an error, for that reason
-	// we are not handling the error below. For reference, it is
-	// stated here https://golang.org/pkg/hash/#Hash
-	// #nosec G104
-	h.Sum(hash[:0])
-	return hash
+	return hash(append(root[:], length...))
 }
 
 // Instantiates a reflect value which may not have a concrete type to have a concrete type
@@ -113,32 +105,94 @@ func instantiateConcreteTypeForElement(val reflect.Value, typ reflect.Type) {
 	val.Set(reflect.New(typ))
 }
 
-// Grows a slice to a new length and instantiates the element at length-1 with a concrete type
-// accordingly if it is set to a pointer.
-func growConcreteSliceType(val reflect.Value, typ reflect.Type, length int) {
+// Grows a slice to a new length and instantiates the elements which were added with a concrete
+// type accordingly if they are set to a pointer. The allocation is accounted for in the decoding
+// state beforehand, and refused if it would exceed its limits.
+func growConcreteSliceType(val reflect.Value, typ reflect.Type, length int, state *DecodeState, offset uint64) error {
+	if err := state.allocate(typ.Elem(), uint64(length), offset); err != nil {
+		return err
+	}
 	newVal := reflect.MakeSlice(typ, length, length)
-	reflect.Copy(newVal, val)
+	copied := reflect.Copy(newVal, val)
 	val.Set(newVal)
-	if val.Index(length-1).Kind() == reflect.Ptr {
-		instantiateConcreteTypeForElement(val.Index(length-1), typ.Elem().Elem())
+	if typ.Elem().Kind() == reflect.Ptr {
+		for i := copied; i < length; i++ {
+			instantiateConcreteTypeForElement(val.Index(i), typ.Elem().Elem())
+		}
+	}
+	return nil
+}
+
+// Reads the first offset of a list or vector of variable-size elements. As the offsets
+// are laid out right before the elements, the first offset also determines how many
+// elements follow, so it must point past a whole number of offsets within the input.
+func readFirstOffset(input []byte, startOffset uint64) (uint64, error) {
+	if startOffset+BytesPerLengthOffset > uint64(len(input)) {
+		return 0, &DecodeError{
+			Offset:   startOffset,
+			Expected: BytesPerLengthOffset,
+			Actual:   remainingBytes(input, startOffset),
+			Err:      ErrShortInput,
+		}
 	}
+	offset := startOffset + uint64(binary.LittleEndian.Uint32(input[startOffset:startOffset+BytesPerLengthOffset]))
+	if offset > uint64(len(input)) {
+		return 0, &DecodeError{
+			Offset:   startOffset,
+			Expected: uint64(len(input)),
+			Actual:   offset,
+			Err:      ErrOffsetOutOfRange,
+		}
+	}
+	if offset == startOffset || (offset-startOffset)%BytesPerLengthOffset != 0 {
+		return 0, &DecodeError{Offset: startOffset, Err: ErrInvalidOffset}
+	}
+	return offset, nil
 }
 
-// hash defines a function that returns the sha256 hash of the data passed in.
+// Reads the offset stored at index, which must lie within the offsets section validated
+// by readFirstOffset. Offsets may not decrease nor point past the end of the input.
+func readNextOffset(input []byte, startOffset uint64, index uint64, previous uint64) (uint64, error) {
+	offset := startOffset + uint64(binary.LittleEndian.Uint32(input[index:index+BytesPerLengthOffset]))
+	if offset > uint64(len(input)) {
+		return 0, &DecodeError{
+			Offset:   index,
+			Expected: uint64(len(input)),
+			Actual:   offset,
+			Err:      ErrOffsetOutOfRange,
+		}
+	}
+	if offset < previous {
+		return 0, &DecodeError{Offset: index, Err: ErrInvalidOffset}
+	}
+	return offset, nil
+}
+
+// hash defines a function that returns the hash of the data passed in, computed with
+// the configured hasher.
 func hash(data []byte) [32]byte {
-	return sha256.Sum256(data)
+	return currentHashing().hasher.Hash(data)
 }
 
-func growSliceFromSizeTags(val reflect.Value, sizes []uint64) reflect.Value {
-	if len(sizes) == 0 {
-		return val
+// Allocates a slice, and any nested slices, with the lengths given by ssz-size tags. The
+// allocations are accounted for in the decoding state beforehand. As their lengths come
+// from the type rather than the input, they only count towards the allocation limit.
+func growSliceFromSizeTags(val reflect.Value, sizes []uint64, state *DecodeState, offset uint64) (reflect.Value, error) {
+	if len(sizes) == 0 || val.Kind() != reflect.Slice {
+		return val, nil
+	}
+	if err := state.allocateElements(val.Type().Elem(), sizes[0], offset); err != nil {
+		return reflect.Value{}, err
 	}
 	finalValue := reflect.MakeSlice(val.Type(), int(sizes[0]), int(sizes[0]))
 	for i := 0; i < int(sizes[0]); i++ {
-		intermediate := growSliceFromSizeTags(finalValue.Index(i), sizes[1:])
+		intermediate, err := growSliceFromSizeTags(finalValue.Index(i), sizes[1:], state, offset)
+		if err != nil {
+			return reflect.Value{}, err
+		}
 		finalValue.Index(i).Set(intermediate)
 	}
-	return finalValue
+	return finalValue, nil
 }
 
 func toBytes32(x []byte) [32]byte {
@@ -0,0 +1,236 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maxTreeDepth bounds the depth of an incremental tree so that its capacity of
+// 2^depth leaves can be counted in a uint64.
+const maxTreeDepth = 63
+
+// IncrementalTree is an append-only Merkle tree of a fixed depth, such as the deposit
+// contract tree, whose root is the hash tree root of the list of its leaves with a
+// capacity of 2^depth. Every node of the appended leaves is kept, so that appending
+// updates a single path of the tree and proofs are read off directly, while nodes
+// which are only needed to prove finalized leaves can be pruned.
+type IncrementalTree struct {
+	depth uint64
+	count uint64
+	// layers[i] holds the nodes at height i of the tree, from the one at index
+	// offsets[i] onwards, where the leaves are at height 0. Nodes of partially
+	// filled subtrees are completed with zero hashes.
+	layers  [][][32]byte
+	offsets []uint64
+}
+
+// TreeSnapshot is the state an incremental tree needs to carry on appending leaves and
+// computing its root: the roots of the complete subtrees on the left of the next leaf.
+type TreeSnapshot struct {
+	Depth uint64
+	Count uint64
+	// Branch holds at index i the root of the complete subtree of 2^i leaves on the
+	// left of the next leaf when bit i of Count is set, and zeroes otherwise. Its last
+	// entry is the root of the whole tree once it is full.
+	Branch [][32]byte
+}
+
+// NewIncrementalTree returns an empty tree holding at most 2^depth leaves.
+func NewIncrementalTree(depth uint64) (*IncrementalTree, error) {
+	if depth > maxTreeDepth {
+		return nil, fmt.Errorf("tree depth %d exceeds maximum depth %d", depth, maxTreeDepth)
+	}
+	return &IncrementalTree{
+		depth:   depth,
+		layers:  make([][][32]byte, depth+1),
+		offsets: make([]uint64, depth+1),
+	}, nil
+}
+
+// RestoreIncrementalTree returns a tree restored from a snapshot, to which leaves can be
+// appended as to the tree the snapshot was taken from. The leaves before the snapshot
+// are finalized in the restored tree.
+func RestoreIncrementalTree(snapshot TreeSnapshot) (*IncrementalTree, error) {
+	t, err := NewIncrementalTree(snapshot.Depth)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(snapshot.Branch)) != snapshot.Depth+1 {
+		return nil, fmt.Errorf("snapshot branch of length %d does not match depth %d", len(snapshot.Branch), snapshot.Depth)
+	}
+	if snapshot.Count > t.capacity() {
+		return nil, fmt.Errorf("snapshot of %d leaves exceeds tree capacity %d", snapshot.Count, t.capacity())
+	}
+	t.count = snapshot.Count
+	for i := uint64(0); i <= t.depth; i++ {
+		t.offsets[i] = t.count >> i
+		if t.count>>i&1 == 1 {
+			t.offsets[i]--
+			t.layers[i] = [][32]byte{snapshot.Branch[i]}
+		}
+	}
+	// Rebuild the nodes of the partially filled subtrees on the right of the branch.
+	if t.count > 0 {
+		last := t.count - 1
+		for i := uint64(1); i <= t.depth; i++ {
+			index := last >> i
+			if (index+1)<<i <= t.count {
+				continue
+			}
+			t.setNode(i, index, t.parent(i, index))
+		}
+	}
+	return t, nil
+}
+
+// Depth returns the depth of the tree.
+func (t *IncrementalTree) Depth() uint64 {
+	return t.depth
+}
+
+// Len returns the number of leaves appended to the tree.
+func (t *IncrementalTree) Len() uint64 {
+	return t.count
+}
+
+// Append adds a leaf to the tree, updating the nodes on its path to the root.
+func (t *IncrementalTree) Append(leaf [32]byte) error {
+	if t.count >= t.capacity() {
+		return fmt.Errorf("tree of depth %d is full", t.depth)
+	}
+	t.count++
+	t.update(t.count-1, leaf)
+	return nil
+}
+
+// Root returns the root of the tree with the number of leaves mixed in, which is the
+// hash tree root of the list of leaves with a capacity of 2^depth.
+func (t *IncrementalTree) Root() [32]byte {
+	return mixInLength(t.treeRoot(), lengthChunk(t.count))
+}
+
+// Proof returns the Merkle branch of the leaf at index against the root of the tree,
+// made of the siblings of the nodes on its path from the leaf up, followed by the
+// number of leaves mixed into the root.
+func (t *IncrementalTree) Proof(index uint64) ([][32]byte, error) {
+	if index >= t.count {
+		return nil, fmt.Errorf("index %d out of range for tree of %d leaves", index, t.count)
+	}
+	proof := make([][32]byte, 0, t.depth+1)
+	for i := uint64(0); i < t.depth; i++ {
+		sibling, ok := t.node(i, index>>i^1)
+		if !ok {
+			return nil, fmt.Errorf("leaf %d is finalized and cannot be proven", index)
+		}
+		proof = append(proof, sibling)
+	}
+	return append(proof, toBytes32(lengthChunk(t.count))), nil
+}
+
+// Snapshot returns the state of the tree, from which it can be restored with
+// RestoreIncrementalTree.
+func (t *IncrementalTree) Snapshot() TreeSnapshot {
+	branch := make([][32]byte, t.depth+1)
+	for i := uint64(0); i <= t.depth; i++ {
+		if t.count>>i&1 == 1 {
+			branch[i], _ = t.node(i, t.count>>i-1)
+		}
+	}
+	return TreeSnapshot{Depth: t.depth, Count: t.count, Branch: branch}
+}
+
+// Finalize prunes the nodes which are only needed to prove the leaves before index count,
+// so those leaves may no longer be provable afterwards. The root of the tree is
+// unaffected, and leaves from count onwards can still be proven.
+func (t *IncrementalTree) Finalize(count uint64) error {
+	if count > t.count {
+		return errors.New("cannot finalize leaves which were not appended")
+	}
+	for i := uint64(0); i <= t.depth; i++ {
+		// Nodes from this one onwards are either on the path of a leaf which is
+		// not finalized, or siblings of such nodes.
+		offset := count >> i &^ 1
+		if offset <= t.offsets[i] {
+			continue
+		}
+		t.layers[i] = append([][32]byte(nil), t.layers[i][offset-t.offsets[i]:]...)
+		t.offsets[i] = offset
+	}
+	return nil
+}
+
+// newTreeFromLeaves returns a tree of the given depth holding leaves, hashing each
+// layer of the tree once rather than every path from a leaf to the root.
+func newTreeFromLeaves(depth uint64, leaves [][32]byte) (*IncrementalTree, error) {
+	t, err := NewIncrementalTree(depth)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(leaves)) > t.capacity() {
+		return nil, fmt.Errorf("%d leaves exceed tree capacity %d", len(leaves), t.capacity())
+	}
+	t.count = uint64(len(leaves))
+	t.layers[0] = leaves
+	for i := uint64(1); i <= t.depth && t.count > 0; i++ {
+		below := t.layers[i-1]
+		layer := make([][32]byte, (len(below)+1)/2)
+		for j := range layer {
+			right := zeroHashes()[i-1]
+			if 2*j+1 < len(below) {
+				right = below[2*j+1]
+			}
+			layer[j] = hash(append(below[2*j][:], right[:]...))
+		}
+		t.layers[i] = layer
+	}
+	return t, nil
+}
+
+// update replaces the leaf at index, which must have been appended, and rehashes the
+// nodes on its path to the root.
+func (t *IncrementalTree) update(index uint64, leaf [32]byte) {
+	t.setNode(0, index, leaf)
+	for i := uint64(1); i <= t.depth; i++ {
+		t.setNode(i, index>>i, t.parent(i, index>>i))
+	}
+}
+
+// treeRoot returns the root of the tree, without the number of leaves mixed in.
+func (t *IncrementalTree) treeRoot() [32]byte {
+	if t.count == 0 {
+		return zeroHashes()[t.depth]
+	}
+	return t.layers[t.depth][0]
+}
+
+func (t *IncrementalTree) capacity() uint64 {
+	return 1 << t.depth
+}
+
+// node returns the node at height i and index, which is a zero hash when none of its
+// leaves were appended. It reports false for nodes which were pruned.
+func (t *IncrementalTree) node(i uint64, index uint64) ([32]byte, bool) {
+	if index < t.offsets[i] {
+		return [32]byte{}, false
+	}
+	if index-t.offsets[i] >= uint64(len(t.layers[i])) {
+		return zeroHashes()[i], true
+	}
+	return t.layers[i][index-t.offsets[i]], true
+}
+
+// parent computes the node at height i and index from its children.
+func (t *IncrementalTree) parent(i uint64, index uint64) [32]byte {
+	left, _ := t.node(i-1, 2*index)
+	right, _ := t.node(i-1, 2*index+1)
+	return hash(append(left[:], right[:]...))
+}
+
+func (t *IncrementalTree) setNode(i uint64, index uint64, node [32]byte) {
+	position := index - t.offsets[i]
+	if position == uint64(len(t.layers[i])) {
+		t.layers[i] = append(t.layers[i], node)
+		return
+	}
+	t.layers[i][position] = node
+}
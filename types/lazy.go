@@ -0,0 +1,530 @@
+package types
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"reflect"
+
+	"github.com/prysmaticlabs/go-bitfield"
+)
+
+// lazyReadSize is the number of bytes read at once when streaming a value, and the
+// size under which values are read whole rather than streamed.
+const lazyReadSize = 1 << 16
+
+// fieldLayout describes where a field of a container lives within its encoding.
+type fieldLayout struct {
+	field    reflect.StructField
+	fType    reflect.Type
+	variable bool
+	// position is the position of the value of a fixed-size field, or the
+	// position of the offset of a variable-size field.
+	position uint64
+	size     uint64
+}
+
+// structLayout returns the layout of the fields of a container of type typ, and
+// the length of its fixed-size part, from the type alone.
+func structLayout(typ reflect.Type) ([]fieldLayout, uint64, error) {
+	var layout []fieldLayout
+	position := uint64(0)
+	for i := 0; i < typ.NumField(); i++ {
+		// We skip protobuf related metadata fields.
+		if isProtobufMetadataField(typ.Field(i)) {
+			continue
+		}
+		fType, err := determineFieldType(typ.Field(i))
+		if err != nil {
+			return nil, 0, err
+		}
+		item := fieldLayout{field: typ.Field(i), fType: fType, position: position}
+		if isVariableSizeType(fType) {
+			item.variable = true
+			position += BytesPerLengthOffset
+		} else {
+			item.size = determineFixedTypeSize(fType)
+			position += item.size
+		}
+		layout = append(layout, item)
+	}
+	return layout, position, nil
+}
+
+// Lazy gives access to an SSZ encoded value through an io.ReaderAt, reading only what
+// is needed from it. Creating a Lazy value reads its offsets, so that fields and elements
+// can be reached directly, while their contents are only read when requested. Roots are
+// computed by streaming over the input, never holding more than one value of at most
+// lazyReadSize bytes, or a list's pending tree nodes, in memory at a time.
+type Lazy struct {
+	r              io.ReaderAt
+	base           uint64
+	size           uint64
+	typ            reflect.Type
+	limits         listLimits
+	isBitlistField bool
+	path           string
+
+	// layout describes the fields of a container, and bounds holds where every
+	// variable-size field starts and ends within the value.
+	layout []fieldLayout
+	bounds [][2]uint64
+	// length is the number of elements of a list or vector.
+	length uint64
+}
+
+// NewLazy returns lazy access to the SSZ encoding of a value of type typ, stored in the
+// size bytes of r.
+func NewLazy(r io.ReaderAt, size uint64, typ reflect.Type) (*Lazy, error) {
+	return newLazy(r, 0, size, typ, nil, false, "")
+}
+
+func newLazy(r io.ReaderAt, base uint64, size uint64, typ reflect.Type, limits listLimits, isBitlistField bool, path string) (*Lazy, error) {
+	l := &Lazy{
+		r:              r,
+		base:           base,
+		size:           size,
+		typ:            derefType(typ),
+		limits:         limits,
+		isBitlistField: isBitlistField,
+		path:           path,
+	}
+	var err error
+	kind := l.typ.Kind()
+	switch {
+	case hasCodec(l.typ):
+		if expected := determineFixedTypeSize(l.typ); !isVariableSizeType(l.typ) && size != expected {
+			err = &DecodeError{Expected: expected, Actual: size, Err: ErrSizeMismatch}
+		}
+	case !isVariableSizeType(l.typ) && kind != reflect.Struct && kind != reflect.Array:
+		if expected := determineFixedTypeSize(l.typ); size != expected {
+			err = &DecodeError{Expected: expected, Actual: size, Err: ErrSizeMismatch}
+		}
+	case kind == reflect.Struct:
+		err = l.readOffsets()
+	case l.typ == bitlistType:
+		err = l.readBitlistLength()
+	case kind == reflect.String:
+		l.length = size
+		err = checkCapacity(l.length, limits.outer())
+	case kind == reflect.Slice || kind == reflect.Array:
+		err = l.readListLength()
+	default:
+		err = fmt.Errorf("type %v is not serializable", l.typ)
+	}
+	if err != nil {
+		return nil, annotateDecodeError(err, path, base)
+	}
+	return l, nil
+}
+
+// readOffsets reads and checks the offsets of the variable-size fields of a container.
+func (l *Lazy) readOffsets() error {
+	layout, fixedLength, err := structLayout(l.typ)
+	if err != nil {
+		return err
+	}
+	if fixedLength > l.size {
+		return &DecodeError{Expected: fixedLength, Actual: l.size, Err: ErrShortInput}
+	}
+	l.layout = layout
+	l.bounds = make([][2]uint64, len(layout))
+	// The variable-size part must start right after the fixed-size part, and each
+	// variable-size field ends where the next one starts.
+	previous := -1
+	for i, item := range layout {
+		if !item.variable {
+			continue
+		}
+		buf, err := l.readAt(item.position, BytesPerLengthOffset)
+		if err != nil {
+			return err
+		}
+		offset := uint64(binary.LittleEndian.Uint32(buf))
+		switch {
+		case offset > l.size:
+			return &DecodeError{Path: item.field.Name, Offset: item.position, Expected: l.size, Actual: offset, Err: ErrOffsetOutOfRange}
+		case previous < 0 && offset != fixedLength:
+			return &DecodeError{Offset: item.position, Expected: fixedLength, Actual: offset, Err: ErrInvalidOffset}
+		case previous >= 0 && offset < l.bounds[previous][0]:
+			return &DecodeError{Path: item.field.Name, Offset: item.position, Err: ErrInvalidOffset}
+		}
+		if previous >= 0 {
+			l.bounds[previous][1] = offset
+		}
+		l.bounds[i] = [2]uint64{offset, l.size}
+		previous = i
+	}
+	if previous < 0 && fixedLength != l.size {
+		return &DecodeError{Expected: fixedLength, Actual: l.size, Err: ErrSizeMismatch}
+	}
+	return nil
+}
+
+// readListLength determines and checks the number of elements of a list or vector.
+func (l *Lazy) readListLength() error {
+	elem := derefType(l.typ.Elem())
+	if isVariableSizeType(elem) {
+		if l.size > 0 {
+			buf, err := l.readAt(0, BytesPerLengthOffset)
+			if err != nil {
+				return err
+			}
+			firstOffset := uint64(binary.LittleEndian.Uint32(buf))
+			if firstOffset > l.size {
+				return &DecodeError{Expected: l.size, Actual: firstOffset, Err: ErrOffsetOutOfRange}
+			}
+			if firstOffset == 0 || firstOffset%BytesPerLengthOffset != 0 {
+				return &DecodeError{Err: ErrInvalidOffset}
+			}
+			l.length = firstOffset / BytesPerLengthOffset
+		}
+	} else {
+		elemSize := determineFixedTypeSize(elem)
+		if elemSize == 0 || l.size%elemSize != 0 {
+			return &DecodeError{Expected: elemSize, Actual: l.size, Err: ErrSizeMismatch}
+		}
+		l.length = l.size / elemSize
+	}
+	if l.typ.Kind() == reflect.Array && l.length != uint64(l.typ.Len()) {
+		return &DecodeError{Expected: uint64(l.typ.Len()), Actual: l.length, Err: ErrVectorLength}
+	}
+	return checkCapacity(l.length, l.limits.outer())
+}
+
+// readBitlistLength determines the number of bits of a bitlist from its last byte.
+func (l *Lazy) readBitlistLength() error {
+	if l.size == 0 {
+		return nil
+	}
+	last, err := l.readAt(l.size-1, 1)
+	if err != nil {
+		return err
+	}
+	if last[0] == 0 {
+		return &DecodeError{Offset: l.size - 1, Err: ErrSizeMismatch}
+	}
+	l.length = (l.size-1)*8 + uint64(bits.Len8(last[0])) - 1
+	return checkCapacity(l.length, l.limits.outer())
+}
+
+func (l *Lazy) readAt(offset uint64, n uint64) ([]byte, error) {
+	buf := make([]byte, n)
+	read, err := l.r.ReadAt(buf, int64(l.base+offset))
+	if uint64(read) == n {
+		return buf, nil
+	}
+	if err == nil || err == io.EOF {
+		err = &DecodeError{Offset: offset + uint64(read), Expected: n, Actual: uint64(read), Err: ErrShortInput}
+	}
+	return nil, err
+}
+
+// Type returns the type of the value.
+func (l *Lazy) Type() reflect.Type {
+	return unwrapCodecFieldType(l.typ)
+}
+
+// Size returns the length of the encoding of the value.
+func (l *Lazy) Size() uint64 {
+	return l.size
+}
+
+// Len returns the number of elements of a list or vector, the number of bits of
+// a bitlist, or the length of a string. Other values have a length of zero.
+func (l *Lazy) Len() uint64 {
+	return l.length
+}
+
+// Bytes reads the whole encoding of the value.
+func (l *Lazy) Bytes() ([]byte, error) {
+	data, err := l.readAt(0, l.size)
+	if err != nil {
+		return nil, annotateDecodeError(err, l.path, l.base)
+	}
+	return data, nil
+}
+
+// Decode reads the value and decodes it into the value pointed to by val, which
+// must be of the type the value was encoded from.
+func (l *Lazy) Decode(val interface{}) error {
+	rval := reflect.ValueOf(val)
+	if rval.Kind() != reflect.Ptr || rval.IsNil() {
+		return errors.New("can only decode into a non-nil pointer")
+	}
+	data, err := l.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := validateEncoding(data, l.typ, l.limits); err != nil {
+		return annotateDecodeError(err, l.path, l.base)
+	}
+	if len(data) == 0 {
+		rval.Elem().Set(reflect.Zero(rval.Elem().Type()))
+		return nil
+	}
+	typ := rval.Elem().Type()
+	if hasCodec(l.typ) {
+		// Fields tagged with codecs are decoded by them rather than by their type.
+		typ = l.typ
+	}
+	factory, err := factoryOf(rval.Elem(), typ)
+	if err != nil {
+		return err
+	}
+	if _, err := factory.unmarshal(rval.Elem(), typ, data, 0, nil); err != nil {
+		return annotateDecodeError(err, l.path, l.base)
+	}
+	return nil
+}
+
+// Field returns lazy access to the named field of a container.
+func (l *Lazy) Field(name string) (*Lazy, error) {
+	for i, item := range l.layout {
+		if item.field.Name != name {
+			continue
+		}
+		start, end := item.position, item.position+item.size
+		if item.variable {
+			start, end = l.bounds[i][0], l.bounds[i][1]
+		}
+		return newLazy(l.r, l.base+start, end-start, item.fType, determineFieldLimits(item.field),
+			item.field.Type == bitlistType && !hasCodec(item.fType), JoinFieldPath(l.path, name))
+	}
+	return nil, fmt.Errorf("type %v has no field %s", l.typ, name)
+}
+
+// Index returns lazy access to the element at index i of a list or vector.
+func (l *Lazy) Index(i uint64) (*Lazy, error) {
+	kind := l.typ.Kind()
+	if (kind != reflect.Slice && kind != reflect.Array) || l.typ == bitlistType || hasCodec(l.typ) {
+		return nil, fmt.Errorf("cannot select element %d of non-list type %v", i, l.typ)
+	}
+	if i >= l.length {
+		return nil, fmt.Errorf("index %d out of range for list of length %d", i, l.length)
+	}
+	elem := l.typ.Elem()
+	path := JoinFieldPath(l.path, indexPath(int(i)))
+	if !isVariableSizeType(elem) {
+		elemSize := determineFixedTypeSize(elem)
+		return newLazy(l.r, l.base+i*elemSize, elemSize, elem, l.limits.inner(), false, path)
+	}
+	// Read the offset of the element, and the one of the next element which bounds it.
+	n := BytesPerLengthOffset
+	if i+1 < l.length {
+		n *= 2
+	}
+	buf, err := l.readAt(i*BytesPerLengthOffset, n)
+	if err != nil {
+		return nil, annotateDecodeError(err, l.path, l.base)
+	}
+	start, end := uint64(binary.LittleEndian.Uint32(buf)), l.size
+	if n > BytesPerLengthOffset {
+		end = uint64(binary.LittleEndian.Uint32(buf[BytesPerLengthOffset:]))
+	}
+	if start < l.length*BytesPerLengthOffset || end < start || end > l.size {
+		return nil, &DecodeError{Path: path, Offset: l.base + i*BytesPerLengthOffset, Err: ErrInvalidOffset}
+	}
+	return newLazy(l.r, l.base+start, end-start, elem, l.limits.inner(), false, path)
+}
+
+// Iterate returns an iterator over the elements of a list or vector.
+func (l *Lazy) Iterate() *LazyIterator {
+	return &LazyIterator{list: l}
+}
+
+// LazyIterator pages in the elements of a list or vector one at a time.
+//
+//  it := list.Iterate()
+//  for it.Next() {
+//      elem := it.Value()
+//  }
+//  if err := it.Err(); err != nil {
+//      return err
+//  }
+type LazyIterator struct {
+	list  *Lazy
+	index uint64
+	value *Lazy
+	err   error
+}
+
+// Next advances to the next element, returning false at the end of the list
+// or when an element cannot be read.
+func (it *LazyIterator) Next() bool {
+	if it.err != nil || it.index >= it.list.length {
+		return false
+	}
+	it.value, it.err = it.list.Index(it.index)
+	if it.err != nil {
+		return false
+	}
+	it.index++
+	return true
+}
+
+// Value returns the current element.
+func (it *LazyIterator) Value() *Lazy {
+	return it.value
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *LazyIterator) Err() error {
+	return it.err
+}
+
+// HashTreeRoot computes the hash tree root of the value. Small values and custom types
+// are read whole, while larger ones are streamed: basic lists and vectors are packed as
+// they are read, and composite ones are merkleized from the roots of their elements.
+func (l *Lazy) HashTreeRoot() ([32]byte, error) {
+	factory, err := factoryOf(reflect.Value{}, l.typ)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	if l.size <= lazyReadSize || l.isBitlistField || factory == codecFactory {
+		data, err := l.Bytes()
+		if err != nil {
+			return [32]byte{}, err
+		}
+		if l.isBitlistField {
+			return BitlistRoot(bitfield.Bitlist(data), l.limits.outer())
+		}
+		if err := validateEncoding(data, l.typ, l.limits); err != nil {
+			return [32]byte{}, annotateDecodeError(err, l.path, l.base)
+		}
+		return rootFromBytes(data, l.typ, l.limits)
+	}
+	switch {
+	case factory == StructFactory || factory == fastsszFactory:
+		return l.structRoot()
+	case factory == stringFactory:
+		limit := (l.limits.outer() + 31) / 32
+		if limit == 0 {
+			limit = 1
+		}
+		return l.packedRoot(limit, true)
+	case factory == basicFactory:
+		return l.packedRoot(0, false)
+	case factory == rootsArrayFactory:
+		m := &merkleizer{}
+		if err := l.stream(m); err != nil {
+			return [32]byte{}, err
+		}
+		return m.root(l.length)
+	case factory == basicSliceFactory && isBasicType(l.typ.Elem().Kind()):
+		limit := (l.limits.outer()*determineFixedTypeSize(l.typ.Elem()) + 31) / 32
+		if limit == 0 {
+			limit = l.length
+		}
+		return l.packedRoot(limit, true)
+	default:
+		return l.elementsRoot()
+	}
+}
+
+// stream feeds the encoding of the value to m in reads of at most lazyReadSize bytes.
+func (l *Lazy) stream(m *merkleizer) error {
+	kind := l.typ.Kind()
+	checkBools := (kind == reflect.Slice || kind == reflect.Array) && l.typ.Elem().Kind() == reflect.Bool
+	for offset := uint64(0); offset < l.size; offset += lazyReadSize {
+		n := l.size - offset
+		if n > lazyReadSize {
+			n = lazyReadSize
+		}
+		buf, err := l.readAt(offset, n)
+		if err != nil {
+			return annotateDecodeError(err, l.path, l.base)
+		}
+		if checkBools {
+			for i, b := range buf {
+				if b > 1 {
+					return &DecodeError{Path: l.path, Offset: l.base + offset + uint64(i), Err: ErrInvalidBool}
+				}
+			}
+		}
+		m.appendPacked(buf)
+	}
+	return nil
+}
+
+// packedRoot computes the root of basic values packed into chunks, mixing in the number
+// of elements for lists. Vectors are merkleized over exactly as many chunks as they fill.
+func (l *Lazy) packedRoot(limit uint64, isList bool) ([32]byte, error) {
+	m := &merkleizer{}
+	if err := l.stream(m); err != nil {
+		return [32]byte{}, err
+	}
+	m.flush()
+	if !isList {
+		return m.root(m.count)
+	}
+	root, err := m.root(limit)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return mixInLength(root, lengthChunk(l.length)), nil
+}
+
+// elementsRoot merkleizes the roots of the elements of a composite list or vector.
+func (l *Lazy) elementsRoot() ([32]byte, error) {
+	m := &merkleizer{}
+	it := l.Iterate()
+	for it.Next() {
+		r, err := it.Value().HashTreeRoot()
+		if err != nil {
+			return [32]byte{}, err
+		}
+		m.appendChunk(r[:])
+	}
+	if err := it.Err(); err != nil {
+		return [32]byte{}, err
+	}
+	variable := isVariableSizeType(l.typ.Elem())
+	if l.typ.Kind() == reflect.Array {
+		if l.length == 0 && variable {
+			return [32]byte{}, nil
+		}
+		if l.length == 0 {
+			m.appendChunk(nil)
+		}
+		return m.root(m.count)
+	}
+	limit := l.limits.outer()
+	if limit == 0 {
+		limit = l.length
+	}
+	if !variable {
+		if limit == 0 {
+			limit = 1
+		}
+		if l.length == 0 {
+			m.appendChunk(nil)
+		}
+	} else if l.length == 0 && l.limits.outer() > 0 {
+		m.appendChunk(nil)
+	}
+	root, err := m.root(limit)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return mixInLength(root, lengthChunk(l.length)), nil
+}
+
+// structRoot merkleizes the roots of the fields of a container.
+func (l *Lazy) structRoot() ([32]byte, error) {
+	m := &merkleizer{}
+	for _, item := range l.layout {
+		field, err := l.Field(item.field.Name)
+		if err != nil {
+			return [32]byte{}, err
+		}
+		r, err := field.HashTreeRoot()
+		if err != nil {
+			return [32]byte{}, err
+		}
+		m.appendChunk(r[:])
+	}
+	return m.root(m.count)
+}
@@ -0,0 +1,114 @@
+package types
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// listLimits holds the ssz-max limits of a value and of the lists nested within it, one
+// per level of nesting starting from the value itself, as in `ssz-max:"16,32"` for a
+// list of at most 16 lists of at most 32 elements each. A limit of 0 leaves a level
+// unbounded, and is written as "?" in tags, as in ssz-size tags.
+type listLimits []uint64
+
+// capacityLimits returns the limits of a value whose own limit is maxCapacity, such as
+// the capacity given to HashTreeRootWithCapacity.
+func capacityLimits(maxCapacity uint64) listLimits {
+	if maxCapacity == 0 {
+		return nil
+	}
+	return listLimits{maxCapacity}
+}
+
+// determineFieldLimits returns the limits of the ssz-max tag of a field, or no limits
+// when the field has no valid tag.
+func determineFieldLimits(field reflect.StructField) listLimits {
+	tag, exists := field.Tag.Lookup("ssz-max")
+	if !exists {
+		return nil
+	}
+	items := strings.Split(tag, ",")
+	limits := make(listLimits, len(items))
+	for i, item := range items {
+		if item == UnboundedSSZFieldSizeMarker {
+			continue
+		}
+		limit, err := strconv.ParseUint(item, 10, 64)
+		if err != nil {
+			return nil
+		}
+		limits[i] = limit
+	}
+	return limits
+}
+
+// outer returns the limit of the value itself.
+func (l listLimits) outer() uint64 {
+	if len(l) == 0 {
+		return 0
+	}
+	return l[0]
+}
+
+// inner returns the limits of the elements of the value.
+func (l listLimits) inner() listLimits {
+	if len(l) < 2 {
+		return nil
+	}
+	return l[1:]
+}
+
+// nested reports whether any list nested within the value has a limit.
+func (l listLimits) nested() bool {
+	for _, limit := range l.inner() {
+		if limit > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesToElements reports whether the elements of values of typ may hold lists with
+// limits of their own, which is only the case for lists and vectors of variable-size
+// elements.
+func (l listLimits) appliesToElements(typ reflect.Type) bool {
+	kind := typ.Kind()
+	if !l.nested() || (kind != reflect.Slice && kind != reflect.Array) || hasCodec(typ) {
+		return false
+	}
+	return typ != bitlistType && isVariableSizeType(typ.Elem())
+}
+
+// checkNestedLengths checks the lists nested within the encoding of a value of typ
+// against their limits before any of them is decoded. Malformed offsets are left to
+// be reported by the decoding.
+func checkNestedLengths(input []byte, typ reflect.Type, limits listLimits) error {
+	typ = derefType(typ)
+	if !limits.appliesToElements(typ) {
+		return nil
+	}
+	inner := limits.inner()
+	numItems := impliedListLength(reflect.SliceOf(typ.Elem()), input)
+	for i := 0; i < int(numItems); i++ {
+		start, end, elem, err := locateElement(input, reflect.SliceOf(typ.Elem()), i)
+		if err != nil {
+			return nil
+		}
+		if maxLength := inner.outer(); maxLength > 0 {
+			if length := impliedListLength(derefType(elem), input[start:end]); length > maxLength {
+				return &DecodeError{
+					Path:     indexPath(i),
+					Offset:   start,
+					Expected: maxLength,
+					Actual:   length,
+					Err:      ErrListTooLong,
+				}
+			}
+		}
+		if err := checkNestedLengths(input[start:end], elem, inner); err != nil {
+			return annotateDecodeError(err, indexPath(i), start)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ListHasher computes the hash tree root of a list from its elements, appended one at a
+// time. Only one pending node per level of the tree is kept, so the memory used grows
+// with the logarithm of the number of elements rather than with the elements themselves.
+type ListHasher struct {
+	elemType reflect.Type
+	limit    uint64
+	basic    bool
+	variable bool
+	length   uint64
+	m        merkleizer
+	// state is the scratch space the roots of elements are computed with.
+	state *HashState
+}
+
+// NewListHasher returns a hasher of a list of elemType elements, holding at most limit
+// elements when limit is set. Its roots are the same as the ones of the list computed
+// with the limit as its maximum capacity.
+func NewListHasher(elemType reflect.Type, limit uint64) (*ListHasher, error) {
+	elemType = derefType(elemType)
+	if _, err := factoryOf(reflect.New(elemType).Elem(), elemType); err != nil {
+		return nil, err
+	}
+	return &ListHasher{
+		elemType: elemType,
+		limit:    limit,
+		basic:    isBasicType(elemType.Kind()),
+		variable: isVariableSizeType(elemType),
+		state:    NewHashState(),
+	}, nil
+}
+
+// Append adds elem as the next element of the list. Basic elements are packed together
+// into chunks, while other elements contribute their hash tree root.
+func (h *ListHasher) Append(elem interface{}) error {
+	val := reflect.ValueOf(elem)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			val = reflect.New(val.Type().Elem())
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() || !isAppendable(val.Type(), h.elemType) {
+		return fmt.Errorf("cannot append value of type %T to list of %v", elem, h.elemType)
+	}
+	if err := h.checkLimit(); err != nil {
+		return err
+	}
+	if h.basic {
+		enc, err := encodeValue(val, h.elemType)
+		if err != nil {
+			return annotateEncodeError(err, indexPath(int(h.length)))
+		}
+		h.m.appendPacked(enc)
+		h.length++
+		return nil
+	}
+	factory, err := factoryOf(val, h.elemType)
+	if err != nil {
+		return err
+	}
+	r, err := factory.root(val, h.elemType, "", nil, h.state)
+	if err != nil {
+		return err
+	}
+	h.m.appendChunk(r[:])
+	h.length++
+	return nil
+}
+
+// AppendRoot adds an element of the list from its hash tree root, computed beforehand.
+// Lists of basic elements are packed rather than made of element roots, so their
+// elements can only be added with Append.
+func (h *ListHasher) AppendRoot(root [32]byte) error {
+	if h.basic {
+		return errors.New("cannot append root to list of basic elements")
+	}
+	if err := h.checkLimit(); err != nil {
+		return err
+	}
+	h.m.appendChunk(root[:])
+	h.length++
+	return nil
+}
+
+// Len returns the number of elements appended so far.
+func (h *ListHasher) Len() uint64 {
+	return h.length
+}
+
+// Root returns the hash tree root of the list of the elements appended so far, with
+// its length mixed in. More elements may still be appended afterwards.
+func (h *ListHasher) Root() ([32]byte, error) {
+	if h.variable && h.limit == 0 && h.length == 0 {
+		return mixInLength([32]byte{}, lengthChunk(0)), nil
+	}
+	limit := h.limit
+	if h.basic {
+		limit = (h.limit*determineFixedTypeSize(h.elemType) + 31) / 32
+	}
+	if limit == 0 {
+		limit = h.length
+		if limit == 0 {
+			limit = 1
+		}
+	}
+	root, err := h.m.root(limit)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return mixInLength(root, lengthChunk(h.length)), nil
+}
+
+func (h *ListHasher) checkLimit() error {
+	if h.limit > 0 && h.length >= h.limit {
+		return &EncodeError{Expected: h.limit, Actual: h.length + 1, Err: ErrListTooLong}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package types
+
+import (
+	"errors"
+
+	"github.com/protolambda/zssz/merkle"
+)
+
+// merkleizer computes the Merkle root of chunks appended one at a time, keeping a
+// single pending node per level of the tree rather than every chunk. Its roots are
+// the same as the ones of bitwiseMerkleize over all the appended chunks.
+type merkleizer struct {
+	// nodes[i] holds the root of the last complete subtree of 2^i chunks, and is
+	// only pending when bit i of count is set.
+	nodes   [][32]byte
+	count   uint64
+	partial []byte
+}
+
+// appendChunk adds a chunk, right-padded with zero bytes if shorter than BytesPerChunk.
+func (m *merkleizer) appendChunk(chunk []byte) {
+	var node [32]byte
+	copy(node[:], chunk)
+	level := 0
+	for m.count>>uint(level)&1 == 1 {
+		node = hash(append(m.nodes[level][:], node[:]...))
+		level++
+	}
+	if level == len(m.nodes) {
+		m.nodes = append(m.nodes, node)
+	} else {
+		m.nodes[level] = node
+	}
+	m.count++
+}
+
+// appendPacked packs serialized basic values into chunks. Bytes which do not fill a
+// whole chunk are kept until more are appended, or the root is computed.
+func (m *merkleizer) appendPacked(data []byte) {
+	if len(m.partial) > 0 {
+		n := BytesPerChunk - len(m.partial)
+		if n > len(data) {
+			n = len(data)
+		}
+		m.partial = append(m.partial, data[:n]...)
+		data = data[n:]
+		if len(m.partial) < BytesPerChunk {
+			return
+		}
+		m.appendChunk(m.partial)
+		m.partial = m.partial[:0]
+	}
+	for len(data) >= BytesPerChunk {
+		m.appendChunk(data[:BytesPerChunk])
+		data = data[BytesPerChunk:]
+	}
+	m.partial = append(m.partial, data...)
+}
+
+// flush pads any packed bytes left into a final chunk.
+func (m *merkleizer) flush() {
+	if len(m.partial) > 0 {
+		m.appendChunk(m.partial)
+		m.partial = m.partial[:0]
+	}
+}
+
+// root returns the root of the chunks appended so far in a tree sized for limit chunks.
+// Packed bytes still pending count as a final chunk, but m is left unchanged so more
+// chunks can be appended afterwards.
+func (m *merkleizer) root(limit uint64) ([32]byte, error) {
+	if len(m.partial) > 0 {
+		pending := &merkleizer{nodes: append([][32]byte{}, m.nodes...), count: m.count}
+		pending.appendChunk(m.partial)
+		return pending.root(limit)
+	}
+	if m.count > limit {
+		return [32]byte{}, errors.New("merkleizing list that is too large, over limit")
+	}
+	if limit == 0 {
+		return [32]byte{}, nil
+	}
+	depth := int(merkle.GetDepth(limit))
+	if m.count == 0 {
+		return zeroHashes()[depth], nil
+	}
+	// Fold the pending subtrees from the bottom up, completing each level with
+	// zero hashes where no chunks were appended.
+	var root [32]byte
+	started := false
+	for level := 0; level < depth; level++ {
+		if m.count>>uint(level)&1 == 1 {
+			if started {
+				root = hash(append(m.nodes[level][:], root[:]...))
+			} else {
+				root = hash(append(m.nodes[level][:], zeroHashes()[level][:]...))
+				started = true
+			}
+		} else if started {
+			root = hash(append(root[:], zeroHashes()[level][:]...))
+		}
+	}
+	if !started {
+		// The chunks form a full tree of the given depth.
+		return m.nodes[depth], nil
+	}
+	return root, nil
+}
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestMerkleizer_MatchesBitwiseMerkleize(t *testing.T) {
+	for _, count := range []uint64{0, 1, 2, 3, 4, 5, 7, 8, 9, 31, 64, 100} {
+		for _, extra := range []uint64{0, 1, 5, 1000} {
+			limit := count + extra
+			chunks := make([][]byte, count)
+			m := &merkleizer{}
+			for i := range chunks {
+				chunk := make([]byte, BytesPerChunk)
+				chunk[0] = byte(i + 1)
+				chunks[i] = chunk
+				m.appendChunk(chunk)
+			}
+			want, err := bitwiseMerkleize(chunks, count, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := m.root(limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want != got {
+				t.Errorf("Count %d, limit %d: expected root %#x, received %#x", count, limit, want, got)
+			}
+		}
+	}
+}
+
+func TestMerkleizer_AppendPacked(t *testing.T) {
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	chunks, err := pack([][]byte{data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := bitwiseMerkleize(chunks, uint64(len(chunks)), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bytes split across chunk boundaries are packed the same as in one piece.
+	m := &merkleizer{}
+	for i := 0; i < len(data); i += 7 {
+		end := i + 7
+		if end > len(data) {
+			end = len(data)
+		}
+		m.appendPacked(data[i:end])
+	}
+	got, err := m.root(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != got {
+		t.Errorf("Expected root %#x, received %#x", want, got)
+	}
+	if _, err := m.root(1); err == nil {
+		t.Error("Expected merkleizing over the limit to fail")
+	}
+}
+
+func TestMerkleizer_RootLeavesPendingBytes(t *testing.T) {
+	m := &merkleizer{}
+	m.appendPacked([]byte{1, 2, 3})
+	if _, err := m.root(4); err != nil {
+		t.Fatal(err)
+	}
+	m.appendPacked([]byte{4, 5})
+	got, err := m.root(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := make([]byte, 32)
+	copy(chunk, []byte{1, 2, 3, 4, 5})
+	want, err := bitwiseMerkleize([][]byte{chunk}, 1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want != got {
+		t.Errorf("Expected root %#x, received %#x", want, got)
+	}
+}
@@ -0,0 +1,304 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// pathSegment is a single step of a field path, either the name of a struct
+// field or the index of a list or vector element.
+type pathSegment struct {
+	name  string
+	index int
+}
+
+func (s pathSegment) String() string {
+	if s.name != "" {
+		return s.name
+	}
+	return indexPath(s.index)
+}
+
+// parseFieldPath splits a path such as LatestBlockHeader.Slot or Validators[3].Pubkey
+// into its segments.
+func parseFieldPath(path string) ([]pathSegment, error) {
+	if path == "" {
+		return nil, fmt.Errorf("empty field path")
+	}
+	var segments []pathSegment
+	for i, part := range strings.Split(path, ".") {
+		name, indices := part, ""
+		if j := strings.IndexByte(part, '['); j >= 0 {
+			name, indices = part[:j], part[j:]
+		}
+		// Only the first segment of a path may start with an index.
+		if name == "" && (i > 0 || indices == "") {
+			return nil, fmt.Errorf("invalid field path %q", path)
+		}
+		if name != "" {
+			segments = append(segments, pathSegment{name: name})
+		}
+		for indices != "" {
+			end := strings.IndexByte(indices, ']')
+			if indices[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("invalid field path %q", path)
+			}
+			index, err := strconv.Atoi(indices[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index in field path %q", path)
+			}
+			segments = append(segments, pathSegment{index: index})
+			indices = indices[end+1:]
+		}
+	}
+	return segments, nil
+}
+
+// FieldBytes returns the encoding of the value found at path within input, the SSZ
+// encoding of a value of type typ. The path is made of field names separated by dots,
+// with list and vector elements selected by index, such as Validators[3].Pubkey. Only
+// the offsets leading to the value are read, so nothing else in the input is decoded.
+func FieldBytes(input []byte, typ reflect.Type, path string) ([]byte, error) {
+	segments, err := parseFieldPath(path)
+	if err != nil {
+		return nil, err
+	}
+	data, _, _, err := locateField(input, typ, segments)
+	return data, err
+}
+
+// UnmarshalFields decodes only the fields at the given paths of input, the SSZ encoding
+// of val, leaving every other field of val untouched. Paths are field names separated
+// by dots, such as Fork or LatestBlockHeader.Slot.
+func UnmarshalFields(input []byte, val reflect.Value, paths []string, state *DecodeState) error {
+	for _, path := range paths {
+		segments, err := parseFieldPath(path)
+		if err != nil {
+			return err
+		}
+		if err := unmarshalField(input, val, segments, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unmarshalField(input []byte, val reflect.Value, segments []pathSegment, state *DecodeState) error {
+	data, offset, fType, err := locateField(input, val.Type(), segments)
+	if err != nil {
+		return err
+	}
+	// Walk the value alongside the path, instantiating any pointers on the way.
+	var field reflect.StructField
+	for _, segment := range segments {
+		if segment.name == "" {
+			return fmt.Errorf("cannot unmarshal into list element %s", segment)
+		}
+		for val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				instantiateConcreteTypeForElement(val, val.Type().Elem())
+			}
+			val = val.Elem()
+		}
+		field, _ = val.Type().FieldByName(segment.name)
+		val = val.FieldByIndex(field.Index)
+	}
+	path := joinSegments(segments)
+	// Variable-size fields without any bytes are left as zero values, as in a full decoding.
+	if len(data) == 0 && isVariableSizeType(fType) {
+		val.Set(reflect.Zero(val.Type()))
+		return nil
+	}
+	if val.Kind() == reflect.Ptr {
+		instantiateConcreteTypeForElement(val, val.Type().Elem())
+	}
+	sszSizeTags, hasTags, err := parseSSZFieldTags(field)
+	if err != nil {
+		return err
+	}
+	if hasTags && val.Kind() == reflect.Slice && !isVariableSizeType(fType) {
+		result, err := growSliceFromSizeTags(val, sszSizeTags, state, offset)
+		if err != nil {
+			return annotateDecodeError(err, path, 0)
+		}
+		val.Set(result)
+	}
+	if err := checkNestedLengths(data, fType, determineFieldLimits(field)); err != nil {
+		return annotateDecodeError(err, path, offset)
+	}
+	factory, err := factoryOf(val, fType)
+	if err != nil {
+		return err
+	}
+	end, err := factory.unmarshal(val, fType, data, 0, state)
+	if err != nil {
+		return annotateDecodeError(err, path, offset)
+	}
+	if end != uint64(len(data)) && !isVariableSizeType(fType) {
+		return &DecodeError{
+			Path:     path,
+			Offset:   offset,
+			Expected: uint64(len(data)),
+			Actual:   end,
+			Err:      ErrSizeMismatch,
+		}
+	}
+	if maxLength := determineFieldCapacity(field); maxLength > 0 {
+		if length := fieldLength(val); length > maxLength {
+			return &DecodeError{
+				Path:     path,
+				Offset:   offset,
+				Expected: maxLength,
+				Actual:   length,
+				Err:      ErrListTooLong,
+			}
+		}
+	}
+	return nil
+}
+
+// locateField follows segments through the layout of typ encoded as input, returning the
+// bytes of the value reached, their offset within input and the type to decode them with.
+func locateField(input []byte, typ reflect.Type, segments []pathSegment) ([]byte, uint64, reflect.Type, error) {
+	base := uint64(0)
+	for i, segment := range segments {
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		var start, end uint64
+		var err error
+		if segment.name != "" {
+			start, end, typ, err = locateStructField(input, typ, segment.name)
+		} else {
+			start, end, typ, err = locateElement(input, typ, segment.index)
+		}
+		if err != nil {
+			return nil, 0, nil, annotateDecodeError(err, joinSegments(segments[:i]), base)
+		}
+		input = input[start:end]
+		base += start
+	}
+	return input, base, typ, nil
+}
+
+// locateStructField returns the bounds of the named field within the encoding of a
+// container of type typ, and the type to decode the field with.
+func locateStructField(input []byte, typ reflect.Type, name string) (uint64, uint64, reflect.Type, error) {
+	if typ.Kind() != reflect.Struct || hasCodec(typ) {
+		return 0, 0, nil, fmt.Errorf("cannot select field %s of non-struct type %v", name, typ)
+	}
+	layout, bounds, err := structBounds(input, typ)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	for i, item := range layout {
+		if item.field.Name == name {
+			return bounds[i][0], bounds[i][1], item.fType, nil
+		}
+	}
+	return 0, 0, nil, fmt.Errorf("type %v has no field %s", typ, name)
+}
+
+// structBounds returns the layout of the fields of a container of type typ, and where
+// each field starts and ends within input, its encoding. The offsets of variable-size
+// fields are checked as they are when decoding: the variable-size part must start
+// right after the fixed-size part, and each variable-size field ends where the next
+// one starts.
+func structBounds(input []byte, typ reflect.Type) ([]fieldLayout, [][2]uint64, error) {
+	layout, fixedLength, err := structLayout(typ)
+	if err != nil {
+		return nil, nil, err
+	}
+	size := uint64(len(input))
+	if fixedLength > size {
+		return nil, nil, &DecodeError{Expected: fixedLength, Actual: size, Err: ErrShortInput}
+	}
+	bounds := make([][2]uint64, len(layout))
+	previous := -1
+	for i, item := range layout {
+		if !item.variable {
+			bounds[i] = [2]uint64{item.position, item.position + item.size}
+			continue
+		}
+		offset := uint64(binary.LittleEndian.Uint32(input[item.position : item.position+BytesPerLengthOffset]))
+		switch {
+		case offset > size:
+			return nil, nil, &DecodeError{Path: item.field.Name, Offset: item.position, Expected: size, Actual: offset, Err: ErrOffsetOutOfRange}
+		case previous < 0 && offset != fixedLength:
+			return nil, nil, &DecodeError{Offset: item.position, Expected: fixedLength, Actual: offset, Err: ErrInvalidOffset}
+		case previous >= 0 && offset < bounds[previous][0]:
+			return nil, nil, &DecodeError{Path: item.field.Name, Offset: item.position, Err: ErrInvalidOffset}
+		}
+		if previous >= 0 {
+			bounds[previous][1] = offset
+		}
+		bounds[i] = [2]uint64{offset, size}
+		previous = i
+	}
+	if previous < 0 && fixedLength != size {
+		return nil, nil, &DecodeError{Expected: fixedLength, Actual: size, Err: ErrSizeMismatch}
+	}
+	return layout, bounds, nil
+}
+
+// locateElement returns the bounds of the element at index within the encoding of a
+// list or vector of type typ, and the type to decode the element with.
+func locateElement(input []byte, typ reflect.Type, index int) (uint64, uint64, reflect.Type, error) {
+	if (typ.Kind() != reflect.Slice && typ.Kind() != reflect.Array) || hasCodec(typ) {
+		return 0, 0, nil, fmt.Errorf("cannot select element %d of non-list type %v", index, typ)
+	}
+	elem := typ.Elem()
+	endOffset := uint64(len(input))
+	var length, start, end uint64
+	if isVariableSizeType(elem) {
+		if endOffset > 0 {
+			firstOffset, err := readFirstOffset(input, 0)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			length = firstOffset / BytesPerLengthOffset
+		}
+		if uint64(index) < length {
+			var err error
+			start, err = readNextOffset(input, 0, uint64(index)*BytesPerLengthOffset, 0)
+			if err != nil {
+				return 0, 0, nil, annotateDecodeError(err, indexPath(index), 0)
+			}
+			end = endOffset
+			if uint64(index)+1 < length {
+				end, err = readNextOffset(input, 0, uint64(index+1)*BytesPerLengthOffset, start)
+				if err != nil {
+					return 0, 0, nil, annotateDecodeError(err, indexPath(index+1), 0)
+				}
+			}
+		}
+	} else {
+		size := determineFixedTypeSize(elem)
+		if size > 0 {
+			length = endOffset / size
+		}
+		start, end = uint64(index)*size, uint64(index+1)*size
+	}
+	if typ.Kind() == reflect.Array && length != uint64(typ.Len()) {
+		return 0, 0, nil, &DecodeError{
+			Expected: uint64(typ.Len()),
+			Actual:   length,
+			Err:      ErrVectorLength,
+		}
+	}
+	if uint64(index) >= length {
+		return 0, 0, nil, fmt.Errorf("index %d out of range for list of length %d", index, length)
+	}
+	return start, end, elem, nil
+}
+
+func joinSegments(segments []pathSegment) string {
+	path := ""
+	for _, segment := range segments {
+		path = JoinFieldPath(path, segment.String())
+	}
+	return path
+}
@@ -1,9 +1,10 @@
 package types
 
 import (
-	"bytes"
-	"encoding/binary"
+	"context"
+	"math"
 	"reflect"
+	"sync"
 )
 
 type basicSliceSSZ struct{}
@@ -12,14 +13,17 @@ func newBasicSliceSSZ() *basicSliceSSZ {
 	return &basicSliceSSZ{}
 }
 
-func (b *basicSliceSSZ) Root(val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64) ([32]byte, error) {
-	var factory SSZAble
+func (b *basicSliceSSZ) root(val reflect.Value, typ reflect.Type, fieldName string, limits listLimits, state *HashState) ([32]byte, error) {
+	if state == nil {
+		state = NewHashState()
+	}
+	var factory sszFactory
 	var limit uint64
 	var elemSize uint64
 	var err error
 	numItems := val.Len()
 	if numItems > 0 {
-		factory, err = SSZFactory(val.Index(0), typ.Elem())
+		factory, err = factoryOf(val.Index(0), typ.Elem())
 		if err != nil {
 			return [32]byte{}, err
 		}
@@ -30,7 +34,7 @@ func (b *basicSliceSSZ) Root(val reflect.Value, typ reflect.Type, fieldName stri
 	} else {
 		elemSize = 32
 	}
-	limit = (maxCapacity*elemSize + 31) / 32
+	limit = (limits.outer()*elemSize + 31) / 32
 	if limit == 0 {
 		if numItems == 0 {
 			limit = 1
@@ -38,64 +42,73 @@ func (b *basicSliceSSZ) Root(val reflect.Value, typ reflect.Type, fieldName stri
 			limit = uint64(numItems)
 		}
 	}
-	leaves := make([][]byte, numItems)
-	for i := 0; i < numItems; i++ {
-		if isBasicType(val.Index(i).Kind()) {
-			innerBuf := make([]byte, elemSize)
-			if _, err = factory.Marshal(val.Index(i), typ.Elem(), innerBuf, 0); err != nil {
-				return [32]byte{}, err
-			}
-			leaves[i] = innerBuf
-		} else {
-			r, err := factory.Root(val.Index(i), typ.Elem(), fieldName, 0)
-			if err != nil {
-				return [32]byte{}, err
+	mark := state.mark()
+	defer state.pop(mark)
+	if enc, ok := bulkBytes(val); ok {
+		// The serialized list is packed into chunks as a whole.
+		state.stack = append(state.stack, enc...)
+	} else {
+		for i := 0; i < numItems; i++ {
+			if isBasicType(val.Index(i).Kind()) {
+				index := state.mark()
+				state.pushZeroes(int(elemSize))
+				if _, err = factory.marshal(state.ctx, val.Index(i), typ.Elem(), state.stack, uint64(index)); err != nil {
+					return [32]byte{}, err
+				}
+			} else {
+				r, err := factory.root(val.Index(i), typ.Elem(), fieldName, nil, state)
+				if err != nil {
+					return [32]byte{}, err
+				}
+				state.pushRoot(r)
 			}
-			leaves[i] = r[:]
 		}
 	}
-	chunks, err := pack(leaves)
+	state.packChunks(mark)
+	merkleRoot, err := state.merkleize(mark, limit)
 	if err != nil {
 		return [32]byte{}, err
 	}
-	buf := new(bytes.Buffer)
-	if err := binary.Write(buf, binary.LittleEndian, uint64(val.Len())); err != nil {
-		return [32]byte{}, err
-	}
-	output := make([]byte, 32)
-	copy(output, buf.Bytes())
-	merkleRoot, err := bitwiseMerkleize(chunks, uint64(len(chunks)), limit)
-	if err != nil {
-		return [32]byte{}, err
-	}
-	return mixInLength(merkleRoot, output), nil
+	return state.mixInLength(merkleRoot, uint64(numItems)), nil
 }
 
-func (b *basicSliceSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+func (b *basicSliceSSZ) marshal(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
 	index := startOffset
 	var err error
 	if val.Len() == 0 {
 		return index, nil
 	}
-	factory, err := SSZFactory(val.Index(0), typ.Elem())
+	if enc, ok := bulkBytes(val); ok {
+		return index + uint64(copy(buf[index:], enc)), nil
+	}
+	factory, err := factoryOf(val.Index(0), typ.Elem())
 	if err != nil {
 		return 0, err
 	}
 	for i := 0; i < val.Len(); i++ {
-		index, err = factory.Marshal(val.Index(i), typ.Elem(), buf, index)
+		index, err = factory.marshal(ctx, val.Index(i), typ.Elem(), buf, index)
 		if err != nil {
-			return 0, err
+			return 0, annotateEncodeError(err, indexPath(i))
 		}
 	}
 	return index, nil
 }
 
-func (b *basicSliceSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64) (uint64, error) {
+func (b *basicSliceSSZ) unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64, state *DecodeState) (uint64, error) {
 	if len(input) == 0 {
 		newVal := reflect.MakeSlice(val.Type(), 0, 0)
 		val.Set(newVal)
 		return 0, nil
 	}
+	if err := state.enter(startOffset); err != nil {
+		return 0, err
+	}
+	defer state.leave()
+	// Lists of integers are decoded by copying the input into their memory as a whole
+	// on little-endian platforms, when it holds at least one element.
+	if val.Type() == typ && startOffset == 0 && hostLittleEndian && isBulkKind(typ.Elem().Kind()) && uint64(len(input)) >= uint64(typ.Elem().Size()) {
+		return b.unmarshalBulk(val, typ, input, state)
+	}
 	// If there are struct tags that specify a different type, we handle accordingly.
 	if val.Type() != typ {
 		sizes := []uint64{1}
@@ -112,25 +125,43 @@ func (b *basicSliceSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []b
 			}
 		}
 		// If the item is a slice, we grow it accordingly based on the size tags.
-		result := growSliceFromSizeTags(val, sizes)
+		result, err := growSliceFromSizeTags(val, sizes, state, startOffset)
+		if err != nil {
+			return 0, err
+		}
 		reflect.Copy(result, val)
 		val.Set(result)
-	} else {
-		growConcreteSliceType(val, val.Type(), 1)
+	} else if err := growConcreteSliceType(val, val.Type(), 1, state, startOffset); err != nil {
+		return 0, err
 	}
 
 	var err error
 	index := startOffset
-	factory, err := SSZFactory(val.Index(0), typ.Elem())
+	factory, err := factoryOf(val.Index(0), typ.Elem())
 	if err != nil {
 		return 0, err
 	}
-	index, err = factory.Unmarshal(val.Index(0), typ.Elem(), input, index)
+	allocated := state.allocatedBytes()
+	index, err = factory.unmarshal(val.Index(0), typ.Elem(), input, index, state)
 	if err != nil {
-		return 0, err
+		return 0, annotateDecodeError(err, indexPath(0), 0)
 	}
+	elemAllocation := state.allocatedBytes() - allocated
 
 	elementSize := index - startOffset
+	// Elements of a basic list have a fixed size, so the input must hold
+	// a whole number of them.
+	if elementSize == 0 {
+		return 0, &DecodeError{Offset: startOffset, Err: ErrSizeMismatch}
+	}
+	if remainder := uint64(len(input)) % elementSize; remainder != 0 {
+		return 0, &DecodeError{
+			Offset:   uint64(len(input)) - remainder,
+			Expected: uint64(len(input)) - remainder,
+			Actual:   uint64(len(input)),
+			Err:      ErrSizeMismatch,
+		}
+	}
 	endOffset := uint64(len(input)) / elementSize
 	if val.Type() != typ {
 		sizes := []uint64{endOffset}
@@ -147,20 +178,104 @@ func (b *basicSliceSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []b
 			}
 		}
 		// If the item is a slice, we grow it accordingly based on the size tags.
-		result := growSliceFromSizeTags(val, sizes)
+		result, err := growSliceFromSizeTags(val, sizes, state, startOffset)
+		if err != nil {
+			return 0, err
+		}
 		reflect.Copy(result, val)
 		val.Set(result)
 	}
+	if val.Type() == typ {
+		if err := growConcreteSliceType(val, val.Type(), int(endOffset), state, startOffset); err != nil {
+			return 0, err
+		}
+	}
+	if workers := state.parallelWorkers(endOffset); workers > 1 && val.Type() == typ && derefType(typ.Elem()).Kind() == reflect.Struct {
+		// Every element of a list of fixed-size containers allocates as much as the
+		// first one, so the remaining elements are accounted for up front. Lists which
+		// would exceed the allocation limit are left to the serial path to report.
+		remaining := endOffset - 1
+		if elemAllocation == 0 || remaining <= math.MaxUint64/elemAllocation {
+			if state.allocateBytes(remaining*elemAllocation, startOffset) == nil {
+				return b.unmarshalParallel(val, typ, factory, input, startOffset, elementSize, endOffset, workers, state)
+			}
+		}
+	}
 	i := uint64(1)
 	for i < endOffset {
-		if val.Type() == typ {
-			growConcreteSliceType(val, val.Type(), int(i)+1)
-		}
-		index, err = factory.Unmarshal(val.Index(int(i)), typ.Elem(), input, index)
+		index, err = factory.unmarshal(val.Index(int(i)), typ.Elem(), input, index, state)
 		if err != nil {
-			return 0, err
+			return 0, annotateDecodeError(err, indexPath(int(i)), 0)
 		}
 		i++
 	}
 	return index, nil
 }
+
+func (b *basicSliceSSZ) unmarshalBulk(val reflect.Value, typ reflect.Type, input []byte, state *DecodeState) (uint64, error) {
+	elemSize := uint64(typ.Elem().Size())
+	if remainder := uint64(len(input)) % elemSize; remainder != 0 {
+		return 0, &DecodeError{
+			Offset:   uint64(len(input)) - remainder,
+			Expected: uint64(len(input)) - remainder,
+			Actual:   uint64(len(input)),
+			Err:      ErrSizeMismatch,
+		}
+	}
+	if err := growConcreteSliceType(val, typ, int(uint64(len(input))/elemSize), state, 0); err != nil {
+		return 0, err
+	}
+	dst, _ := bulkBytes(val)
+	copy(dst, input)
+	return uint64(len(input)), nil
+}
+
+// unmarshalParallel decodes the elements of a list of fixed-size containers after the
+// first one, which was decoded already, splitting them into contiguous ranges decoded
+// on workers goroutines. Each worker stops at its first error, and the error of the
+// earliest range is returned, which is the error the serial path returns.
+func (b *basicSliceSSZ) unmarshalParallel(
+	val reflect.Value,
+	typ reflect.Type,
+	factory sszFactory,
+	input []byte,
+	startOffset uint64,
+	elementSize uint64,
+	length uint64,
+	workers int,
+	state *DecodeState,
+) (uint64, error) {
+	rangeSize := (length - 1 + uint64(workers) - 1) / uint64(workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start := 1 + uint64(w)*rangeSize
+		end := start + rangeSize
+		if end > length {
+			end = length
+		}
+		if start >= end {
+			break
+		}
+		wg.Add(1)
+		go func(w int, start uint64, end uint64) {
+			defer wg.Done()
+			// The limits were enforced on the first element, which every other
+			// element of the list shares its layout with.
+			workerState := state.workerState()
+			for i := start; i < end; i++ {
+				if _, err := factory.unmarshal(val.Index(int(i)), typ.Elem(), input, startOffset+i*elementSize, workerState); err != nil {
+					errs[w] = annotateDecodeError(err, indexPath(int(i)), 0)
+					return
+				}
+			}
+		}(w, start, end)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+	return startOffset + length*elementSize, nil
+}
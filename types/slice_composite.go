@@ -1,7 +1,7 @@
 package types
 
 import (
-	"bytes"
+	"context"
 	"encoding/binary"
 	"reflect"
 )
@@ -12,68 +12,66 @@ func newCompositeSliceSSZ() *compositeSliceSSZ {
 	return &compositeSliceSSZ{}
 }
 
-func (b *compositeSliceSSZ) Root(val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64) ([32]byte, error) {
-	output := make([]byte, 32)
-	if val.Len() == 0 && maxCapacity == 0 {
-		root, err := bitwiseMerkleize([][]byte{}, 0, 0)
-		if err != nil {
-			return [32]byte{}, err
-		}
-		return mixInLength(root, output), nil
+func (b *compositeSliceSSZ) root(val reflect.Value, typ reflect.Type, fieldName string, limits listLimits, state *HashState) ([32]byte, error) {
+	maxCapacity := limits.outer()
+	if state == nil {
+		state = NewHashState()
 	}
 	numItems := val.Len()
-	var factory SSZAble
+	if numItems == 0 && maxCapacity == 0 {
+		return state.mixInLength([32]byte{}, 0), nil
+	}
+	var factory sszFactory
 	var err error
 	if numItems > 0 {
-		factory, err = SSZFactory(val.Index(0), typ.Elem())
+		factory, err = factoryOf(val.Index(0), typ.Elem())
 		if err != nil {
 			return [32]byte{}, err
 		}
 	}
-	roots := make([][]byte, numItems)
+	mark := state.mark()
+	defer state.pop(mark)
 	for i := 0; i < numItems; i++ {
-		r, err := factory.Root(val.Index(i), typ.Elem(), fieldName, 0)
+		if err := state.checkContext(); err != nil {
+			return [32]byte{}, err
+		}
+		r, err := factory.root(val.Index(i), typ.Elem(), fieldName, limits.inner(), state)
 		if err != nil {
 			return [32]byte{}, err
 		}
-		roots[i] = r[:]
-	}
-	chunks, err := pack(roots)
-	if err != nil {
-		return [32]byte{}, err
-	}
-	buf := new(bytes.Buffer)
-	if err := binary.Write(buf, binary.LittleEndian, uint64(val.Len())); err != nil {
-		return [32]byte{}, err
+		state.pushRoot(r)
 	}
-	copy(output, buf.Bytes())
+	state.packChunks(mark)
 	objLen := maxCapacity
 	if maxCapacity == 0 {
-		objLen = uint64(val.Len())
+		objLen = uint64(numItems)
 	}
-	root, err := bitwiseMerkleize(chunks, uint64(len(chunks)), objLen)
+	root, err := state.merkleize(mark, objLen)
 	if err != nil {
 		return [32]byte{}, err
 	}
-	return mixInLength(root, output), nil
+	return state.mixInLength(root, uint64(numItems)), nil
 }
 
-func (b *compositeSliceSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+func (b *compositeSliceSSZ) marshal(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
 	index := startOffset
 	if val.Len() == 0 {
 		return index, nil
 	}
-	factory, err := SSZFactory(val.Index(0), typ.Elem())
+	factory, err := factoryOf(val.Index(0), typ.Elem())
 	if err != nil {
 		return 0, err
 	}
 	if !isVariableSizeType(typ.Elem()) {
 		for i := 0; i < val.Len(); i++ {
+			if err := checkContext(ctx); err != nil {
+				return 0, err
+			}
 			// If each element is not variable size, we simply encode sequentially and write
 			// into the buffer at the last index we wrote at.
-			index, err = factory.Marshal(val.Index(i), typ.Elem(), buf, index)
+			index, err = factory.marshal(ctx, val.Index(i), typ.Elem(), buf, index)
 			if err != nil {
-				return 0, err
+				return 0, annotateEncodeError(err, indexPath(i))
 			}
 		}
 		return index, nil
@@ -84,10 +82,13 @@ func (b *compositeSliceSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []b
 	// If the elements are variable size, we need to include offset indices
 	// in the serialized output list.
 	for i := 0; i < val.Len(); i++ {
-		nextOffsetIndex, err = factory.Marshal(val.Index(i), typ.Elem(), buf, currentOffsetIndex)
-		if err != nil {
+		if err := checkContext(ctx); err != nil {
 			return 0, err
 		}
+		nextOffsetIndex, err = factory.marshal(ctx, val.Index(i), typ.Elem(), buf, currentOffsetIndex)
+		if err != nil {
+			return 0, annotateEncodeError(err, indexPath(i))
+		}
 		// Write the offset.
 		offsetBuf := make([]byte, BytesPerLengthOffset)
 		binary.LittleEndian.PutUint32(offsetBuf, uint32(currentOffsetIndex-startOffset))
@@ -101,19 +102,28 @@ func (b *compositeSliceSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []b
 	return index, nil
 }
 
-func (b *compositeSliceSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64) (uint64, error) {
+func (b *compositeSliceSSZ) unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64, state *DecodeState) (uint64, error) {
 	if len(input) == 0 {
 		newVal := reflect.MakeSlice(val.Type(), 0, 0)
 		val.Set(newVal)
 		return 0, nil
 	}
-	growConcreteSliceType(val, typ, 1)
+	if err := state.enter(startOffset); err != nil {
+		return 0, err
+	}
+	defer state.leave()
 	endOffset := uint64(len(input))
+	firstOffset, err := readFirstOffset(input, startOffset)
+	if err != nil {
+		return 0, err
+	}
+	// The number of elements is bounded by the input length, as each one needs an offset.
+	if err := growConcreteSliceType(val, typ, int((firstOffset-startOffset)/BytesPerLengthOffset), state, startOffset); err != nil {
+		return 0, err
+	}
 
 	currentIndex := startOffset
 	nextIndex := currentIndex
-	offsetVal := input[startOffset : startOffset+BytesPerLengthOffset]
-	firstOffset := startOffset + uint64(binary.LittleEndian.Uint32(offsetVal))
 	currentOffset := firstOffset
 	nextOffset := currentOffset
 	i := 0
@@ -122,20 +132,17 @@ func (b *compositeSliceSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input
 		if nextIndex == firstOffset {
 			nextOffset = endOffset
 		} else {
-			nextOffsetVal := input[nextIndex : nextIndex+BytesPerLengthOffset]
-			nextOffset = startOffset + uint64(binary.LittleEndian.Uint32(nextOffsetVal))
-		}
-		if nextOffset < currentOffset {
-			break
+			nextOffset, err = readNextOffset(input, startOffset, nextIndex, currentOffset)
+			if err != nil {
+				return 0, annotateDecodeError(err, indexPath(i+1), 0)
+			}
 		}
-		// We grow the slice's size to accommodate a new element being unmarshaled.
-		growConcreteSliceType(val, typ, i+1)
-		factory, err := SSZFactory(val.Index(i), typ.Elem())
+		factory, err := factoryOf(val.Index(i), typ.Elem())
 		if err != nil {
 			return 0, err
 		}
-		if _, err := factory.Unmarshal(val.Index(i), typ.Elem(), input[currentOffset:nextOffset], 0); err != nil {
-			return 0, err
+		if _, err := factory.unmarshal(val.Index(i), typ.Elem(), input[currentOffset:nextOffset], 0, state); err != nil {
+			return 0, annotateDecodeError(err, indexPath(i), currentOffset)
 		}
 		i++
 		currentIndex = nextIndex
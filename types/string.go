@@ -1,8 +1,7 @@
 package types
 
 import (
-	"bytes"
-	"encoding/binary"
+	"context"
 	"reflect"
 )
 
@@ -12,48 +11,41 @@ func newStringSSZ() *stringSSZ {
 	return &stringSSZ{}
 }
 
-func (b *stringSSZ) Root(val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64) ([32]byte, error) {
-	var err error
+func (b *stringSSZ) root(val reflect.Value, typ reflect.Type, fieldName string, limits listLimits, state *HashState) ([32]byte, error) {
+	if state == nil {
+		state = NewHashState()
+	}
 	numItems := val.Len()
 	elemSize := uint64(1)
-	limit := (maxCapacity*elemSize + 31) / 32
+	limit := (limits.outer()*elemSize + 31) / 32
 	if limit == 0 {
 		limit = 1
 	}
-	leaves := make([][]byte, numItems)
-	for i := 0; i < numItems; i++ {
-		innerBuf := make([]byte, elemSize)
-		if _, err = marshalUint8(val.Index(i), innerBuf, 0); err != nil {
-			return [32]byte{}, err
-		}
-		leaves[i] = innerBuf
-	}
-	chunks, err := pack(leaves)
+	mark := state.mark()
+	defer state.pop(mark)
+	state.stack = append(state.stack, val.String()...)
+	state.packChunks(mark)
+	merkleRoot, err := state.merkleize(mark, limit)
 	if err != nil {
 		return [32]byte{}, err
 	}
-	buf := new(bytes.Buffer)
-	if err := binary.Write(buf, binary.LittleEndian, uint64(numItems)); err != nil {
-		return [32]byte{}, err
-	}
-	output := make([]byte, 32)
-	copy(output, buf.Bytes())
-	merkleRoot, err := bitwiseMerkleize(chunks, uint64(len(chunks)), limit)
-	if err != nil {
-		return [32]byte{}, err
-	}
-	return mixInLength(merkleRoot, output), nil
+	return state.mixInLength(merkleRoot, uint64(numItems)), nil
 }
 
-func (b *stringSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+func (b *stringSSZ) marshal(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
 	for i := 0; i < val.Len(); i++ {
 		buf[int(startOffset)+i] = uint8(val.Index(i).Uint())
 	}
 	return startOffset + uint64(val.Len()), nil
 }
 
-func (b *stringSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64) (uint64, error) {
-	offset := startOffset + uint64(len(input))
-	val.SetString(string(input[startOffset:offset]))
-	return offset, nil
+func (b *stringSSZ) unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64, state *DecodeState) (uint64, error) {
+	if startOffset > uint64(len(input)) {
+		return 0, &DecodeError{Offset: startOffset, Err: ErrOffsetOutOfRange}
+	}
+	if err := state.allocateBytes(uint64(len(input))-startOffset, startOffset); err != nil {
+		return 0, err
+	}
+	val.SetString(string(input[startOffset:]))
+	return uint64(len(input)), nil
 }
@@ -1,12 +1,16 @@
 package types
 
 import (
+	"context"
 	"encoding/binary"
-	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/dgraph-io/ristretto"
+	"github.com/minio/highwayhash"
 	"github.com/pkg/errors"
 	"github.com/prysmaticlabs/go-bitfield"
 )
@@ -17,72 +21,281 @@ import (
 // is chosen as the default value given its simplicity to represent unbounded size.
 var UnboundedSSZFieldSizeMarker = "?"
 
-type structSSZ struct{}
+// ContainerCacheSize for HashTreeRoot.
+const ContainerCacheSize = 100000
+
+type structSSZ struct {
+	hashCache *ristretto.Cache
+}
 
 func newStructSSZ() *structSSZ {
-	return &structSSZ{}
+	cache, _ := newHashCache("container", DefaultCacheConfig().Container)
+	return &structSSZ{
+		hashCache: cache,
+	}
 }
 
 func (b *structSSZ) Root(val reflect.Value, typ reflect.Type, fieldName string, maxCapacity uint64) ([32]byte, error) {
+	return b.root(val, typ, fieldName, capacityLimits(maxCapacity), nil)
+}
+
+// FieldsHasher returns the root of the first numFields fields of a container.
+func (b *structSSZ) FieldsHasher(val reflect.Value, typ reflect.Type, numFields int) ([32]byte, error) {
+	return b.fieldsRoot(val, typ, numFields, nil)
+}
+
+// SigningRoot returns the root of all fields of a container but the last, which usually
+// holds the signature of that root. Protobuf metadata fields are not counted.
+func (b *structSSZ) SigningRoot(val reflect.Value, typ reflect.Type) ([32]byte, error) {
+	numFields := 0
+	for i := 0; i < typ.NumField(); i++ {
+		if !isProtobufMetadataField(typ.Field(i)) {
+			numFields++
+		}
+	}
+	return b.fieldsRoot(val, typ, numFields-1, nil)
+}
+
+func (b *structSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+	return b.marshal(context.Background(), val, typ, buf, startOffset)
+}
+
+func (b *structSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64) (uint64, error) {
+	return b.unmarshal(val, typ, input, startOffset, nil)
+}
+
+func (b *structSSZ) root(val reflect.Value, typ reflect.Type, fieldName string, limits listLimits, state *HashState) ([32]byte, error) {
+	if state == nil {
+		state = NewHashState()
+	}
 	if typ.Kind() == reflect.Ptr {
 		if val.IsNil() {
 			instance := reflect.New(typ.Elem()).Elem()
-			return b.Root(instance, instance.Type(), fieldName, maxCapacity)
+			return b.root(instance, instance.Type(), fieldName, limits, state)
 		}
-		return b.Root(val.Elem(), typ.Elem(), fieldName, maxCapacity)
+		return b.root(val.Elem(), typ.Elem(), fieldName, limits, state)
+	}
+	if err := state.checkContext(); err != nil {
+		return [32]byte{}, err
 	}
 	numFields := typ.NumField()
-	return b.FieldsHasher(val, typ, numFields)
+	if !cacheConfig.Container.Enabled || !isLeafContainer(typ) {
+		return b.fieldsRoot(val, typ, numFields, state)
+	}
+	hashKey, err := b.cacheKey(state.ctx, val, typ)
+	if err != nil {
+		return b.fieldsRoot(val, typ, numFields, state)
+	}
+	res, ok := b.hashCache.Get(hashKey)
+	if res != nil && ok {
+		return verifyCachedRoot(fieldName, res.([32]byte), func() ([32]byte, error) {
+			return b.fieldsRoot(val, typ, numFields, state)
+		})
+	}
+	root, err := b.fieldsRoot(val, typ, numFields, state)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	b.hashCache.Set(hashKey, root, 32)
+	return root, nil
 }
 
-func (b *structSSZ) FieldsHasher(val reflect.Value, typ reflect.Type, numFields int) ([32]byte, error) {
-	roots := make([][]byte, numFields)
-	var err error
-	totalCountedFields := uint64(0)
-	structName := typ.Name()
-	for i := 0; i < numFields; i++ {
-		// We skip protobuf related metadata fields.
-		if strings.HasPrefix(typ.Field(i).Name, "XXX_") {
-			continue
+// cacheKey returns the key of the root of a container in the cache, a fast hash of its
+// serialized bytes along with the id of its type, as containers of different types may
+// share the same serialized bytes but not their roots. Containers are only cached when
+// their serialized bytes are well-formed, since vectors left nil are serialized short
+// and the bytes of such containers no longer identify them.
+//
+// Computing the key serializes the whole container, so only leaf containers, such as
+// validators, are cached: were the containers holding them cached too, their bytes would
+// be serialized again at every level of nesting.
+func (b *structSSZ) cacheKey(ctx context.Context, val reflect.Value, typ reflect.Type) (string, error) {
+	buf := make([]byte, typeIDSize+DetermineSize(val))
+	binary.LittleEndian.PutUint64(buf, containerTypeID(typ))
+	if _, err := b.marshal(ctx, val, typ, buf, typeIDSize); err != nil {
+		return "", err
+	}
+	enc := buf[typeIDSize:]
+	if !isVariableSizeType(typ) {
+		if uint64(len(enc)) != determineFixedTypeSize(typ) {
+			return "", errors.New("container serialized to unexpected size")
 		}
-		totalCountedFields++
-		fCapacity := determineFieldCapacity(typ.Field(i))
-		if b, ok := val.Field(i).Interface().(bitfield.Bitlist); ok {
-			r, err := BitlistRoot(b, fCapacity)
-			if err != nil {
-				return [32]byte{}, nil
-			}
-			roots[i] = r[:]
+	} else if err := validateEncoding(enc, typ, nil); err != nil {
+		return "", err
+	}
+	hashKey := highwayhash.Sum(buf, fastSumHashKey[:])
+	return string(hashKey[:]), nil
+}
+
+// leafContainers maps container types to whether they are leaf containers, holding no
+// containers of their own.
+var leafContainers sync.Map
+
+// isLeafContainer reports whether no field of a container of type typ holds containers,
+// directly or within lists and vectors. Containers with codecs are opaque, and are not
+// counted.
+func isLeafContainer(typ reflect.Type) bool {
+	if leaf, ok := leafContainers.Load(typ); ok {
+		return leaf.(bool)
+	}
+	leaf := true
+	for i := 0; i < typ.NumField() && leaf; i++ {
+		field := typ.Field(i)
+		if isProtobufMetadataField(field) {
 			continue
 		}
-		fType, err := determineFieldType(typ.Field(i))
-		if err != nil {
-			return [32]byte{}, err
+		fType, err := determineFieldType(field)
+		if err != nil || holdsContainers(fType) {
+			leaf = false
 		}
-		factory, err := SSZFactory(val.Field(i), fType)
-		if err != nil {
-			return [32]byte{}, err
+	}
+	leafContainers.Store(typ, leaf)
+	return leaf
+}
+
+// holdsContainers reports whether values of typ are or hold containers, which values of
+// interface types may.
+func holdsContainers(typ reflect.Type) bool {
+	typ = derefType(typ)
+	if factory, err := factoryOf(reflect.Value{}, typ); err == nil && factory == codecFactory {
+		return false
+	}
+	switch typ.Kind() {
+	case reflect.Struct, reflect.Interface:
+		return true
+	case reflect.Slice, reflect.Array:
+		return holdsContainers(typ.Elem())
+	default:
+		return false
+	}
+}
+
+// typeIDSize is the size of the type id prefixing the serialized bytes of containers
+// in their cache keys.
+const typeIDSize = 8
+
+// typeIDs maps container types to the ids their roots are cached under. Names do not
+// identify types, as types declared in different functions or built with
+// reflect.StructOf may share one while their fields are tagged differently.
+var typeIDs sync.Map
+
+// lastTypeID is the id last given to a container type.
+var lastTypeID uint64
+
+// containerTypeID returns the id of a container type, unique to it within the process.
+func containerTypeID(typ reflect.Type) uint64 {
+	if id, ok := typeIDs.Load(typ); ok {
+		return id.(uint64)
+	}
+	id, _ := typeIDs.LoadOrStore(typ, atomic.AddUint64(&lastTypeID, 1))
+	return id.(uint64)
+}
+
+// fieldsRoot returns the root of the first numFields fields of a container, computed
+// on the stack of state.
+func (b *structSSZ) fieldsRoot(val reflect.Value, typ reflect.Type, numFields int, state *HashState) ([32]byte, error) {
+	if state == nil {
+		state = NewHashState()
+	}
+	mark := state.mark()
+	defer state.pop(mark)
+	for _, field := range structRootPlan(typ) {
+		// Signing roots leave the last fields out.
+		if field.index >= numFields {
+			break
+		}
+		if field.mayBeBitlist {
+			if b, ok := val.Field(field.index).Interface().(bitfield.Bitlist); ok {
+				r, err := bitlistFieldRoot(b, field.capacity)
+				if err != nil {
+					return [32]byte{}, annotateEncodeError(err, typ.Field(field.index).Name)
+				}
+				state.pushRoot(r)
+				continue
+			}
 		}
-		r, err := factory.Root(val.Field(i), fType, structName+"."+typ.Field(i).Name, fCapacity)
+		if field.err != nil {
+			return [32]byte{}, field.err
+		}
+		r, err := field.factory.root(val.Field(field.index), field.fType, field.path, field.limits, state)
 		if err != nil {
 			return [32]byte{}, err
 		}
-		roots[i] = r[:]
+		state.pushRoot(r)
 	}
-	root, err := bitwiseMerkleize(roots, totalCountedFields, totalCountedFields)
-	if err != nil {
-		return [32]byte{}, err
+	count := state.chunks(mark)
+	return state.merkleize(mark, count)
+}
+
+// fieldRootPlan holds what computing the root of a field of a container needs to know
+// about it, which only depends on the container's type.
+type fieldRootPlan struct {
+	index    int
+	path     string
+	fType    reflect.Type
+	factory  sszFactory
+	capacity uint64
+	limits   listLimits
+	// mayBeBitlist is set for fields whose values may be bitlists, which are hashed
+	// with their capacity rather than by their type.
+	mayBeBitlist bool
+	// err is the error determining the type or the factory of the field returned,
+	// reported once the roots of the fields before it are computed.
+	err error
+}
+
+// rootPlans maps container types to the plans of their fields, resolved once per type
+// rather than on every root.
+var rootPlans sync.Map
+
+// structRootPlan returns the plans of the fields of a container of type typ which are
+// part of its root, in order.
+func structRootPlan(typ reflect.Type) []fieldRootPlan {
+	if plan, ok := rootPlans.Load(typ); ok {
+		return plan.([]fieldRootPlan)
 	}
-	return root, nil
+	plan := make([]fieldRootPlan, 0, typ.NumField())
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		// We skip protobuf related metadata fields.
+		if isProtobufMetadataField(field) {
+			continue
+		}
+		fType, err := determineFieldType(field)
+		var factory sszFactory
+		if err == nil {
+			factory, err = factoryOf(reflect.Value{}, fType)
+		}
+		mayBeBitlist := field.Type == bitlistType || field.Type.Kind() == reflect.Interface
+		if factory == codecFactory {
+			// Fields with codecs are hashed by them, even bitlists.
+			mayBeBitlist = false
+		}
+		plan = append(plan, fieldRootPlan{
+			index:        i,
+			path:         typ.Name() + "." + field.Name,
+			fType:        fType,
+			factory:      factory,
+			capacity:     determineFieldCapacity(field),
+			limits:       determineFieldLimits(field),
+			mayBeBitlist: mayBeBitlist,
+			err:          err,
+		})
+	}
+	rootPlans.Store(typ, plan)
+	return plan
 }
 
-func (b *structSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
+func (b *structSSZ) marshal(ctx context.Context, val reflect.Value, typ reflect.Type, buf []byte, startOffset uint64) (uint64, error) {
 	if typ.Kind() == reflect.Ptr {
 		if val.IsNil() {
 			newVal := reflect.New(typ.Elem()).Elem()
-			return b.Marshal(newVal, newVal.Type(), buf, startOffset)
+			return b.marshal(ctx, newVal, newVal.Type(), buf, startOffset)
 		}
-		return b.Marshal(val.Elem(), typ.Elem(), buf, startOffset)
+		return b.marshal(ctx, val.Elem(), typ.Elem(), buf, startOffset)
+	}
+	if err := checkContext(ctx); err != nil {
+		return 0, err
 	}
 	fixedIndex := startOffset
 	fixedLength := uint64(0)
@@ -90,7 +303,7 @@ func (b *structSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, sta
 	// are variable or fixed-size fields.
 	for i := 0; i < typ.NumField(); i++ {
 		// We skip protobuf related metadata fields.
-		if strings.Contains(typ.Field(i).Name, "XXX_") {
+		if isProtobufMetadataField(typ.Field(i)) {
 			continue
 		}
 		fType, err := determineFieldType(typ.Field(i))
@@ -112,26 +325,26 @@ func (b *structSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, sta
 	nextOffsetIndex := currentOffsetIndex
 	for i := 0; i < typ.NumField(); i++ {
 		// We skip protobuf related metadata fields.
-		if strings.Contains(typ.Field(i).Name, "XXX_") {
+		if isProtobufMetadataField(typ.Field(i)) {
 			continue
 		}
 		fType, err := determineFieldType(typ.Field(i))
 		if err != nil {
 			return 0, err
 		}
-		factory, err := SSZFactory(val.Field(i), fType)
+		factory, err := factoryOf(val.Field(i), fType)
 		if err != nil {
 			return 0, err
 		}
 		if !isVariableSizeType(fType) {
-			fixedIndex, err = factory.Marshal(val.Field(i), fType, buf, fixedIndex)
+			fixedIndex, err = factory.marshal(ctx, val.Field(i), fType, buf, fixedIndex)
 			if err != nil {
-				return 0, err
+				return 0, annotateEncodeError(err, typ.Field(i).Name)
 			}
 		} else {
-			nextOffsetIndex, err = factory.Marshal(val.Field(i), fType, buf, currentOffsetIndex)
+			nextOffsetIndex, err = factory.marshal(ctx, val.Field(i), fType, buf, currentOffsetIndex)
 			if err != nil {
-				return 0, err
+				return 0, annotateEncodeError(err, typ.Field(i).Name)
 			}
 			// Write the offset.
 			offsetBuf := make([]byte, BytesPerLengthOffset)
@@ -146,13 +359,17 @@ func (b *structSSZ) Marshal(val reflect.Value, typ reflect.Type, buf []byte, sta
 	return currentOffsetIndex, nil
 }
 
-func (b *structSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64) (uint64, error) {
+func (b *structSSZ) unmarshal(val reflect.Value, typ reflect.Type, input []byte, startOffset uint64, state *DecodeState) (uint64, error) {
 	if typ.Kind() == reflect.Ptr {
 		if val.IsNil() {
 			return startOffset, nil
 		}
-		return b.Unmarshal(val.Elem(), typ.Elem(), input, startOffset)
+		return b.unmarshal(val.Elem(), typ.Elem(), input, startOffset, state)
+	}
+	if err := state.enter(startOffset); err != nil {
+		return 0, err
 	}
+	defer state.leave()
 	endOffset := uint64(len(input))
 	currentIndex := startOffset
 	nextIndex := currentIndex
@@ -160,7 +377,7 @@ func (b *structSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte,
 
 	for i := 0; i < typ.NumField(); i++ {
 		// We skip protobuf related metadata fields.
-		if strings.Contains(typ.Field(i).Name, "XXX_") {
+		if isProtobufMetadataField(typ.Field(i)) {
 			continue
 		}
 		numFields++
@@ -176,21 +393,15 @@ func (b *structSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte,
 			continue
 		}
 		if val.Field(i).Kind() == reflect.Ptr {
-			instantiateConcreteTypeForElement(val.Field(i), fType.Elem())
+			instantiateConcreteTypeForElement(val.Field(i), typ.Field(i).Type.Elem())
 		}
 		concreteVal := val.Field(i)
-		sszSizeTags, hasTags, err := parseSSZFieldTags(typ.Field(i))
+		_, hasTags, err := parseSSZFieldTags(typ.Field(i))
 		if err != nil {
 			return 0, err
 		}
 		if hasTags {
-			concreteType := inferFieldTypeFromSizeTags(typ.Field(i), sszSizeTags)
-			concreteVal = reflect.New(concreteType).Elem()
-			// If the item is a slice, we grow it accordingly based on the size tags.
-			if val.Field(i).Kind() == reflect.Slice {
-				result := growSliceFromSizeTags(val.Field(i), sszSizeTags)
-				val.Field(i).Set(result)
-			}
+			concreteVal = reflect.New(fType).Elem()
 		}
 		fixedSz := determineFixedSize(concreteVal, fType)
 		fixedSizes[i] = fixedSz
@@ -202,15 +413,55 @@ func (b *structSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte,
 		if item, ok := fixedSizes[i]; ok {
 			offsetIndexCounter += item
 		} else {
-			if offsetIndexCounter+BytesPerLengthOffset > uint64(len(input)) {
-				offsetIndexCounter += BytesPerLengthOffset
-				continue
+			if offsetIndexCounter+BytesPerLengthOffset > endOffset {
+				return 0, &DecodeError{
+					Path:     typ.Field(i).Name,
+					Offset:   offsetIndexCounter,
+					Expected: BytesPerLengthOffset,
+					Actual:   remainingBytes(input, offsetIndexCounter),
+					Err:      ErrShortInput,
+				}
 			}
 			offsetVal := input[offsetIndexCounter : offsetIndexCounter+BytesPerLengthOffset]
-			offsets = append(offsets, startOffset+uint64(binary.LittleEndian.Uint32(offsetVal)))
+			offset := startOffset + uint64(binary.LittleEndian.Uint32(offsetVal))
+			if offset > endOffset {
+				return 0, &DecodeError{
+					Path:     typ.Field(i).Name,
+					Offset:   offsetIndexCounter,
+					Expected: endOffset,
+					Actual:   offset,
+					Err:      ErrOffsetOutOfRange,
+				}
+			}
+			if len(offsets) > 0 && offset < offsets[len(offsets)-1] {
+				return 0, &DecodeError{
+					Path:   typ.Field(i).Name,
+					Offset: offsetIndexCounter,
+					Err:    ErrInvalidOffset,
+				}
+			}
+			offsets = append(offsets, offset)
 			offsetIndexCounter += BytesPerLengthOffset
 		}
 	}
+	// The fixed-size part must fit in the input, and the variable-size part
+	// must start right after it.
+	if offsetIndexCounter > endOffset {
+		return 0, &DecodeError{
+			Offset:   startOffset,
+			Expected: offsetIndexCounter - startOffset,
+			Actual:   remainingBytes(input, startOffset),
+			Err:      ErrShortInput,
+		}
+	}
+	if len(offsets) > 0 && offsets[0] != offsetIndexCounter {
+		return 0, &DecodeError{
+			Offset:   startOffset,
+			Expected: offsetIndexCounter - startOffset,
+			Actual:   offsets[0] - startOffset,
+			Err:      ErrInvalidOffset,
+		}
+	}
 	offsets = append(offsets, endOffset)
 	offsetIndex := uint64(0)
 	for i := 0; i < numFields; i++ {
@@ -219,9 +470,9 @@ func (b *structSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte,
 			return 0, err
 		}
 		if val.Field(i).Kind() == reflect.Ptr {
-			instantiateConcreteTypeForElement(val.Field(i), fType.Elem())
+			instantiateConcreteTypeForElement(val.Field(i), typ.Field(i).Type.Elem())
 		}
-		factory, err := SSZFactory(val.Field(i), fType)
+		factory, err := factoryOf(val.Field(i), fType)
 		if err != nil {
 			return 0, err
 		}
@@ -229,10 +480,22 @@ func (b *structSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte,
 			if item == 0 {
 				continue
 			}
-			nextIndex = currentIndex + item
-			if _, err := factory.Unmarshal(val.Field(i), fType, input[currentIndex:nextIndex], 0); err != nil {
+			// Slices sized by tags are only grown once the input is known to hold them.
+			sszSizeTags, hasTags, err := parseSSZFieldTags(typ.Field(i))
+			if err != nil {
 				return 0, err
 			}
+			if hasTags && val.Field(i).Kind() == reflect.Slice {
+				result, err := growSliceFromSizeTags(val.Field(i), sszSizeTags, state, currentIndex)
+				if err != nil {
+					return 0, annotateDecodeError(err, typ.Field(i).Name, 0)
+				}
+				val.Field(i).Set(result)
+			}
+			nextIndex = currentIndex + item
+			if _, err := factory.unmarshal(val.Field(i), fType, input[currentIndex:nextIndex], 0, state); err != nil {
+				return 0, annotateDecodeError(err, typ.Field(i).Name, currentIndex)
+			}
 			currentIndex = nextIndex
 		} else {
 			firstOff := offsets[offsetIndex]
@@ -241,11 +504,36 @@ func (b *structSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte,
 				continue
 			}
 			nextOff := offsets[offsetIndex+1]
-			if nextOff > uint64(len(input)) {
-				return 0, fmt.Errorf("slice bounds out of range [%d:%d]", firstOff, nextOff)
+			// Lists longer than their ssz-max, or holding lists longer than theirs,
+			// are rejected before any of their elements are allocated.
+			maxLength := determineFieldCapacity(typ.Field(i))
+			if maxLength > 0 {
+				if length := impliedListLength(fType, input[firstOff:nextOff]); length > maxLength {
+					return 0, &DecodeError{
+						Path:     typ.Field(i).Name,
+						Offset:   firstOff,
+						Expected: maxLength,
+						Actual:   length,
+						Err:      ErrListTooLong,
+					}
+				}
 			}
-			if _, err := factory.Unmarshal(val.Field(i), fType, input[firstOff:nextOff], 0); err != nil {
-				return 0, err
+			if err := checkNestedLengths(input[firstOff:nextOff], fType, determineFieldLimits(typ.Field(i))); err != nil {
+				return 0, annotateDecodeError(err, typ.Field(i).Name, firstOff)
+			}
+			if _, err := factory.unmarshal(val.Field(i), fType, input[firstOff:nextOff], 0, state); err != nil {
+				return 0, annotateDecodeError(err, typ.Field(i).Name, firstOff)
+			}
+			if maxLength > 0 {
+				if length := fieldLength(val.Field(i)); length > maxLength {
+					return 0, &DecodeError{
+						Path:     typ.Field(i).Name,
+						Offset:   firstOff,
+						Expected: maxLength,
+						Actual:   length,
+						Err:      ErrListTooLong,
+					}
+				}
 			}
 			offsetIndex++
 			currentIndex += BytesPerLengthOffset
@@ -254,7 +542,70 @@ func (b *structSSZ) Unmarshal(val reflect.Value, typ reflect.Type, input []byte,
 	return currentIndex, nil
 }
 
+// fieldLength returns the number of elements held by a list field, counting
+// bits rather than bytes for bitlists so it can be compared against ssz-max.
+func fieldLength(val reflect.Value) uint64 {
+	if factory, err := factoryOf(val, val.Type()); err == nil && factory == codecFactory {
+		return 0
+	}
+	if b, ok := val.Interface().(bitfield.Bitlist); ok {
+		return b.Len()
+	}
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array, reflect.String:
+		return uint64(val.Len())
+	default:
+		return 0
+	}
+}
+
+// impliedListLength returns a lower bound on the number of elements a list of typ
+// encoded as input holds, without decoding any of them. Types whose length cannot be
+// determined up front report zero.
+func impliedListLength(typ reflect.Type, input []byte) uint64 {
+	if factory, err := factoryOf(reflect.Value{}, typ); err == nil && factory == codecFactory {
+		return 0
+	}
+	if typ == reflect.TypeOf(bitfield.Bitlist{}) {
+		// The last byte holds the length bit, so every byte but the last is full of bits.
+		if len(input) == 0 {
+			return 0
+		}
+		return uint64(len(input)-1) * 8
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return uint64(len(input))
+	case reflect.Slice:
+	default:
+		return 0
+	}
+	elem := typ.Elem()
+	if isVariableSizeType(elem) {
+		// Every element of a variable-size list has an offset ahead of the first element.
+		firstOffset, err := readFirstOffset(input, 0)
+		if err != nil {
+			return 0
+		}
+		return firstOffset / BytesPerLengthOffset
+	}
+	elemSize := determineFixedTypeSize(elem)
+	if elemSize == 0 {
+		return 0
+	}
+	return uint64(len(input)) / elemSize
+}
+
 func determineFieldType(field reflect.StructField) (reflect.Type, error) {
+	codecName, hasCodecTag, err := fieldCodecName(field)
+	if err != nil {
+		return nil, err
+	}
+	if hasCodecTag {
+		// Fields tagged with a codec are given a type of their own, which the codec
+		// is found by wherever the field is sized, encoded or hashed.
+		return codecFieldType(field.Type, codecName), nil
+	}
 	fieldSizeTags, exists, err := parseSSZFieldTags(field)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not parse ssz struct field tags")
@@ -267,15 +618,7 @@ func determineFieldType(field reflect.StructField) (reflect.Type, error) {
 }
 
 func determineFieldCapacity(field reflect.StructField) uint64 {
-	tag, exists := field.Tag.Lookup("ssz-max")
-	if !exists {
-		return 0
-	}
-	val, err := strconv.ParseUint(tag, 10, 64)
-	if err != nil {
-		return 0
-	}
-	return val
+	return determineFieldLimits(field).outer()
 }
 
 func parseSSZFieldTags(field reflect.StructField) ([]uint64, bool, error) {
@@ -1,8 +1,11 @@
 package types
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type structWithTags struct {
@@ -79,3 +82,321 @@ func TestParseSSZFieldTags_HandlesOverflow(t *testing.T) {
 		t.Errorf("got: %d, wanted %d", result, want)
 	}
 }
+
+type cachedContainer struct {
+	Epoch uint64
+	Roots [][]byte `ssz-size:"2,32"`
+	Data  []byte   `ssz-max:"64"`
+}
+
+type otherCachedContainer struct {
+	Slot  uint64
+	Roots [][]byte `ssz-size:"2,32"`
+	Data  []byte   `ssz-max:"32"`
+}
+
+func TestStructRoot_ContainerCache(t *testing.T) {
+	values := []cachedContainer{
+		{Epoch: 1, Roots: [][]byte{make([]byte, 32), make([]byte, 32)}, Data: []byte{1}},
+		{Epoch: 2, Roots: [][]byte{make([]byte, 32), make([]byte, 32)}, Data: []byte{1}},
+		{Epoch: 1, Roots: [][]byte{make([]byte, 32), make([]byte, 32)}, Data: []byte{1, 2}},
+	}
+	want := make([][32]byte, len(values))
+	for i, v := range values {
+		root, err := StructFactory.root(reflect.ValueOf(v), reflect.TypeOf(v), "", nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[i] = root
+	}
+	ToggleContainerCache(true)
+	defer ToggleContainerCache(false)
+	for round := 0; round < 2; round++ {
+		for i, v := range values {
+			root, err := StructFactory.root(reflect.ValueOf(v), reflect.TypeOf(v), "", nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if root != want[i] {
+				t.Errorf("Expected root %#x, received %#x", want[i], root)
+			}
+		}
+	}
+}
+
+func TestStructCacheKey(t *testing.T) {
+	v := cachedContainer{Epoch: 1, Roots: [][]byte{make([]byte, 32), make([]byte, 32)}, Data: []byte{1}}
+	other := otherCachedContainer{Slot: 1, Roots: v.Roots, Data: v.Data}
+	key, err := StructFactory.cacheKey(context.Background(), reflect.ValueOf(v), reflect.TypeOf(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := StructFactory.cacheKey(context.Background(), reflect.ValueOf(other), reflect.TypeOf(other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == otherKey {
+		t.Error("Expected containers of different types with the same bytes to have different keys")
+	}
+	// Vectors left nil are serialized short, so they are not cached.
+	v.Roots = nil
+	if _, err := StructFactory.cacheKey(context.Background(), reflect.ValueOf(v), reflect.TypeOf(v)); err == nil {
+		t.Error("Expected container with a nil vector not to be cached")
+	}
+}
+
+func TestIsLeafContainer(t *testing.T) {
+	type nested struct {
+		Inner cachedContainer
+	}
+	type nestedPtr struct {
+		Inner *cachedContainer
+	}
+	type list struct {
+		Inners []cachedContainer `ssz-max:"4"`
+	}
+	type vector struct {
+		Inners [2][]*cachedContainer `ssz-max:"?,4"`
+	}
+	tests := []struct {
+		name string
+		typ  reflect.Type
+		want bool
+	}{
+		{"leaf", reflect.TypeOf(cachedContainer{}), true},
+		{"nested", reflect.TypeOf(nested{}), false},
+		{"nested pointer", reflect.TypeOf(nestedPtr{}), false},
+		{"list of containers", reflect.TypeOf(list{}), false},
+		{"vector of lists of containers", reflect.TypeOf(vector{}), false},
+	}
+	for _, tt := range tests {
+		if got := isLeafContainer(tt.typ); got != tt.want {
+			t.Errorf("%s: expected %v, received %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestStructRoot_ContainerCacheSkipsNestedContainers(t *testing.T) {
+	type nested struct {
+		Inner cachedContainer
+	}
+	v := nested{Inner: cachedContainer{Epoch: 1, Roots: [][]byte{make([]byte, 32), make([]byte, 32)}, Data: []byte{1}}}
+	val, typ := reflect.ValueOf(v), reflect.TypeOf(v)
+	key, err := StructFactory.cacheKey(context.Background(), val, typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	innerKey, err := StructFactory.cacheKey(context.Background(), val.Field(0), typ.Field(0).Type)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ToggleContainerCache(true)
+	defer ToggleContainerCache(false)
+	// Wait for the cache to admit the root of the inner container.
+	for i := 0; i < 100; i++ {
+		if _, err := StructFactory.root(val, typ, "", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := StructFactory.hashCache.Get(innerKey); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := StructFactory.hashCache.Get(innerKey); !ok {
+		t.Error("Expected the root of the inner container to be cached")
+	}
+	if _, ok := StructFactory.hashCache.Get(key); ok {
+		t.Error("Expected the root of the outer container not to be cached")
+	}
+}
+
+func TestStructRoot_ContainerCacheSameNamedTypes(t *testing.T) {
+	newSmall := func() interface{} {
+		type inner struct {
+			L []uint64 `ssz-max:"4"`
+		}
+		return inner{L: []uint64{1}}
+	}
+	newLarge := func() interface{} {
+		type inner struct {
+			L []uint64 `ssz-max:"1024"`
+		}
+		return inner{L: []uint64{1}}
+	}
+	small, large := newSmall(), newLarge()
+	smallVal, smallTyp := reflect.ValueOf(small), reflect.TypeOf(small)
+	largeVal, largeTyp := reflect.ValueOf(large), reflect.TypeOf(large)
+	if smallTyp.PkgPath()+smallTyp.String() != largeTyp.PkgPath()+largeTyp.String() {
+		t.Fatalf("Expected types of the same name, received %v and %v", smallTyp, largeTyp)
+	}
+	factory := newStructSSZ()
+	want, err := factory.root(largeVal, largeTyp, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	smallKey, err := factory.cacheKey(context.Background(), smallVal, smallTyp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	largeKey, err := factory.cacheKey(context.Background(), largeVal, largeTyp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if smallKey == largeKey {
+		t.Error("Expected containers of different types with the same name and bytes to have different keys")
+	}
+	ToggleContainerCache(true)
+	defer ToggleContainerCache(false)
+	// Cache the root of the first type, waiting for the cache to admit it.
+	for i := 0; i < 100; i++ {
+		if _, err := factory.root(smallVal, smallTyp, "", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := factory.hashCache.Get(smallKey); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if root, err := factory.root(largeVal, largeTyp, "", nil, nil); err != nil || root != want {
+		t.Errorf("Expected root %#x, received %#x, %v", want, root, err)
+	}
+}
+
+func TestStructRoot_CacheVerification(t *testing.T) {
+	v := cachedContainer{Epoch: 1, Roots: [][]byte{make([]byte, 32), make([]byte, 32)}, Data: []byte{1}}
+	val, typ := reflect.ValueOf(v), reflect.TypeOf(v)
+	factory := newStructSSZ()
+	want, err := factory.root(val, typ, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := factory.cacheKey(context.Background(), val, typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Poison the cache with a stale root, waiting for the cache to admit it.
+	stale := [32]byte{1}
+	for i := 0; i < 100; i++ {
+		factory.hashCache.Set(key, stale, 32)
+		if res, ok := factory.hashCache.Get(key); ok && res.([32]byte) == stale {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	ToggleContainerCache(true)
+	defer ToggleContainerCache(false)
+	if root, err := factory.root(val, typ, "Container", nil, nil); err != nil || root != stale {
+		t.Fatalf("Expected stale root %#x to be served from the cache, received %#x, %v", stale, root, err)
+	}
+	ToggleCacheVerification(true)
+	defer ToggleCacheVerification(false)
+	_, err = factory.root(val, typ, "Container", nil, nil)
+	if !errors.Is(err, ErrCacheMismatch) {
+		t.Fatalf("Expected ErrCacheMismatch, received %v", err)
+	}
+	var mismatch *CacheMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Path != "Container" || mismatch.Cached != stale || mismatch.Computed != want {
+		t.Errorf("Unexpected cache mismatch error %v", err)
+	}
+}
+
+func TestDetermineFieldLimits(t *testing.T) {
+	input := struct {
+		Single   []uint64   `ssz-max:"16"`
+		Nested   [][]uint64 `ssz-max:"16,32"`
+		Inner    [][]uint64 `ssz-max:"?,32"`
+		Invalid  [][]uint64 `ssz-max:"16,x"`
+		Untagged []uint64
+	}{}
+	typ := reflect.TypeOf(input)
+	tests := []struct {
+		field    string
+		limits   listLimits
+		capacity uint64
+		nested   bool
+	}{
+		{field: "Single", limits: listLimits{16}, capacity: 16},
+		{field: "Nested", limits: listLimits{16, 32}, capacity: 16, nested: true},
+		{field: "Inner", limits: listLimits{0, 32}, capacity: 0, nested: true},
+		{field: "Invalid"},
+		{field: "Untagged"},
+	}
+	for _, tt := range tests {
+		field, _ := typ.FieldByName(tt.field)
+		limits := determineFieldLimits(field)
+		if !reflect.DeepEqual(limits, tt.limits) {
+			t.Errorf("%s: determineFieldLimits() = %v, want %v", tt.field, limits, tt.limits)
+		}
+		if capacity := determineFieldCapacity(field); capacity != tt.capacity {
+			t.Errorf("%s: determineFieldCapacity() = %d, want %d", tt.field, capacity, tt.capacity)
+		}
+		if limits.nested() != tt.nested {
+			t.Errorf("%s: nested() = %v, want %v", tt.field, limits.nested(), tt.nested)
+		}
+	}
+}
+
+func TestSSZFactory_MatchesStateFactory(t *testing.T) {
+	v := struct {
+		Slot  uint64
+		Roots [][]byte `ssz-max:"4"`
+	}{Slot: 3, Roots: [][]byte{{1, 2}, {3}}}
+	val, typ := reflect.ValueOf(v), reflect.TypeOf(v)
+	factory, err := SSZFactory(val, typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateFactory, err := StateFactory(val, typ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, DetermineSize(val))
+	if _, err := factory.Marshal(val, typ, buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	got := reflect.New(typ).Elem()
+	if _, err := factory.Unmarshal(got, typ, buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Interface(), v) {
+		t.Errorf("Unmarshal() = %v, want %v", got.Interface(), v)
+	}
+	root, err := factory.Root(val, typ, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := stateFactory.RootContext(context.Background(), val, typ, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != want {
+		t.Errorf("Root() = %#x, want %#x", root, want)
+	}
+	if _, err := stateFactory.MarshalContext(context.Background(), val, typ, buf, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFactoryRoot_NestedListLimits(t *testing.T) {
+	type nested struct {
+		Lists [][]uint64 `ssz-max:"16,32"`
+	}
+	v := nested{Lists: [][]uint64{{1, 2, 3}, {}, {4}}}
+	want, err := StructFactory.root(reflect.ValueOf(v), reflect.TypeOf(v), "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listRoot, err := compositeSliceFactory.root(reflect.ValueOf(v.Lists), reflect.TypeOf(v.Lists), "", listLimits{16, 32}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := NewHashState()
+	state.pushRoot(listRoot)
+	root, err := state.merkleize(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root != want {
+		t.Errorf("root() = %#x, want %#x", root, want)
+	}
+}
@@ -0,0 +1,393 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/protolambda/zssz/merkle"
+	"github.com/prysmaticlabs/go-bitfield"
+)
+
+// Tracker computes the hash tree root of a value repeatedly, rehashing only the parts of
+// the value recorded as mutated since the previous root. The roots of containers and
+// lists are kept as Merkle trees over the roots of their fields and elements, so a
+// mutated field or element only rehashes its own subtree and its path to the root.
+// Mutations are recorded through Set, or with MarkDirty for values mutated directly.
+type Tracker struct {
+	val  reflect.Value
+	typ  reflect.Type
+	node *trackedNode
+}
+
+// trackedNode caches the tree of a container or a list, or a vector, along with the
+// nodes of its fields or elements which are containers or lists themselves.
+type trackedNode struct {
+	tree *IncrementalTree
+	// length is the number of fields or elements merkleized into the tree.
+	length   uint64
+	children map[uint64]*trackedNode
+	// dirty holds the fields or elements of the node which were mutated, by their
+	// position in the container or their index in the list.
+	dirty map[uint64]bool
+	// fields holds the layout of the fields of a container, resolved when the node is
+	// built rather than for every leaf.
+	fields []fieldLayout
+}
+
+// trackedLayout describes how the root of a container or list is computed from its
+// fields or elements.
+type trackedLayout struct {
+	length uint64
+	limit  uint64
+	// elemSize is the size of the basic elements packed into the chunks of the tree,
+	// or zero when the leaves of the tree are the roots of fields or elements.
+	elemSize    uint64
+	mixInLength bool
+	// elemLimits holds the limits of the lists nested within the elements of a list
+	// or vector.
+	elemLimits listLimits
+	// rootElems records elements which are roots themselves, and are leaves as they are.
+	rootElems bool
+	// fields holds the layout of the fields of a container.
+	fields []fieldLayout
+}
+
+// NewTracker returns a tracker of the value pointed to by val, which mutations of the
+// value must be recorded with. The first root computed hashes the whole value.
+func NewTracker(val reflect.Value) (*Tracker, error) {
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return nil, errors.New("can only track values through a non-nil pointer")
+	}
+	if _, err := factoryOf(val.Elem(), val.Type().Elem()); err != nil {
+		return nil, err
+	}
+	return &Tracker{val: val.Elem(), typ: val.Type().Elem()}, nil
+}
+
+// Root returns the hash tree root of the tracked value, rehashing the mutations
+// recorded since the previous root.
+func (t *Tracker) Root() ([32]byte, error) {
+	node, root, err := trackedRoot(t.node, t.val, t.typ, nil)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	t.node = node
+	return root, nil
+}
+
+// Set assigns value to the field or element of the tracked value at path, such as
+// Validators[3].Balance, and records it as mutated.
+func (t *Tracker) Set(path string, value interface{}) error {
+	segments, err := parseFieldPath(path)
+	if err != nil {
+		return err
+	}
+	target := t.val
+	for _, segment := range segments {
+		for target.Kind() == reflect.Ptr {
+			if target.IsNil() {
+				instantiateConcreteTypeForElement(target, target.Type().Elem())
+			}
+			target = target.Elem()
+		}
+		switch {
+		case segment.name != "" && target.Kind() == reflect.Struct:
+			target = target.FieldByName(segment.name)
+			if !target.IsValid() {
+				return fmt.Errorf("no field %s in path %s", segment.name, path)
+			}
+		case segment.name == "" && (target.Kind() == reflect.Slice || target.Kind() == reflect.Array):
+			if segment.index >= target.Len() {
+				return fmt.Errorf("index %d out of range in path %s", segment.index, path)
+			}
+			target = target.Index(segment.index)
+		default:
+			return fmt.Errorf("cannot select %s of %v in path %s", segment, target.Type(), path)
+		}
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case !v.IsValid():
+		target.Set(reflect.Zero(target.Type()))
+	case v.Type().AssignableTo(target.Type()):
+		target.Set(v)
+	case v.Type().ConvertibleTo(target.Type()):
+		target.Set(v.Convert(target.Type()))
+	default:
+		return fmt.Errorf("cannot set %s of type %v to value of type %T", path, target.Type(), value)
+	}
+	return t.markDirty(path, segments)
+}
+
+// MarkDirty records the field or element at path of the tracked value as mutated, so
+// that its root is recomputed by the next call to Root. Paths name fields separated
+// by dots and select list or vector elements by index, such as Validators[3].Balance.
+// Marking a list itself is required when elements are added or removed.
+func (t *Tracker) MarkDirty(path string) error {
+	segments, err := parseFieldPath(path)
+	if err != nil {
+		return err
+	}
+	return t.markDirty(path, segments)
+}
+
+func (t *Tracker) markDirty(path string, segments []pathSegment) error {
+	typ := t.typ
+	node := t.node
+	for i, segment := range segments {
+		typ = derefType(typ)
+		var index uint64
+		switch {
+		case segment.name != "" && typ.Kind() == reflect.Struct:
+			layout, _, err := structLayout(typ)
+			if err != nil {
+				return err
+			}
+			found := false
+			for position, item := range layout {
+				if item.field.Name == segment.name {
+					index, typ, found = uint64(position), item.fType, true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("type %v has no field %s", typ, segment.name)
+			}
+		case segment.name == "" && (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array):
+			index, typ = uint64(segment.index), typ.Elem()
+		default:
+			return fmt.Errorf("cannot select %s of %v in path %s", segment, typ, path)
+		}
+		// Values which were never hashed are hashed whole, but the rest of the path
+		// is still checked against their type.
+		if node == nil {
+			continue
+		}
+		node.dirty[index] = true
+		child := node.children[index]
+		if i == len(segments)-1 {
+			// The value at the end of the path may have been replaced as a whole.
+			delete(node.children, index)
+		}
+		node = child
+	}
+	return nil
+}
+
+// trackedRoot returns the root of val of type typ, reusing the cached tree of node when
+// one was built for val, and returns the node caching the tree of val. Values which are
+// not containers or lists of many chunks are hashed without a node.
+func trackedRoot(node *trackedNode, val reflect.Value, typ reflect.Type, limits listLimits) (*trackedNode, [32]byte, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			val = reflect.New(val.Type().Elem())
+		}
+		val = val.Elem()
+	}
+	var layout trackedLayout
+	if node != nil && node.fields != nil {
+		// The fields of a container only depend on its type, and were laid out when
+		// its node was built.
+		layout = trackedLayout{length: node.length, limit: node.length, fields: node.fields}
+	} else {
+		var ok bool
+		layout, ok = trackedLayoutOf(val, typ, limits)
+		if !ok {
+			factory, err := factoryOf(val, typ)
+			if err != nil {
+				return nil, [32]byte{}, err
+			}
+			root, err := factory.root(val, typ, "", limits, nil)
+			return nil, root, err
+		}
+	}
+	var err error
+	if node == nil || node.length != layout.length {
+		node, err = buildTrackedNode(val, typ, layout)
+	} else {
+		err = node.rehash(val, typ, layout)
+	}
+	if err != nil {
+		return nil, [32]byte{}, err
+	}
+	root := node.tree.treeRoot()
+	if layout.mixInLength {
+		root = mixInLength(root, lengthChunk(layout.length))
+	}
+	return node, root, nil
+}
+
+// trackedLayoutOf mirrors the Root implementation of the factory of typ, reporting false
+// for values whose root is left to their factory.
+func trackedLayoutOf(val reflect.Value, typ reflect.Type, limits listLimits) (trackedLayout, bool) {
+	factory, err := factoryOf(val, typ)
+	if err != nil {
+		return trackedLayout{}, false
+	}
+	kind := typ.Kind()
+	switch {
+	case factory == codecFactory:
+		return trackedLayout{}, false
+	case kind == reflect.Struct:
+		layout, _, err := structLayout(typ)
+		if err != nil || len(layout) == 0 {
+			return trackedLayout{}, false
+		}
+		return trackedLayout{length: uint64(len(layout)), limit: uint64(len(layout)), fields: layout}, true
+	case kind != reflect.Slice && kind != reflect.Array:
+		return trackedLayout{}, false
+	}
+	length := uint64(val.Len())
+	elemKind := typ.Elem().Kind()
+	// Byte strings are hashed whole, as are vectors missing some of their elements.
+	if length == 0 || elemKind == reflect.Uint8 || (kind == reflect.Array && length != uint64(typ.Len())) {
+		return trackedLayout{}, false
+	}
+	maxCapacity := limits.outer()
+	layout := trackedLayout{
+		length:      length,
+		limit:       length,
+		mixInLength: kind == reflect.Slice,
+		rootElems:   isRootsArray(val, typ),
+	}
+	if isBasicType(elemKind) {
+		layout.elemSize = determineFixedTypeSize(typ.Elem())
+		chunks := (length*layout.elemSize + 31) / 32
+		if kind == reflect.Array {
+			layout.limit = chunks
+		} else if limit := (maxCapacity*layout.elemSize + 31) / 32; limit > 0 {
+			layout.limit = limit
+		}
+		if chunks < 2 {
+			return trackedLayout{}, false
+		}
+	} else if kind == reflect.Slice && maxCapacity > 0 {
+		layout.limit = maxCapacity
+	}
+	if limits.appliesToElements(typ) {
+		layout.elemLimits = limits.inner()
+	}
+	if layout.limit < layout.length && layout.elemSize == 0 {
+		// Lists over their limit are left to their factory to report.
+		return trackedLayout{}, false
+	}
+	return layout, true
+}
+
+func buildTrackedNode(val reflect.Value, typ reflect.Type, layout trackedLayout) (*trackedNode, error) {
+	node := &trackedNode{
+		length:   layout.length,
+		children: make(map[uint64]*trackedNode),
+		dirty:    make(map[uint64]bool),
+		fields:   layout.fields,
+	}
+	leaves := make([][32]byte, layout.leaves())
+	for i := range leaves {
+		leaf, err := node.leaf(uint64(i), val, typ, layout)
+		if err != nil {
+			return nil, err
+		}
+		leaves[i] = leaf
+	}
+	tree, err := newTreeFromLeaves(uint64(merkle.GetDepth(layout.limit)), leaves)
+	if err != nil {
+		return nil, err
+	}
+	node.tree = tree
+	return node, nil
+}
+
+// rehash updates the leaves of the fields or elements of the node marked as dirty.
+func (n *trackedNode) rehash(val reflect.Value, typ reflect.Type, layout trackedLayout) error {
+	for index := range n.dirty {
+		delete(n.dirty, index)
+		if index >= n.length {
+			continue
+		}
+		leafIndex := index
+		if layout.elemSize > 0 {
+			leafIndex = index * layout.elemSize / 32
+		}
+		leaf, err := n.leaf(leafIndex, val, typ, layout)
+		if err != nil {
+			return err
+		}
+		n.tree.update(leafIndex, leaf)
+	}
+	return nil
+}
+
+// leaf computes the leaf at index of the tree of val, caching the nodes of fields or
+// elements which have trees of their own.
+func (n *trackedNode) leaf(index uint64, val reflect.Value, typ reflect.Type, layout trackedLayout) ([32]byte, error) {
+	switch {
+	case layout.elemSize > 0:
+		return packedChunk(val, typ.Elem(), index, layout)
+	case typ.Kind() == reflect.Struct:
+		item := n.fields[index]
+		fVal := val.FieldByIndex(item.field.Index)
+		limits := determineFieldLimits(item.field)
+		if b, ok := fVal.Interface().(bitfield.Bitlist); ok {
+			root, err := bitlistFieldRoot(b, limits.outer())
+			if err != nil {
+				return [32]byte{}, annotateEncodeError(err, item.field.Name)
+			}
+			return root, nil
+		}
+		child, root, err := trackedRoot(n.children[index], fVal, item.fType, limits)
+		if err != nil {
+			return [32]byte{}, annotateEncodeError(err, item.field.Name)
+		}
+		n.setChild(index, child)
+		return root, nil
+	case layout.rootElems:
+		switch item := val.Index(int(index)).Interface().(type) {
+		case [32]byte:
+			return item, nil
+		case []byte:
+			return toBytes32(item), nil
+		default:
+			return [32]byte{}, fmt.Errorf("expected array or slice of len 32, received %v", item)
+		}
+	default:
+		child, root, err := trackedRoot(n.children[index], val.Index(int(index)), typ.Elem(), layout.elemLimits)
+		if err != nil {
+			return [32]byte{}, annotateEncodeError(err, indexPath(int(index)))
+		}
+		n.setChild(index, child)
+		return root, nil
+	}
+}
+
+func (n *trackedNode) setChild(index uint64, child *trackedNode) {
+	if child == nil {
+		delete(n.children, index)
+		return
+	}
+	n.children[index] = child
+}
+
+// leaves returns the number of leaves of the tree of a value with this layout.
+func (l trackedLayout) leaves() uint64 {
+	if l.elemSize > 0 {
+		return (l.length*l.elemSize + 31) / 32
+	}
+	return l.length
+}
+
+// packedChunk returns the chunk at index of the basic elements of val packed together.
+func packedChunk(val reflect.Value, elemType reflect.Type, index uint64, layout trackedLayout) ([32]byte, error) {
+	buf := make([]byte, 32)
+	perChunk := 32 / layout.elemSize
+	for i := index * perChunk; i < (index+1)*perChunk && i < layout.length; i++ {
+		if _, err := basicFactory.marshal(context.Background(), val.Index(int(i)), elemType, buf, (i-index*perChunk)*layout.elemSize); err != nil {
+			return [32]byte{}, err
+		}
+	}
+	return toBytes32(buf), nil
+}
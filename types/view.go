@@ -0,0 +1,323 @@
+package types
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+
+	"github.com/prysmaticlabs/go-bitfield"
+)
+
+var bitlistType = reflect.TypeOf(bitfield.Bitlist{})
+
+// View is a read-only view over the SSZ encoding of a value. Fields and elements are
+// reached by following offsets on demand, and every accessor returns sub-slices of the
+// original input rather than copies. The whole encoding is validated once when the root
+// view is created, so navigating a view cannot run out of bounds.
+type View struct {
+	data   []byte
+	typ    reflect.Type
+	limits listLimits
+	path   string
+	// isBitlistField records a bitlist reached through a container field, which
+	// is the only place bitlists are merkleized with their length bit removed.
+	isBitlistField bool
+}
+
+// NewView validates input as the SSZ encoding of a value of type typ, and returns
+// a view over it.
+func NewView(input []byte, typ reflect.Type) (*View, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if err := validateEncoding(input, typ, nil); err != nil {
+		return nil, err
+	}
+	return &View{data: input, typ: typ}, nil
+}
+
+// Type returns the type of the value encoded in the view.
+func (v *View) Type() reflect.Type {
+	return unwrapCodecFieldType(v.typ)
+}
+
+// Bytes returns the encoding of the value, sharing memory with the original input.
+func (v *View) Bytes() []byte {
+	return v.data
+}
+
+// Field returns a view of the named field of a container.
+func (v *View) Field(name string) (*View, error) {
+	start, end, fType, err := locateStructField(v.data, v.typ, name)
+	if err != nil {
+		return nil, err
+	}
+	field, _ := v.typ.FieldByName(name)
+	return &View{
+		data:           v.data[start:end],
+		typ:            derefType(fType),
+		limits:         determineFieldLimits(field),
+		path:           JoinFieldPath(v.path, name),
+		isBitlistField: field.Type == bitlistType && !hasCodec(fType),
+	}, nil
+}
+
+// Index returns a view of the element at index i of a list or vector.
+func (v *View) Index(i int) (*View, error) {
+	if i < 0 {
+		return nil, fmt.Errorf("negative index %d", i)
+	}
+	start, end, elem, err := locateElement(v.data, v.typ, i)
+	if err != nil {
+		return nil, err
+	}
+	return &View{
+		data:   v.data[start:end],
+		typ:    derefType(elem),
+		limits: v.limits.inner(),
+		path:   JoinFieldPath(v.path, indexPath(i)),
+	}, nil
+}
+
+// Len returns the number of elements of a list or vector, the number of bits of a
+// bitlist, or the length of a string. Other values have a length of zero.
+func (v *View) Len() uint64 {
+	if v.typ == bitlistType {
+		return bitfield.Bitlist(v.data).Len()
+	}
+	if factory, err := factoryOf(reflect.Value{}, v.typ); err != nil || factory == codecFactory {
+		return 0
+	}
+	switch v.typ.Kind() {
+	case reflect.String:
+		return uint64(len(v.data))
+	case reflect.Slice, reflect.Array:
+		return encodedListLength(v.data, v.typ)
+	default:
+		return 0
+	}
+}
+
+// Uint64 returns the value of a boolean or unsigned integer.
+func (v *View) Uint64() (uint64, error) {
+	switch v.typ.Kind() {
+	case reflect.Bool, reflect.Uint8:
+		return uint64(v.data[0]), nil
+	case reflect.Uint16:
+		return uint64(binary.LittleEndian.Uint16(v.data)), nil
+	case reflect.Uint32:
+		return uint64(binary.LittleEndian.Uint32(v.data)), nil
+	case reflect.Uint64:
+		return binary.LittleEndian.Uint64(v.data), nil
+	default:
+		return 0, fmt.Errorf("%s of type %v is not an unsigned integer", v.path, v.typ)
+	}
+}
+
+// HashTreeRoot returns the hash tree root of the value, applying the ssz-max
+// limits of the field the view was reached through, if any.
+func (v *View) HashTreeRoot() ([32]byte, error) {
+	if v.isBitlistField {
+		return BitlistRoot(bitfield.Bitlist(v.data), v.limits.outer())
+	}
+	root, err := rootFromBytes(v.data, v.typ, v.limits)
+	if err != nil {
+		return [32]byte{}, annotateDecodeError(err, v.path, 0)
+	}
+	return root, nil
+}
+
+func derefType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// encodedListLength returns the number of elements of a list or vector of typ encoded
+// as input, which must have been validated.
+func encodedListLength(input []byte, typ reflect.Type) uint64 {
+	elem := typ.Elem()
+	if isVariableSizeType(elem) {
+		if len(input) == 0 {
+			return 0
+		}
+		return uint64(binary.LittleEndian.Uint32(input)) / BytesPerLengthOffset
+	}
+	size := determineFixedTypeSize(elem)
+	if size == 0 {
+		return 0
+	}
+	return uint64(len(input)) / size
+}
+
+// validateEncoding checks that input is a well-formed encoding of a value of typ,
+// following every offset without decoding any value. Lists are checked against
+// limits, level by level, where they are set.
+func validateEncoding(input []byte, typ reflect.Type, limits listLimits) error {
+	typ = derefType(typ)
+	if !isVariableSizeType(typ) {
+		size := determineFixedTypeSize(typ)
+		if uint64(len(input)) != size {
+			return &DecodeError{Expected: size, Actual: uint64(len(input)), Err: ErrSizeMismatch}
+		}
+	}
+	if c, ok := codecOf(typ); ok {
+		return c.validate(input)
+	}
+	kind := typ.Kind()
+	switch {
+	case kind == reflect.Bool:
+		if input[0] > 1 {
+			return &DecodeError{Err: ErrInvalidBool}
+		}
+		return nil
+	case isBasicType(kind):
+		return nil
+	case typ == bitlistType:
+		// Bitlists end with a byte holding their length bit, but an empty field
+		// decodes to an empty bitlist.
+		if len(input) == 0 {
+			return nil
+		}
+		if input[len(input)-1] == 0 {
+			return &DecodeError{Offset: uint64(len(input) - 1), Err: ErrSizeMismatch}
+		}
+		return checkCapacity(bitfield.Bitlist(input).Len(), limits.outer())
+	case kind == reflect.String:
+		return checkCapacity(uint64(len(input)), limits.outer())
+	case kind == reflect.Slice || kind == reflect.Array:
+		return validateListEncoding(input, typ, limits)
+	case kind == reflect.Struct:
+		return validateStructEncoding(input, typ)
+	default:
+		return fmt.Errorf("type %v is not serializable", typ)
+	}
+}
+
+func validateListEncoding(input []byte, typ reflect.Type, limits listLimits) error {
+	elem := derefType(typ.Elem())
+	length := uint64(0)
+	if isVariableSizeType(elem) {
+		if len(input) > 0 {
+			firstOffset, err := readFirstOffset(input, 0)
+			if err != nil {
+				return err
+			}
+			length = firstOffset / BytesPerLengthOffset
+		}
+	} else {
+		size := determineFixedTypeSize(elem)
+		if size == 0 || uint64(len(input))%size != 0 {
+			return &DecodeError{Expected: size, Actual: uint64(len(input)), Err: ErrSizeMismatch}
+		}
+		length = uint64(len(input)) / size
+	}
+	if typ.Kind() == reflect.Array && length != uint64(typ.Len()) {
+		return &DecodeError{Expected: uint64(typ.Len()), Actual: length, Err: ErrVectorLength}
+	}
+	if err := checkCapacity(length, limits.outer()); err != nil {
+		return err
+	}
+	// Elements of other unsigned integers can hold any value.
+	if isBasicType(elem.Kind()) && elem.Kind() != reflect.Bool {
+		return nil
+	}
+	for i := 0; i < int(length); i++ {
+		start, end, _, err := locateElement(input, typ, i)
+		if err != nil {
+			return err
+		}
+		if err := validateEncoding(input[start:end], elem, limits.inner()); err != nil {
+			return annotateDecodeError(err, indexPath(i), start)
+		}
+	}
+	return nil
+}
+
+func validateStructEncoding(input []byte, typ reflect.Type) error {
+	endOffset := uint64(len(input))
+	index := uint64(0)
+	type variableField struct {
+		field  reflect.StructField
+		fType  reflect.Type
+		offset uint64
+	}
+	var variableFields []variableField
+	for i := 0; i < typ.NumField(); i++ {
+		// We skip protobuf related metadata fields.
+		if isProtobufMetadataField(typ.Field(i)) {
+			continue
+		}
+		field := typ.Field(i)
+		fType, err := determineFieldType(field)
+		if err != nil {
+			return err
+		}
+		if !isVariableSizeType(fType) {
+			size := determineFixedTypeSize(fType)
+			if index+size > endOffset {
+				return &DecodeError{
+					Path:     field.Name,
+					Offset:   index,
+					Expected: size,
+					Actual:   remainingBytes(input, index),
+					Err:      ErrShortInput,
+				}
+			}
+			if err := validateEncoding(input[index:index+size], fType, nil); err != nil {
+				return annotateDecodeError(err, field.Name, index)
+			}
+			index += size
+			continue
+		}
+		if index+BytesPerLengthOffset > endOffset {
+			return &DecodeError{
+				Path:     field.Name,
+				Offset:   index,
+				Expected: BytesPerLengthOffset,
+				Actual:   remainingBytes(input, index),
+				Err:      ErrShortInput,
+			}
+		}
+		offset := uint64(binary.LittleEndian.Uint32(input[index : index+BytesPerLengthOffset]))
+		if offset > endOffset {
+			return &DecodeError{
+				Path:     field.Name,
+				Offset:   index,
+				Expected: endOffset,
+				Actual:   offset,
+				Err:      ErrOffsetOutOfRange,
+			}
+		}
+		if len(variableFields) > 0 && offset < variableFields[len(variableFields)-1].offset {
+			return &DecodeError{Path: field.Name, Offset: index, Err: ErrInvalidOffset}
+		}
+		variableFields = append(variableFields, variableField{field: field, fType: fType, offset: offset})
+		index += BytesPerLengthOffset
+	}
+	// The variable-size part must start right after the fixed-size part.
+	if len(variableFields) == 0 {
+		return nil
+	}
+	if variableFields[0].offset != index {
+		return &DecodeError{Expected: index, Actual: variableFields[0].offset, Err: ErrInvalidOffset}
+	}
+	for i, f := range variableFields {
+		end := endOffset
+		if i+1 < len(variableFields) {
+			end = variableFields[i+1].offset
+		}
+		if err := validateEncoding(input[f.offset:end], f.fType, determineFieldLimits(f.field)); err != nil {
+			return annotateDecodeError(err, f.field.Name, f.offset)
+		}
+	}
+	return nil
+}
+
+func checkCapacity(length uint64, maxCapacity uint64) error {
+	if maxCapacity > 0 && length > maxCapacity {
+		return &DecodeError{Expected: maxCapacity, Actual: length, Err: ErrListTooLong}
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package types
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+)
+
+// ListWriter encodes a list to an io.Writer one element at a time, so the list is never
+// held in memory as a whole. Fixed-size elements are written through as they are
+// appended. Variable-size elements are preceded by a table of offsets which is only
+// known once every element has been appended, so they are spilled to a temporary file
+// until the list is closed, keeping only one offset per element in memory.
+type ListWriter struct {
+	w        io.Writer
+	elemType reflect.Type
+	limit    uint64
+	variable bool
+	length   uint64
+	// size is the number of bytes of element data appended so far.
+	size uint64
+	// starts holds the position of every variable-size element within the spill.
+	starts []uint64
+	spill  *os.File
+	closed bool
+}
+
+// NewListWriter returns a writer of a list of elemType elements to w, holding at most
+// limit elements when limit is set. Nothing is written until the first element is
+// appended, and the encoding is only complete once the writer is closed.
+func NewListWriter(w io.Writer, elemType reflect.Type, limit uint64) (*ListWriter, error) {
+	elemType = derefType(elemType)
+	if _, err := factoryOf(reflect.New(elemType).Elem(), elemType); err != nil {
+		return nil, err
+	}
+	return &ListWriter{
+		w:        w,
+		elemType: elemType,
+		limit:    limit,
+		variable: isVariableSizeType(elemType),
+	}, nil
+}
+
+// Append encodes elem as the next element of the list. Elements may be given either
+// as values or as pointers to values of the element type, and vectors described by
+// ssz-size tags may be given as slices.
+func (l *ListWriter) Append(elem interface{}) error {
+	if l.closed {
+		return errors.New("cannot append to a closed list writer")
+	}
+	val := reflect.ValueOf(elem)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			val = reflect.New(val.Type().Elem())
+		}
+		val = val.Elem()
+	}
+	if !val.IsValid() || !isAppendable(val.Type(), l.elemType) {
+		return fmt.Errorf("cannot append value of type %T to list of %v", elem, l.elemType)
+	}
+	if l.limit > 0 && l.length >= l.limit {
+		return &EncodeError{Expected: l.limit, Actual: l.length + 1, Err: ErrListTooLong}
+	}
+	enc, err := encodeValue(val, l.elemType)
+	if err != nil {
+		return annotateEncodeError(err, indexPath(int(l.length)))
+	}
+	if !l.variable {
+		if _, err := l.w.Write(enc); err != nil {
+			return err
+		}
+	} else {
+		if l.spill == nil {
+			l.spill, err = ioutil.TempFile("", "ssz-list-")
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := l.spill.Write(enc); err != nil {
+			return err
+		}
+		l.starts = append(l.starts, l.size)
+	}
+	l.size += uint64(len(enc))
+	l.length++
+	return nil
+}
+
+// Len returns the number of elements appended so far.
+func (l *ListWriter) Len() uint64 {
+	return l.length
+}
+
+// Close completes the encoding of the list, writing out the offsets and spilled
+// elements of a list of variable-size elements, and removes any temporary file.
+func (l *ListWriter) Close() error {
+	if l.closed {
+		return errors.New("list writer is already closed")
+	}
+	l.closed = true
+	if l.spill == nil {
+		return nil
+	}
+	defer func() {
+		l.spill.Close()
+		os.Remove(l.spill.Name())
+	}()
+	if l.encodedSize() > math.MaxUint32 {
+		return &EncodeError{Expected: math.MaxUint32, Actual: l.encodedSize(), Err: ErrOffsetOutOfRange}
+	}
+	buffered := bufio.NewWriter(l.w)
+	offsetBuf := make([]byte, BytesPerLengthOffset)
+	tableSize := l.length * BytesPerLengthOffset
+	for _, start := range l.starts {
+		binary.LittleEndian.PutUint32(offsetBuf, uint32(tableSize+start))
+		if _, err := buffered.Write(offsetBuf); err != nil {
+			return err
+		}
+	}
+	if _, err := l.spill.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(buffered, l.spill); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// encodedSize returns the number of bytes of the encoding of the list.
+func (l *ListWriter) encodedSize() uint64 {
+	if l.variable {
+		return l.length*BytesPerLengthOffset + l.size
+	}
+	return l.size
+}
+
+// ContainerWriter encodes a container to an io.Writer, streaming the elements of one of
+// its list fields with a ListWriter while the other fields are encoded from a value.
+// The offsets of variable-size fields following the streamed field depend on its length,
+// so they are back-patched once it is closed when the writer is an io.WriteSeeker. Other
+// writers receive the streamed field through a temporary file in that case.
+type ContainerWriter struct {
+	w      io.Writer
+	seeker io.WriteSeeker
+	base   int64
+	name   string
+	// fixed is the fixed-size part of the encoding, holding the offsets of every
+	// variable-size field.
+	fixed []byte
+	// head and tail hold the encodings of the variable-size fields before and
+	// after the streamed field.
+	head   [][]byte
+	tail   []fieldEncoding
+	offset uint64
+	list   *ListWriter
+	spill  *os.File
+	closed bool
+}
+
+// fieldEncoding is the encoding of a variable-size field along with the position of its
+// offset in the fixed-size part of a container.
+type fieldEncoding struct {
+	position uint64
+	enc      []byte
+}
+
+// NewContainerWriter returns a writer of the container val to w, in which the list field
+// named field is encoded from the elements appended to the writer instead of the value
+// it holds in val.
+func NewContainerWriter(w io.Writer, val reflect.Value, field string) (*ContainerWriter, error) {
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			val = reflect.New(val.Type().Elem())
+		}
+		val = val.Elem()
+	}
+	typ := val.Type()
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot stream field %s of non-struct type %v", field, typ)
+	}
+	layout, fixedSize, err := structLayout(typ)
+	if err != nil {
+		return nil, err
+	}
+	c := &ContainerWriter{w: w, name: field, fixed: make([]byte, fixedSize)}
+	streamed := -1
+	offset := fixedSize
+	for i, item := range layout {
+		if item.field.Name == field {
+			if item.fType.Kind() != reflect.Slice || item.field.Type == bitlistType || hasCodec(item.fType) {
+				return nil, fmt.Errorf("cannot stream field %s of type %v", field, item.fType)
+			}
+			c.list, err = NewListWriter(w, item.fType.Elem(), determineFieldCapacity(item.field))
+			if err != nil {
+				return nil, err
+			}
+			binary.LittleEndian.PutUint32(c.fixed[item.position:], uint32(offset))
+			c.offset = offset
+			streamed = i
+			continue
+		}
+		enc, err := encodeValue(val.FieldByIndex(item.field.Index), item.fType)
+		if err != nil {
+			return nil, annotateEncodeError(err, item.field.Name)
+		}
+		switch {
+		case !item.variable:
+			copy(c.fixed[item.position:], enc)
+		case streamed < 0:
+			binary.LittleEndian.PutUint32(c.fixed[item.position:], uint32(offset))
+			c.head = append(c.head, enc)
+			offset += uint64(len(enc))
+		default:
+			c.tail = append(c.tail, fieldEncoding{position: item.position, enc: enc})
+		}
+	}
+	if streamed < 0 {
+		return nil, fmt.Errorf("type %v has no field %s", typ, field)
+	}
+	if offset > math.MaxUint32 {
+		return nil, &EncodeError{Expected: math.MaxUint32, Actual: offset, Err: ErrOffsetOutOfRange}
+	}
+	if len(c.tail) > 0 {
+		if seeker, ok := w.(io.WriteSeeker); ok {
+			if c.base, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			c.seeker = seeker
+		} else {
+			// Nothing can be written before the length of the streamed field is known.
+			if c.spill, err = ioutil.TempFile("", "ssz-container-"); err != nil {
+				return nil, err
+			}
+			c.list.w = c.spill
+			return c, nil
+		}
+	}
+	if err := c.writeHead(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Append encodes elem as the next element of the streamed field.
+func (c *ContainerWriter) Append(elem interface{}) error {
+	return annotateEncodeError(c.list.Append(elem), c.name)
+}
+
+// Close completes the encoding of the streamed field and writes the variable-size
+// fields following it, patching their offsets, and removes any temporary file.
+func (c *ContainerWriter) Close() error {
+	if c.closed {
+		return errors.New("container writer is already closed")
+	}
+	c.closed = true
+	if c.spill != nil {
+		defer func() {
+			c.spill.Close()
+			os.Remove(c.spill.Name())
+		}()
+	}
+	if err := c.list.Close(); err != nil {
+		return annotateEncodeError(err, c.name)
+	}
+	offset := c.offset + c.list.encodedSize()
+	for _, f := range c.tail {
+		if offset > math.MaxUint32 {
+			return &EncodeError{Expected: math.MaxUint32, Actual: offset, Err: ErrOffsetOutOfRange}
+		}
+		binary.LittleEndian.PutUint32(c.fixed[f.position:], uint32(offset))
+		offset += uint64(len(f.enc))
+	}
+	switch {
+	case c.spill != nil:
+		if err := c.writeHead(); err != nil {
+			return err
+		}
+		if _, err := c.spill.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(c.w, c.spill); err != nil {
+			return err
+		}
+		return c.writeTail()
+	case c.seeker != nil:
+		if err := c.writeTail(); err != nil {
+			return err
+		}
+		end, err := c.seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err := c.seeker.Seek(c.base, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := c.seeker.Write(c.fixed); err != nil {
+			return err
+		}
+		_, err = c.seeker.Seek(end, io.SeekStart)
+		return err
+	default:
+		return nil
+	}
+}
+
+func (c *ContainerWriter) writeHead() error {
+	if _, err := c.w.Write(c.fixed); err != nil {
+		return err
+	}
+	for _, enc := range c.head {
+		if _, err := c.w.Write(enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ContainerWriter) writeTail() error {
+	for _, f := range c.tail {
+		if _, err := c.w.Write(f.enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isAppendable reports whether values of typ can be encoded as elements of type elemType.
+func isAppendable(typ reflect.Type, elemType reflect.Type) bool {
+	if typ == elemType {
+		return true
+	}
+	if typ.Kind() == reflect.Slice && elemType.Kind() == reflect.Array {
+		return isAppendable(typ.Elem(), elemType.Elem())
+	}
+	return false
+}
+
+// encodeValue returns the encoding of a single value of type typ. Fixed-size values are
+// sized from their type, so that vectors described by ssz-size tags are always encoded
+// at their full size.
+func encodeValue(val reflect.Value, typ reflect.Type) ([]byte, error) {
+	size := determineFixedTypeSize(typ)
+	if isVariableSizeType(typ) {
+		size = determineVariableSize(val, typ)
+	}
+	factory, err := factoryOf(val, typ)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if _, err := factory.marshal(context.Background(), val, typ, buf, 0); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,73 @@
+package ssz
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/pkg/errors"
+	"github.com/prysmaticlabs/go-ssz/types"
+)
+
+// ListWriter encodes a list one element at a time, without holding the list in memory.
+type ListWriter = types.ListWriter
+
+// ContainerWriter encodes a container whose list field is streamed one element at a time.
+type ContainerWriter = types.ContainerWriter
+
+// NewListWriter returns a writer encoding a list of elements of type elemType to w, as
+// they are appended. The list holds at most limit elements, unless limit is zero, and
+// its encoding is the same as the one of Marshal on a slice of the appended elements.
+// Lists of variable-size elements are spilled to a temporary file until Close is called.
+//
+//  lw, err := NewListWriter(file, reflect.TypeOf(Validator{}), 1<<40)
+//  if err != nil {
+//      return err
+//  }
+//  for it.Next() {
+//      if err := lw.Append(it.Validator()); err != nil {
+//          return err
+//      }
+//  }
+//  if err := lw.Close(); err != nil {
+//      return err
+//  }
+func NewListWriter(w io.Writer, elemType reflect.Type, limit uint64) (*ListWriter, error) {
+	if elemType == nil {
+		return nil, errors.New("cannot write list of untyped, nil elements")
+	}
+	lw, err := types.NewListWriter(w, elemType, limit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not write list of type: %v", elemType)
+	}
+	return lw, nil
+}
+
+// NewContainerWriter returns a writer encoding the struct val to w, in which the list
+// field named field is encoded from the elements appended to the writer rather than
+// from val. Its encoding is complete once Close is called. When other variable-size
+// fields follow the streamed field, their offsets are back-patched if w is an
+// io.WriteSeeker, and the streamed field is spilled to a temporary file otherwise.
+//
+//  cw, err := NewContainerWriter(file, state, "Validators")
+//  if err != nil {
+//      return err
+//  }
+//  for it.Next() {
+//      if err := cw.Append(it.Validator()); err != nil {
+//          return err
+//      }
+//  }
+//  if err := cw.Close(); err != nil {
+//      return err
+//  }
+func NewContainerWriter(w io.Writer, val interface{}, field string) (*ContainerWriter, error) {
+	if val == nil {
+		return nil, errors.New("untyped-value nil cannot be marshaled")
+	}
+	rval := reflect.ValueOf(val)
+	cw, err := types.NewContainerWriter(w, rval, field)
+	if err != nil {
+		return nil, errors.Wrapf(withTypeName(err, rval.Type()), "failed to marshal for type: %v", rval.Type())
+	}
+	return cw, nil
+}
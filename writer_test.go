@@ -0,0 +1,131 @@
+package ssz
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		elemType reflect.Type
+		elems    interface{}
+	}{
+		{name: "basic elements", elemType: reflect.TypeOf(uint64(0)), elems: []uint64{1, 2, 3}},
+		{name: "no elements", elemType: reflect.TypeOf(uint64(0)), elems: []uint64{}},
+		{name: "variable-size elements", elemType: reflect.TypeOf(""), elems: []string{"a", "", "bcd"}},
+		{name: "pointer elements", elemType: reflect.TypeOf(&partialValidator{}), elems: newLazyState().Validators},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			lw, err := NewListWriter(&buf, tt.elemType, 4096)
+			if err != nil {
+				t.Fatal(err)
+			}
+			elems := reflect.ValueOf(tt.elems)
+			for i := 0; i < elems.Len(); i++ {
+				if err := lw.Append(elems.Index(i).Interface()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := lw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			want, err := Marshal(tt.elems)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("Expected encoding %#x, received %#x", want, buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestListWriter_Limit(t *testing.T) {
+	lw, err := NewListWriter(ioutil.Discard, reflect.TypeOf(""), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lw.Close()
+	if err := lw.Append("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lw.Append(uint64(1)); err == nil {
+		t.Error("Expected error appending element of the wrong type")
+	}
+	if err := lw.Append("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lw.Append("c"); !errors.Is(err, ErrListTooLong) {
+		t.Errorf("Expected ErrListTooLong, received %v", err)
+	}
+}
+
+func TestContainerWriter(t *testing.T) {
+	state := newLazyState()
+	want, err := Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := ioutil.TempDir("", "ssz-writer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	file, err := os.Create(filepath.Join(tmp, "state.ssz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		name  string
+		field string
+		seek  bool
+	}{
+		{name: "spilled to a temporary file", field: "Validators"},
+		{name: "back-patched", field: "Validators", seek: true},
+		{name: "last variable-size field", field: "Names"},
+		{name: "first variable-size field", field: "Flags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			var cw *ContainerWriter
+			var err error
+			if tt.seek {
+				cw, err = NewContainerWriter(file, state, tt.field)
+			} else {
+				cw, err = NewContainerWriter(&buf, state, tt.field)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			elems := reflect.ValueOf(state).Elem().FieldByName(tt.field)
+			for j := 0; j < elems.Len(); j++ {
+				if err := cw.Append(elems.Index(j).Interface()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := cw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got := buf.Bytes()
+			if tt.seek {
+				if got, err = ioutil.ReadFile(file.Name()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(got, want) {
+				t.Error("Streamed encoding does not match the encoding of the state")
+			}
+		})
+	}
+}